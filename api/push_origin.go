@@ -0,0 +1,48 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package api
+
+// PushOrigin is Data Collector Edge origin stage which receives data pushed by an external system and hands it
+// to the pipeline from multiple goroutines. Every goroutine gets its own pipeline runner, with its own instances
+// of the processor and destination stages, so batches are processed in parallel.
+//
+// GetNumberOfThreads method returns the number of goroutines the origin pushes batches from. The pipeline
+// creates that many pipeline runners, limited by the pipeline maxRunners configuration.
+//
+// Run method - When running a pipeline, the Data Collector Edge calls this method once from the PushOrigin stage.
+// The method should block until the stage context is stopped, pushing batches through the given PushContext.
+// lastOffsets the offsets committed per entity by previous runs of the pipeline.
+// maxBatchSize the requested maximum batch size of a single batch.
+// Return error if the origin failed and the pipeline should be stopped.
+type PushOrigin interface {
+	GetNumberOfThreads() int
+	Run(lastOffsets map[string]string, maxBatchSize int, pushContext PushContext) error
+}
+
+// PushContext is used by PushOrigin stages to push batches to the pipeline.
+//
+// StartBatch method blocks until a pipeline runner is available and returns the context of a new batch.
+//
+// ProcessBatch method processes the batch in the pipeline runner, and on success commits the offset for
+// the given entity. Returns false if the batch could not be processed.
+type PushContext interface {
+	StartBatch() BatchContext
+	ProcessBatch(batchContext BatchContext, entityName string, offset *string) bool
+}
+
+// BatchContext holds a batch started by a PushOrigin stage.
+//
+// GetBatchMaker method returns the BatchMaker records of this batch must be added to.
+type BatchContext interface {
+	GetBatchMaker() BatchMaker
+}
@@ -14,13 +14,17 @@ package common
 
 import (
 	"github.com/streamsets/datacollector-edge/api"
+	"sync"
 )
 
 type ErrorSink struct {
-	stageErrorMessages map[string][]api.ErrorMessage
-	stageErrorRecords  map[string][]api.Record
-	totalErrorRecords  int64
-	totalErrorMessages int64
+	mutex                 sync.Mutex
+	stageErrorMessages    map[string][]api.ErrorMessage
+	stageErrorRecords     map[string][]api.Record
+	stageDiscardedRecords map[string]int64
+	totalErrorRecords     int64
+	totalErrorMessages    int64
+	totalDiscardedRecords int64
 }
 
 func NewErrorSink() *ErrorSink {
@@ -33,20 +37,35 @@ func NewErrorSink() *ErrorSink {
 
 //After each batch call this function to clear current batch error messages/records
 func (e *ErrorSink) ClearErrorRecordsAndMessages() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
 	e.stageErrorMessages = make(map[string][]api.ErrorMessage)
 	e.stageErrorRecords = make(map[string][]api.Record)
+	e.stageDiscardedRecords = make(map[string]int64)
 	e.totalErrorMessages = 0
 	e.totalErrorRecords = 0
+	e.totalDiscardedRecords = 0
 }
 
 func (e *ErrorSink) GetStageErrorMessages(stageIns string) []api.ErrorMessage {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
 	return e.stageErrorMessages[stageIns]
 }
 
 func (e *ErrorSink) GetStageErrorRecords(stageIns string) []api.Record {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
 	return e.stageErrorRecords[stageIns]
 }
 
+// Records dropped by stages configured with the DISCARD on record error policy
+func (e *ErrorSink) GetStageDiscardedRecords(stageIns string) int64 {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.stageDiscardedRecords[stageIns]
+}
+
 func (e *ErrorSink) GetTotalErrorMessages() int64 {
 	return e.totalErrorMessages
 }
@@ -55,6 +74,10 @@ func (e *ErrorSink) GetTotalErrorRecords() int64 {
 	return e.totalErrorRecords
 }
 
+func (e *ErrorSink) GetTotalDiscardedRecords() int64 {
+	return e.totalDiscardedRecords
+}
+
 func (e *ErrorSink) GetErrorRecords() map[string][]api.Record {
 	return e.stageErrorRecords
 }
@@ -64,6 +87,8 @@ func (e *ErrorSink) GetErrorMessages() map[string][]api.ErrorMessage {
 }
 
 func (e *ErrorSink) ReportError(stageIns string, errorMessage api.ErrorMessage) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
 	var errorMessages []api.ErrorMessage
 	var keyExists bool
 	errorMessages, keyExists = e.stageErrorMessages[stageIns]
@@ -78,6 +103,8 @@ func (e *ErrorSink) ReportError(stageIns string, errorMessage api.ErrorMessage)
 }
 
 func (e *ErrorSink) ToError(stageIns string, record api.Record) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
 	var errorRecords []api.Record
 	var keyExists bool
 	errorRecords, keyExists = e.stageErrorRecords[stageIns]
@@ -89,3 +116,36 @@ func (e *ErrorSink) ToError(stageIns string, record api.Record) {
 	e.stageErrorRecords[stageIns] = errorRecords
 	e.totalErrorRecords += 1
 }
+
+func (e *ErrorSink) DiscardRecord(stageIns string) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.stageDiscardedRecords[stageIns] += 1
+	e.totalDiscardedRecords += 1
+}
+
+// TransferStageErrors moves the error records, messages and discarded records reported so far by the given
+// stage to the target sink. Used by push origins, which report errors from multiple goroutines to a shared sink.
+func (e *ErrorSink) TransferStageErrors(stageIns string, target *ErrorSink) {
+	e.mutex.Lock()
+	errorMessages := e.stageErrorMessages[stageIns]
+	errorRecords := e.stageErrorRecords[stageIns]
+	discardedRecords := e.stageDiscardedRecords[stageIns]
+	delete(e.stageErrorMessages, stageIns)
+	delete(e.stageErrorRecords, stageIns)
+	delete(e.stageDiscardedRecords, stageIns)
+	e.totalErrorMessages -= int64(len(errorMessages))
+	e.totalErrorRecords -= int64(len(errorRecords))
+	e.totalDiscardedRecords -= discardedRecords
+	e.mutex.Unlock()
+
+	for _, errorMessage := range errorMessages {
+		target.ReportError(stageIns, errorMessage)
+	}
+	for _, record := range errorRecords {
+		target.ToError(stageIns, record)
+	}
+	for i := int64(0); i < discardedRecords; i++ {
+		target.DiscardRecord(stageIns)
+	}
+}
@@ -14,9 +14,11 @@ package common
 
 import (
 	"github.com/streamsets/datacollector-edge/api"
+	"sync"
 )
 
 type EventSink struct {
+	mutex        sync.Mutex
 	eventRecords map[string][]api.Record
 }
 
@@ -27,14 +29,20 @@ func NewEventSink() *EventSink {
 }
 
 func (e *EventSink) ClearEventRecords() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
 	e.eventRecords = make(map[string][]api.Record)
 }
 
 func (e *EventSink) GetStageEvents(stageIns string) []api.Record {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
 	return e.eventRecords[stageIns]
 }
 
 func (e *EventSink) AddEvent(stageIns string, record api.Record) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
 	var eventRecords []api.Record
 	var keyExists bool
 	eventRecords, keyExists = e.eventRecords[stageIns]
@@ -45,3 +53,15 @@ func (e *EventSink) AddEvent(stageIns string, record api.Record) {
 	eventRecords = append(eventRecords, record)
 	e.eventRecords[stageIns] = eventRecords
 }
+
+// TransferStageEvents moves the events generated so far by the given stage to the target sink
+func (e *EventSink) TransferStageEvents(stageIns string, target *EventSink) {
+	e.mutex.Lock()
+	eventRecords := e.eventRecords[stageIns]
+	delete(e.eventRecords, stageIns)
+	e.mutex.Unlock()
+
+	for _, record := range eventRecords {
+		target.AddEvent(stageIns, record)
+	}
+}
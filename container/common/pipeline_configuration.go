@@ -37,10 +37,13 @@ type PipelineConfiguration struct {
 	ErrorStage           *StageConfiguration              `json:"errorStage"`
 	TestOriginStage      *StageConfiguration              `json:"testOriginStage"`
 	StatsAggregatorStage *StageConfiguration              `json:"statsAggregatorStage"`
+	StartEventStages     []*StageConfiguration            `json:"startEventStages"`
+	StopEventStages      []*StageConfiguration            `json:"stopEventStages"`
 	Previewable          bool                             `json:"previewable"`
 	Info                 PipelineInfo                     `json:"info"`
 	Metadata             map[string]interface{}           `json:"metadata"`
 	Fragments            []*PipelineFragmentConfiguration `json:"fragments"`
+	RuleDefinitions      *RuleDefinitions                 `json:"ruleDefinitions"`
 }
 
 type PipelineFragmentConfiguration struct {
@@ -0,0 +1,88 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package common
+
+const (
+	ThresholdTypeCount      = "COUNT"
+	ThresholdTypePercentage = "PERCENTAGE"
+	MetricTypeCounter       = "COUNTER"
+	MetricTypeGauge         = "GAUGE"
+	MetricTypeHistogram     = "HISTOGRAM"
+	MetricTypeMeter         = "METER"
+	MetricTypeTimer         = "TIMER"
+)
+
+// RuleDefinitions are the data rules and metric rules of a pipeline, in the format of the Data Collector
+// pipeline rules
+type RuleDefinitions struct {
+	SchemaVersion          int                      `json:"schemaVersion"`
+	Version                int                      `json:"version"`
+	MetricsRuleDefinitions []*MetricsRuleDefinition `json:"metricsRuleDefinitions"`
+	DataRuleDefinitions    []*DataRuleDefinition    `json:"dataRuleDefinitions"`
+	EmailIds               []string                 `json:"emailIds"`
+	UUID                   string                   `json:"uuid"`
+}
+
+// MetricsRuleDefinition raises an alert when the condition, like ${value() > 100}, matches the value of the
+// metric element (for example METER_COUNT) of the metric with the metric id (for example
+// stage.HTTPClient_01.errorRecords.meter)
+type MetricsRuleDefinition struct {
+	Id            string `json:"id"`
+	AlertText     string `json:"alertText"`
+	MetricId      string `json:"metricId"`
+	MetricType    string `json:"metricType"`
+	MetricElement string `json:"metricElement"`
+	Condition     string `json:"condition"`
+	SendEmail     bool   `json:"sendEmail"`
+	Enabled       bool   `json:"enabled"`
+	Timestamp     int64  `json:"timestamp"`
+	Valid         bool   `json:"valid"`
+}
+
+// DataRuleDefinition evaluates the condition on a sample of the records of a lane and raises an alert when the
+// number or the percentage of matching records exceeds the threshold
+type DataRuleDefinition struct {
+	Id                      string  `json:"id"`
+	Label                   string  `json:"label"`
+	Lane                    string  `json:"lane"`
+	SamplingPercentage      float64 `json:"samplingPercentage"`
+	SamplingRecordsToRetain int     `json:"samplingRecordsToRetain"`
+	Condition               string  `json:"condition"`
+	AlertEnabled            bool    `json:"alertEnabled"`
+	AlertText               string  `json:"alertText"`
+	ThresholdType           string  `json:"thresholdType"`
+	ThresholdValue          string  `json:"thresholdValue"`
+	MinVolume               int64   `json:"minVolume"`
+	MeterEnabled            bool    `json:"meterEnabled"`
+	SendEmail               bool    `json:"sendEmail"`
+	Enabled                 bool    `json:"enabled"`
+	Timestamp               int64   `json:"timestamp"`
+	Valid                   bool    `json:"valid"`
+}
+
+// Alert is a triggered data rule or metric rule, in the format of the Data Collector alerts
+type Alert struct {
+	PipelineName   string      `json:"pipelineName"`
+	RuleDefinition interface{} `json:"ruleDefinition"`
+	Gauge          AlertGauge  `json:"gauge"`
+}
+
+type AlertGauge struct {
+	Value AlertGaugeValue `json:"value"`
+}
+
+type AlertGaugeValue struct {
+	CurrentValue interface{} `json:"currentValue"`
+	Timestamp    int64       `json:"timestamp"`
+	AlertTexts   []string    `json:"alertTexts"`
+}
@@ -13,10 +13,13 @@
 package common
 
 import (
+	"errors"
 	"github.com/satori/go.uuid"
 	log "github.com/sirupsen/logrus"
 	"io/ioutil"
+	"net/http"
 	"os"
+	"sync"
 )
 
 const (
@@ -28,7 +31,47 @@ type RuntimeInfo struct {
 	BaseDir      string
 	HttpUrl      string
 	DPMEnabled   bool
-	AppAuthToken string
+	appAuthToken string
+	// renews the Control Hub app auth token after Control Hub rejected it
+	appAuthTokenRenewer func(rejectedToken string) error
+	// guards the app auth token, which is renewed while events and metrics are sent to Control Hub
+	appAuthTokenMutex sync.RWMutex
+}
+
+// GetAppAuthToken returns the app auth token used to send events and metrics to Control Hub
+func (r *RuntimeInfo) GetAppAuthToken() string {
+	r.appAuthTokenMutex.RLock()
+	defer r.appAuthTokenMutex.RUnlock()
+	return r.appAuthToken
+}
+
+func (r *RuntimeInfo) SetAppAuthToken(appAuthToken string) {
+	r.appAuthTokenMutex.Lock()
+	defer r.appAuthTokenMutex.Unlock()
+	r.appAuthToken = appAuthToken
+}
+
+func (r *RuntimeInfo) SetAppAuthTokenRenewer(appAuthTokenRenewer func(rejectedToken string) error) {
+	r.appAuthTokenMutex.Lock()
+	defer r.appAuthTokenMutex.Unlock()
+	r.appAuthTokenRenewer = appAuthTokenRenewer
+}
+
+// RenewAppAuthToken renews the app auth token after Control Hub rejected it. Concurrent senders rejected with
+// the same token renew it once, the token is not renewed again if it changed since it was rejected.
+func (r *RuntimeInfo) RenewAppAuthToken(rejectedToken string) error {
+	r.appAuthTokenMutex.RLock()
+	appAuthTokenRenewer := r.appAuthTokenRenewer
+	r.appAuthTokenMutex.RUnlock()
+	if appAuthTokenRenewer == nil {
+		return errors.New("Control Hub rejected the app auth token and token renewal is not configured")
+	}
+	return appAuthTokenRenewer(rejectedToken)
+}
+
+// IsAppAuthTokenRejected returns true if the status code of a Control Hub response rejects the app auth token
+func IsAppAuthTokenRejected(statusCode int) bool {
+	return statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden
 }
 
 func (r *RuntimeInfo) init() error {
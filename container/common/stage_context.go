@@ -24,10 +24,27 @@ import (
 	"github.com/streamsets/datacollector-edge/container/util"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
-const StageConfig = "STAGE_CONFIG"
+const (
+	StageConfig               = "STAGE_CONFIG"
+	OnRecordErrorDiscard      = "DISCARD"
+	OnRecordErrorToError      = "TO_ERROR"
+	OnRecordErrorStopPipeline = "STOP_PIPELINE"
+)
+
+// StopPipelineError is returned by the runtime when a stage configured with the
+// STOP_PIPELINE on record error policy sends a record to error.
+type StopPipelineError struct {
+	StageInstanceName string
+	Err               error
+}
+
+func (e *StopPipelineError) Error() string {
+	return e.Err.Error()
+}
 
 type StageContextImpl struct {
 	StageConfig       *StageConfiguration
@@ -37,10 +54,12 @@ type StageContextImpl struct {
 	EventSink         *EventSink
 	ErrorStage        bool
 	ErrorRecordPolicy string
+	OnRecordError     string
 	Services          map[string]api.Service
 	ElContext         context.Context
 	previewMode       bool
-	stop              bool
+	stop              int32 // accessed atomically, stages poll it from their own goroutines
+	stopPipelineError *StopPipelineError
 }
 
 func (s *StageContextImpl) GetResolvedValue(configValue interface{}) (interface{}, error) {
@@ -134,8 +153,29 @@ func (s *StageContextImpl) CreateEventRecord(
 }
 
 func (s *StageContextImpl) ToError(err error, record api.Record) {
-	errorRecord := constructErrorRecord(s.StageConfig.InstanceName, err, s.ErrorRecordPolicy, record)
-	s.ErrorSink.ToError(s.StageConfig.InstanceName, errorRecord)
+	switch s.OnRecordError {
+	case OnRecordErrorDiscard:
+		s.ErrorSink.DiscardRecord(s.StageConfig.InstanceName)
+	case OnRecordErrorStopPipeline:
+		// Keep the first failure, the runner stops the pipeline once the stage returns
+		if s.stopPipelineError == nil {
+			s.stopPipelineError = &StopPipelineError{
+				StageInstanceName: s.StageConfig.InstanceName,
+				Err:               err,
+			}
+		}
+	default:
+		errorRecord := constructErrorRecord(s.StageConfig.InstanceName, err, s.ErrorRecordPolicy, record)
+		s.ErrorSink.ToError(s.StageConfig.InstanceName, errorRecord)
+	}
+}
+
+// GetStopPipelineError returns the record error that triggered the STOP_PIPELINE policy, if any
+func (s *StageContextImpl) GetStopPipelineError() error {
+	if s.stopPipelineError == nil {
+		return nil
+	}
+	return s.stopPipelineError
 }
 
 func (s *StageContextImpl) ToEvent(record api.Record) {
@@ -216,11 +256,11 @@ func (s *StageContextImpl) GetPipelineParameters() map[string]interface{} {
 }
 
 func (s *StageContextImpl) SetStop() {
-	s.stop = true
+	atomic.StoreInt32(&s.stop, 1)
 }
 
 func (s *StageContextImpl) IsStopped() bool {
-	return s.stop
+	return atomic.LoadInt32(&s.stop) == 1
 }
 
 func constructErrorRecord(instanceName string, err error, errorRecordPolicy string, record api.Record) api.Record {
@@ -266,6 +306,7 @@ func NewStageContext(
 	errorSink *ErrorSink,
 	errorStage bool,
 	errorRecordPolicy string,
+	onRecordError string,
 	services map[string]api.Service,
 	elContext context.Context,
 	eventSink *EventSink,
@@ -279,6 +320,7 @@ func NewStageContext(
 		EventSink:         eventSink,
 		ErrorStage:        errorStage,
 		ErrorRecordPolicy: errorRecordPolicy,
+		OnRecordError:     onRecordError,
 		Services:          services,
 		ElContext:         elContext,
 		previewMode:       isPreview,
@@ -0,0 +1,78 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package common
+
+import (
+	"errors"
+	"testing"
+)
+
+func getStageContextForOnRecordError(onRecordError string) *StageContextImpl {
+	return &StageContextImpl{
+		StageConfig:       &StageConfiguration{InstanceName: "stage1"},
+		ErrorSink:         NewErrorSink(),
+		ErrorRecordPolicy: ErrorRecordPolicyStage,
+		OnRecordError:     onRecordError,
+	}
+}
+
+func TestStageContextImpl_ToError_ToError(t *testing.T) {
+	stageContext := getStageContextForOnRecordError(OnRecordErrorToError)
+	record, _ := stageContext.CreateRecord("abc", "value")
+
+	stageContext.ToError(errors.New("sample error"), record)
+
+	if len(stageContext.ErrorSink.GetStageErrorRecords("stage1")) != 1 {
+		t.Error("Expected 1 error record in the error sink")
+	}
+	if stageContext.GetStopPipelineError() != nil {
+		t.Error("Expected no stop pipeline error")
+	}
+}
+
+func TestStageContextImpl_ToError_Discard(t *testing.T) {
+	stageContext := getStageContextForOnRecordError(OnRecordErrorDiscard)
+	record, _ := stageContext.CreateRecord("abc", "value")
+
+	stageContext.ToError(errors.New("sample error"), record)
+
+	if len(stageContext.ErrorSink.GetStageErrorRecords("stage1")) != 0 {
+		t.Error("Expected no error records in the error sink")
+	}
+	if stageContext.ErrorSink.GetStageDiscardedRecords("stage1") != 1 {
+		t.Error("Expected 1 discarded record, but got: ", stageContext.ErrorSink.GetStageDiscardedRecords("stage1"))
+	}
+}
+
+func TestStageContextImpl_ToError_StopPipeline(t *testing.T) {
+	stageContext := getStageContextForOnRecordError(OnRecordErrorStopPipeline)
+	record, _ := stageContext.CreateRecord("abc", "value")
+
+	stageContext.ToError(errors.New("first error"), record)
+	stageContext.ToError(errors.New("second error"), record)
+
+	if len(stageContext.ErrorSink.GetStageErrorRecords("stage1")) != 0 {
+		t.Error("Expected no error records in the error sink")
+	}
+
+	err := stageContext.GetStopPipelineError()
+	if err == nil {
+		t.Fatal("Expected stop pipeline error")
+	}
+	if err.Error() != "first error" {
+		t.Errorf("Expected error message 'first error', but got: %s", err.Error())
+	}
+	if stopPipelineError, ok := err.(*StopPipelineError); !ok || stopPipelineError.StageInstanceName != "stage1" {
+		t.Error("Expected StopPipelineError for stage 'stage1'")
+	}
+}
@@ -12,24 +12,37 @@
 // limitations under the License.
 package controlhub
 
+import (
+	"github.com/streamsets/datacollector-edge/container/controlhub/outbox"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
 const (
-	DefaultBaseUrl              = "http://localhost:18631"
-	AllLabel                    = "all"
-	JobRunnerApp                = "jobrunner-app"
-	TimeSeriesApp               = "timeseries-app"
-	DefaultPingFrequency        = 5000
-	DefaultStatusEventsInterval = 60000
+	DefaultBaseUrl                = "http://localhost:18631"
+	AllLabel                      = "all"
+	JobRunnerApp                  = "jobrunner-app"
+	TimeSeriesApp                 = "timeseries-app"
+	DefaultPingFrequency          = 5000
+	DefaultStatusEventsInterval   = 60000
+	DefaultTokenFileCheckInterval = 10000
 )
 
 type Config struct {
 	Enabled                bool     `toml:"enabled"`
 	BaseUrl                string   `toml:"base-url"`
 	AppAuthToken           string   `toml:"app-auth-token"`
+	AppAuthTokenFile       string   `toml:"app-auth-token-file"`
+	TokenFileCheckInterval int      `toml:"token-file-check-interval"`
+	User                   string   `toml:"user"`
+	Password               string   `toml:"password"`
 	JobLabels              []string `toml:"job-labels"`
 	EventsRecipient        string   `toml:"events-recipient"`
 	ProcessEventsRecipient []string `toml:"process-events-recipients"`
 	PingFrequency          int      `toml:"ping-frequency"`
 	StatusEventsInterval   int      `toml:"status-events-interval"`
+	OutboxMaxMessages      int      `toml:"outbox-max-messages"`
 }
 
 // NewConfig returns a new Config with default settings.
@@ -38,10 +51,42 @@ func NewConfig() Config {
 		Enabled:                false,
 		BaseUrl:                DefaultBaseUrl,
 		AppAuthToken:           "",
+		TokenFileCheckInterval: DefaultTokenFileCheckInterval,
 		JobLabels:              []string{AllLabel},
 		EventsRecipient:        JobRunnerApp,
 		ProcessEventsRecipient: []string{JobRunnerApp, TimeSeriesApp},
 		PingFrequency:          DefaultPingFrequency,
 		StatusEventsInterval:   DefaultStatusEventsInterval,
+		OutboxMaxMessages:      outbox.DefaultMaxMessages,
+	}
+}
+
+// ResolvePaths resolves the relative path of the app auth token file against the config directory
+func (c *Config) ResolvePaths(configDir string) {
+	if len(c.AppAuthTokenFile) > 0 && !filepath.IsAbs(c.AppAuthTokenFile) {
+		c.AppAuthTokenFile = filepath.Join(configDir, c.AppAuthTokenFile)
+	}
+}
+
+// ReadAppAuthTokenFile replaces the app auth token with the token in the app auth token file, if configured
+func (c *Config) ReadAppAuthTokenFile() error {
+	if len(c.AppAuthTokenFile) == 0 {
+		return nil
+	}
+	appAuthToken, err := readAppAuthTokenFile(c.AppAuthTokenFile)
+	if err != nil {
+		return err
+	}
+	if len(appAuthToken) > 0 {
+		c.AppAuthToken = appAuthToken
+	}
+	return nil
+}
+
+func readAppAuthTokenFile(appAuthTokenFile string) (string, error) {
+	content, err := ioutil.ReadFile(appAuthTokenFile)
+	if err != nil {
+		return "", err
 	}
+	return strings.TrimSpace(string(content)), nil
 }
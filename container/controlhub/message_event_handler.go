@@ -17,11 +17,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/rcrowley/go-metrics"
 	"github.com/satori/go.uuid"
 	"github.com/shirou/gopsutil/process"
 	log "github.com/sirupsen/logrus"
 	"github.com/streamsets/datacollector-edge/container/common"
+	"github.com/streamsets/datacollector-edge/container/controlhub/outbox"
+	"github.com/streamsets/datacollector-edge/container/execution"
 	"github.com/streamsets/datacollector-edge/container/execution/manager"
+	"github.com/streamsets/datacollector-edge/container/execution/preview"
 	"github.com/streamsets/datacollector-edge/container/store"
 	"github.com/streamsets/datacollector-edge/container/util"
 	"io"
@@ -29,11 +33,18 @@ import (
 	"net/url"
 	"os"
 	"runtime"
+	"strconv"
 	"time"
 )
 
 const (
-	MessagingUrlPath = "/messaging/rest/v1/events"
+	MessagingUrlPath    = "/messaging/rest/v1/events"
+	OutboxFolder        = "/data/controlhub/"
+	EventsOutboxFolder  = "events/"
+	MetricsOutboxFolder = "metrics/"
+	EventsOutboxName    = "controlhub.events"
+	// ValidationTimeout limits in milliseconds how long a validate pipeline event blocks the event handling
+	ValidationTimeout = 60000
 )
 
 type MessageEventHandler struct {
@@ -43,13 +54,13 @@ type MessageEventHandler struct {
 	manager                          manager.Manager
 	pipelineStoreTask                store.PipelineStoreTask
 	quitSendingEventToDPM            chan bool
-	ackEventList                     []*ClientEvent
+	outbox                           *outbox.Outbox
 	sendingPipelineStatusElapsedTime time.Time
 	httpClient                       *http.Client
 }
 
 func (m *MessageEventHandler) Init() {
-	if m.schConfig.Enabled && m.schConfig.AppAuthToken != "" {
+	if m.schConfig.Enabled && m.runtimeInfo.GetAppAuthToken() != "" {
 		ticker := time.NewTicker(time.Duration(m.schConfig.PingFrequency) * time.Millisecond)
 		m.quitSendingEventToDPM = make(chan bool)
 		go func() {
@@ -73,12 +84,10 @@ func (m *MessageEventHandler) Init() {
 	}
 }
 
+// SendEvent queues the info, status and process metrics events in the outbox and sends the pending events to
+// Control Hub. Every exchange returns the server events, which are handled and acknowledged with the next events.
 func (m *MessageEventHandler) SendEvent(sendInfoEvent bool) error {
 	clientEventList := make([]*ClientEvent, 0)
-	for _, ackEvent := range m.ackEventList {
-		clientEventList = append(clientEventList, ackEvent)
-	}
-
 	if sendInfoEvent {
 		clientEventList = append(clientEventList, m.createSdcEdgeInfoEvent())
 	}
@@ -173,7 +182,49 @@ func (m *MessageEventHandler) SendEvent(sendInfoEvent bool) error {
 		m.sendingPipelineStatusElapsedTime = time.Now()
 	}
 
-	jsonValue, err := json.Marshal(clientEventList)
+	for _, clientEvent := range clientEventList {
+		if err := m.queueEvent(clientEvent); err != nil {
+			return err
+		}
+	}
+
+	if m.outbox.IsRetryPending() {
+		return nil
+	}
+	if m.outbox.Len() == 0 {
+		// Nothing to send, the empty exchange still polls the server events
+		err := m.exchangeEvents(make([]json.RawMessage, 0))
+		if err != nil {
+			m.outbox.ReportFailure()
+		} else {
+			m.outbox.ReportSuccess()
+		}
+		return err
+	}
+	return m.outbox.Flush(func(_ string, payloads []json.RawMessage) error {
+		return m.exchangeEvents(payloads)
+	})
+}
+
+// queueEvent adds the event to the outbox. The status event covers all pipelines and the process metrics event
+// is a snapshot, so only the latest of each is kept while Control Hub is unreachable. Ack and other events are
+// all kept in order.
+func (m *MessageEventHandler) queueEvent(clientEvent *ClientEvent) error {
+	clientEventJson, err := json.Marshal(clientEvent)
+	if err != nil {
+		return err
+	}
+	var key string
+	switch clientEvent.EventTypeId {
+	case STATUS_MULTIPLE_PIPELINES, SDC_PROCESS_METRICS_EVENT:
+		key = strconv.Itoa(clientEvent.EventTypeId)
+	}
+	return m.outbox.Add(outbox.Message{Key: key, Payload: clientEventJson})
+}
+
+// exchangeEvents posts the client events to Control Hub, and handles the returned server events
+func (m *MessageEventHandler) exchangeEvents(clientEvents []json.RawMessage) error {
+	jsonValue, err := json.Marshal(clientEvents)
 	if err != nil {
 		log.WithError(err).Error()
 		return err
@@ -193,7 +244,8 @@ func (m *MessageEventHandler) SendEvent(sendInfoEvent bool) error {
 
 	var eventsUrl = baseUrl.ResolveReference(messagingUrl)
 	req, err := http.NewRequest("POST", eventsUrl.String(), bytes.NewBuffer(jsonValue))
-	req.Header.Set(common.HeaderXAppAuthToken, m.schConfig.AppAuthToken)
+	appAuthToken := m.runtimeInfo.GetAppAuthToken()
+	req.Header.Set(common.HeaderXAppAuthToken, appAuthToken)
 	req.Header.Set(common.HeaderXAppComponentId, m.runtimeInfo.ID)
 	req.Header.Set(common.HeaderXRestCall, "true")
 	req.Header.Set(common.HeaderContentType, common.ApplicationJson)
@@ -209,6 +261,13 @@ func (m *MessageEventHandler) SendEvent(sendInfoEvent bool) error {
 	}()
 
 	log.WithField("status", resp.Status).Debug("Control Hub Event Status")
+	if common.IsAppAuthTokenRejected(resp.StatusCode) {
+		// The events stay in the outbox and are sent again with the renewed token
+		if err := m.runtimeInfo.RenewAppAuthToken(appAuthToken); err != nil {
+			log.WithError(err).Error("Error while renewing the Control Hub app auth token")
+		}
+		return errors.New("Control Hub Send event failed - " + resp.Status)
+	}
 	if resp.StatusCode != 200 {
 		return errors.New("Control Hub Send event failed")
 	}
@@ -226,16 +285,15 @@ func (m *MessageEventHandler) SendEvent(sendInfoEvent bool) error {
 		}
 	}
 
-	ackClientEventList := make([]*ClientEvent, 0)
 	for _, serverEvent := range serverEventList {
 		ackEvent := m.handleDPMEvent(serverEvent)
 		if ackEvent != nil {
-			ackClientEventList = append(ackClientEventList, ackEvent)
+			if err := m.queueEvent(ackEvent); err != nil {
+				log.WithError(err).Error("Error queueing Control Hub ack event")
+			}
 		}
 	}
 
-	m.ackEventList = ackClientEventList
-
 	return nil
 }
 
@@ -312,6 +370,17 @@ func (m *MessageEventHandler) handleDPMEvent(serverEvent ServerEvent) *ClientEve
 			break
 		}
 
+		if pipelineRules := pipelineSaveEvent.PipelineConfigurationAndRules.PipelineRules; len(pipelineRules) > 0 {
+			var ruleDefinitions common.RuleDefinitions
+			if err := json.Unmarshal([]byte(pipelineRules), &ruleDefinitions); err != nil {
+				ackEventMessage = err.Error()
+				ackEventStatus = ACK_EVENT_ERROR
+				log.WithError(err).Error("Error during handling Control Hub SAVE Pipeline Event")
+				break
+			}
+			pipelineConfiguration.RuleDefinitions = &ruleDefinitions
+		}
+
 		newPipeline, err := m.pipelineStoreTask.Create(
 			pipelineSaveEvent.Name,
 			pipelineConfiguration.Title,
@@ -384,8 +453,52 @@ func (m *MessageEventHandler) handleDPMEvent(serverEvent ServerEvent) *ClientEve
 			break
 		}
 	case VALIDATE_PIPELINE:
+		var pipelineBaseEvent PipelineBaseEvent
+		if err := json.Unmarshal([]byte(serverEvent.Payload), &pipelineBaseEvent); err != nil {
+			ackEventMessage = err.Error()
+			ackEventStatus = ACK_EVENT_ERROR
+			log.WithError(err).Error("Error handling Control Hub Validate Pipeline Event")
+			break
+		}
+
+		previewOutput, err := m.manager.ValidatePipeline(pipelineBaseEvent.Name, ValidationTimeout)
+		if err != nil {
+			ackEventMessage = err.Error()
+			ackEventStatus = ACK_EVENT_ERROR
+			log.WithError(err).Error("Error handling Control Hub Validate Pipeline Event")
+			break
+		}
+		ackEventStatus, ackEventMessage = getValidationAck(previewOutput)
 	case RESET_OFFSET_PIPELINE:
+		var pipelineBaseEvent PipelineBaseEvent
+		if err := json.Unmarshal([]byte(serverEvent.Payload), &pipelineBaseEvent); err != nil {
+			ackEventMessage = err.Error()
+			ackEventStatus = ACK_EVENT_ERROR
+			log.WithError(err).Error("Error handling Control Hub Reset Offset Pipeline Event")
+			break
+		}
+
+		if err := m.manager.ResetOffset(pipelineBaseEvent.Name); err != nil {
+			ackEventMessage = err.Error()
+			ackEventStatus = ACK_EVENT_ERROR
+			log.WithError(err).Error("Error handling Control Hub Reset Offset Pipeline Event")
+			break
+		}
 	case DELETE_HISTORY_PIPELINE:
+		var pipelineBaseEvent PipelineBaseEvent
+		if err := json.Unmarshal([]byte(serverEvent.Payload), &pipelineBaseEvent); err != nil {
+			ackEventMessage = err.Error()
+			ackEventStatus = ACK_EVENT_ERROR
+			log.WithError(err).Error("Error handling Control Hub Delete History Pipeline Event")
+			break
+		}
+
+		if err := m.manager.DeleteHistory(pipelineBaseEvent.Name); err != nil {
+			ackEventMessage = err.Error()
+			ackEventStatus = ACK_EVENT_ERROR
+			log.WithError(err).Error("Error handling Control Hub Delete History Pipeline Event")
+			break
+		}
 	case DELETE_PIPELINE:
 		var pipelineBaseEvent PipelineBaseEvent
 		if err := json.Unmarshal([]byte(serverEvent.Payload), &pipelineBaseEvent); err != nil {
@@ -395,7 +508,7 @@ func (m *MessageEventHandler) handleDPMEvent(serverEvent ServerEvent) *ClientEve
 			break
 		}
 
-		err := m.pipelineStoreTask.Delete(pipelineBaseEvent.Name)
+		err := m.manager.DeletePipeline(pipelineBaseEvent.Name)
 		if err != nil {
 			ackEventMessage = err.Error()
 			ackEventStatus = ACK_EVENT_ERROR
@@ -419,7 +532,7 @@ func (m *MessageEventHandler) handleDPMEvent(serverEvent ServerEvent) *ClientEve
 			break
 		}
 
-		err = m.pipelineStoreTask.Delete(pipelineBaseEvent.Name)
+		err = m.manager.DeletePipeline(pipelineBaseEvent.Name)
 		if err != nil {
 			ackEventMessage = err.Error()
 			ackEventStatus = ACK_EVENT_ERROR
@@ -451,6 +564,26 @@ func (m *MessageEventHandler) handleDPMEvent(serverEvent ServerEvent) *ClientEve
 	return ackClientEvent
 }
 
+// getValidationAck returns the ack status and message of a validation, invalid pipelines are acknowledged with
+// an error and the issues as message
+func getValidationAck(previewOutput execution.PreviewOutput) (string, string) {
+	switch previewOutput.PreviewStatus {
+	case preview.Valid:
+		return ACK_EVENT_SUCCESS, ""
+	case preview.InValid, preview.ValidationError:
+		if previewOutput.Issues != nil && previewOutput.Issues.IssueCount > 0 {
+			issuesJson, err := json.Marshal(previewOutput.Issues)
+			if err != nil {
+				return ACK_EVENT_ERROR, err.Error()
+			}
+			return ACK_EVENT_ERROR, string(issuesJson)
+		}
+		return ACK_EVENT_ERROR, previewOutput.Message
+	default:
+		return ACK_EVENT_ERROR, fmt.Sprintf("Validation ended with status %s", previewOutput.PreviewStatus)
+	}
+}
+
 func (m *MessageEventHandler) Shutdown() {
 	m.quitSendingEventToDPM <- true
 }
@@ -461,14 +594,25 @@ func NewMessageEventHandler(
 	runtimeInfo *common.RuntimeInfo,
 	pipelineStoreTask store.PipelineStoreTask,
 	manager manager.Manager,
-) *MessageEventHandler {
+	metricRegistry metrics.Registry,
+) (*MessageEventHandler, error) {
+	eventsOutbox, err := outbox.NewOutbox(
+		EventsOutboxName,
+		runtimeInfo.BaseDir+OutboxFolder+EventsOutboxFolder,
+		schConfig.OutboxMaxMessages,
+		metricRegistry,
+	)
+	if err != nil {
+		return nil, err
+	}
 	messagingEventHandler := &MessageEventHandler{
 		schConfig:         schConfig,
 		buildInfo:         buildInfo,
 		runtimeInfo:       runtimeInfo,
 		manager:           manager,
 		pipelineStoreTask: pipelineStoreTask,
+		outbox:            eventsOutbox,
 		httpClient:        &http.Client{},
 	}
-	return messagingEventHandler
+	return messagingEventHandler, nil
 }
@@ -0,0 +1,109 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package controlhub
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/streamsets/datacollector-edge/api/validation"
+	"github.com/streamsets/datacollector-edge/container/execution"
+	"github.com/streamsets/datacollector-edge/container/execution/manager"
+	"github.com/streamsets/datacollector-edge/container/execution/preview"
+	"testing"
+)
+
+// testManager records the pipelines of the manager calls, all other methods are not implemented
+type testManager struct {
+	manager.Manager
+	previewOutput      execution.PreviewOutput
+	err                error
+	resetOffsetCalls   []string
+	deleteHistoryCalls []string
+}
+
+func (m *testManager) ValidatePipeline(pipelineId string, timeoutMillis int64) (execution.PreviewOutput, error) {
+	return m.previewOutput, m.err
+}
+
+func (m *testManager) ResetOffset(pipelineId string) error {
+	m.resetOffsetCalls = append(m.resetOffsetCalls, pipelineId)
+	return m.err
+}
+
+func (m *testManager) DeleteHistory(pipelineId string) error {
+	m.deleteHistoryCalls = append(m.deleteHistoryCalls, pipelineId)
+	return m.err
+}
+
+func handleTestEvent(t *testing.T, testManager *testManager, eventTypeId int) AckEvent {
+	handler := &MessageEventHandler{schConfig: NewConfig(), manager: testManager}
+	payload, _ := json.Marshal(PipelineBaseEvent{Name: "pipeline1", Rev: "0", User: "admin"})
+	ackClientEvent := handler.handleDPMEvent(ServerEvent{
+		EventId:     "event1",
+		RequiresAck: true,
+		EventTypeId: eventTypeId,
+		Payload:     string(payload),
+	})
+	if ackClientEvent == nil || !ackClientEvent.IsAckEvent || ackClientEvent.EventId != "event1" {
+		t.Fatalf("Expected an ack event, but got: %+v", ackClientEvent)
+	}
+	var ackEvent AckEvent
+	if err := json.Unmarshal([]byte(ackClientEvent.Payload), &ackEvent); err != nil {
+		t.Fatal(err)
+	}
+	return ackEvent
+}
+
+func TestMessageEventHandler_ValidatePipeline(t *testing.T) {
+	testManager := &testManager{previewOutput: execution.PreviewOutput{PreviewStatus: preview.Valid}}
+	if ackEvent := handleTestEvent(t, testManager, VALIDATE_PIPELINE); ackEvent.AckEventStatus != ACK_EVENT_SUCCESS {
+		t.Errorf("Expected %s ack for a valid pipeline, but got: %+v", ACK_EVENT_SUCCESS, ackEvent)
+	}
+
+	testManager.previewOutput = execution.PreviewOutput{
+		PreviewStatus: preview.InValid,
+		Issues:        validation.NewIssues([]validation.Issue{{InstanceName: "stage1", Message: "invalid config"}}),
+	}
+	ackEvent := handleTestEvent(t, testManager, VALIDATE_PIPELINE)
+	var issues validation.Issues
+	if ackEvent.AckEventStatus != ACK_EVENT_ERROR || json.Unmarshal([]byte(ackEvent.Message), &issues) != nil ||
+		issues.IssueCount != 1 {
+		t.Errorf("Expected %s ack with the issues for an invalid pipeline, but got: %+v", ACK_EVENT_ERROR, ackEvent)
+	}
+
+	testManager.previewOutput = execution.PreviewOutput{PreviewStatus: preview.TimedOut}
+	if ackEvent := handleTestEvent(t, testManager, VALIDATE_PIPELINE); ackEvent.AckEventStatus != ACK_EVENT_ERROR {
+		t.Errorf("Expected %s ack for a timed out validation, but got: %+v", ACK_EVENT_ERROR, ackEvent)
+	}
+}
+
+func TestMessageEventHandler_ResetOffsetAndDeleteHistory(t *testing.T) {
+	testManager := &testManager{}
+	for _, eventTypeId := range []int{RESET_OFFSET_PIPELINE, DELETE_HISTORY_PIPELINE} {
+		if ackEvent := handleTestEvent(t, testManager, eventTypeId); ackEvent.AckEventStatus != ACK_EVENT_SUCCESS {
+			t.Errorf("Expected %s ack for event %d, but got: %+v", ACK_EVENT_SUCCESS, eventTypeId, ackEvent)
+		}
+	}
+	if len(testManager.resetOffsetCalls) != 1 || len(testManager.deleteHistoryCalls) != 1 {
+		t.Errorf("Expected one reset offset and one delete history, but got: %v %v",
+			testManager.resetOffsetCalls, testManager.deleteHistoryCalls)
+	}
+
+	testManager.err = errors.New("pipeline is running")
+	for _, eventTypeId := range []int{RESET_OFFSET_PIPELINE, DELETE_HISTORY_PIPELINE} {
+		ackEvent := handleTestEvent(t, testManager, eventTypeId)
+		if ackEvent.AckEventStatus != ACK_EVENT_ERROR || ackEvent.Message != testManager.err.Error() {
+			t.Errorf("Expected %s ack for event %d, but got: %+v", ACK_EVENT_ERROR, eventTypeId, ackEvent)
+		}
+	}
+}
@@ -0,0 +1,384 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rcrowley/go-metrics"
+	log "github.com/sirupsen/logrus"
+	"github.com/streamsets/datacollector-edge/container/util"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMaxMessages = 10000
+	MaxBatchMessages   = 100
+	RetryBaseDelay     = 5 * time.Second
+	RetryMaxDelay      = 5 * time.Minute
+	PendingMessages    = ".pendingMessages"
+	DroppedMessages    = ".droppedMessages"
+	SentMessages       = ".sentMessages"
+	SendFailures       = ".sendFailures"
+	LastSuccessTime    = ".lastSuccessTime"
+	Connected          = ".connected"
+	messageFileSuffix  = ".json"
+	messageFileFormat  = "%020d" + messageFileSuffix
+)
+
+// ErrRetryPending is returned by Flush while the outbox waits before retrying a failed send
+var ErrRetryPending = errors.New("waiting to retry sending to Control Hub")
+
+// Message is a queued message, consecutive messages with the same target are sent together. A message with a
+// key replaces the pending message with the same key, messages without a key are all kept in order.
+type Message struct {
+	Target  string          `json:"target"`
+	Key     string          `json:"key,omitempty"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Sender sends messages of the same target, the messages are removed from the outbox once it returns no error
+type Sender func(target string, payloads []json.RawMessage) error
+
+// Outbox is a bounded disk backed FIFO queue of messages for Control Hub. Messages are kept while Control Hub
+// is unreachable and sent in order once it is reachable again, failed sends are retried with exponential
+// backoff. When the maximum number of messages is reached the oldest messages are dropped.
+type Outbox struct {
+	name                 string
+	dir                  string
+	maxMessages          int
+	mutex                sync.Mutex
+	flushMutex           sync.Mutex
+	sequences            []int64
+	keys                 map[string]int64
+	nextSequence         int64
+	failures             int
+	retryTime            time.Time
+	dropping             bool
+	notify               chan struct{}
+	pendingGauge         metrics.Gauge
+	droppedCounter       metrics.Counter
+	sentCounter          metrics.Counter
+	failuresGauge        metrics.Gauge
+	lastSuccessTimeGauge metrics.Gauge
+	connectedGauge       metrics.Gauge
+}
+
+// Add durably stores the message, replacing the pending message with the same key and dropping the oldest
+// message if the outbox is full
+func (o *Outbox) Add(message Message) error {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	replacedSequence, replacing := o.keys[message.Key]
+	replacing = replacing && message.Key != ""
+	for len(o.sequences) >= o.maxMessages && !replacing {
+		if !o.dropping {
+			log.WithField("outbox", o.name).Warn("Control Hub outbox is full, dropping the oldest messages")
+			o.dropping = true
+		}
+		o.removeOldest(1)
+		o.droppedCounter.Inc(1)
+	}
+
+	sequence := o.nextSequence
+	if err := util.WriteFileAtomic(o.getMessageFile(sequence), data, 0644); err != nil {
+		return err
+	}
+	if replacing {
+		o.remove(replacedSequence)
+	}
+	o.sequences = append(o.sequences, sequence)
+	if message.Key != "" {
+		o.keys[message.Key] = sequence
+	}
+	o.nextSequence++
+	o.pendingGauge.Update(int64(len(o.sequences)))
+
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Len returns the number of pending messages
+func (o *Outbox) Len() int {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return len(o.sequences)
+}
+
+// IsRetryPending returns true while the backoff delay of the last failure has not passed
+func (o *Outbox) IsRetryPending() bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return time.Now().Before(o.retryTime)
+}
+
+// Flush sends the pending messages in order until the outbox is empty or a send fails. It returns
+// ErrRetryPending without sending while the backoff delay of the last failure has not passed.
+func (o *Outbox) Flush(send Sender) error {
+	o.flushMutex.Lock()
+	defer o.flushMutex.Unlock()
+	for {
+		o.mutex.Lock()
+		if time.Now().Before(o.retryTime) {
+			o.mutex.Unlock()
+			return ErrRetryPending
+		}
+		target, payloads, sequences := o.peek()
+		o.mutex.Unlock()
+		if len(sequences) == 0 {
+			return nil
+		}
+
+		if err := send(target, payloads); err != nil {
+			o.ReportFailure()
+			return err
+		}
+
+		o.mutex.Lock()
+		// Sent messages might have been dropped meanwhile, only the ones still queued are removed
+		for len(o.sequences) > 0 && o.sequences[0] <= sequences[len(sequences)-1] {
+			o.removeOldest(1)
+		}
+		o.mutex.Unlock()
+		o.sentCounter.Inc(int64(len(sequences)))
+		o.ReportSuccess()
+	}
+}
+
+// ReportSuccess records a successful exchange with Control Hub and ends the backoff
+func (o *Outbox) ReportSuccess() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if o.failures > 0 {
+		log.WithField("outbox", o.name).Info("Control Hub is reachable again")
+	}
+	o.failures = 0
+	o.retryTime = time.Time{}
+	o.dropping = false
+	o.failuresGauge.Update(0)
+	o.connectedGauge.Update(1)
+	o.lastSuccessTimeGauge.Update(util.ConvertTimeToLong(time.Now()))
+}
+
+// ReportFailure records a failed exchange with Control Hub and delays the next send exponentially
+func (o *Outbox) ReportFailure() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.failures++
+	retryDelay := getRetryDelay(o.failures)
+	o.retryTime = time.Now().Add(retryDelay)
+	o.failuresGauge.Update(int64(o.failures))
+	o.connectedGauge.Update(0)
+	log.WithFields(log.Fields{
+		"outbox":          o.name,
+		"failures":        o.failures,
+		"pendingMessages": len(o.sequences),
+		"retryDelay":      retryDelay,
+	}).Warn("Failed to send to Control Hub, messages are kept in the outbox")
+}
+
+// Run flushes the outbox whenever messages are added or the backoff delay passed, until stop is closed
+func (o *Outbox) Run(send Sender, stop <-chan struct{}) {
+	for {
+		var retry <-chan time.Time
+		if err := o.Flush(send); err != nil {
+			o.mutex.Lock()
+			retryDelay := time.Until(o.retryTime)
+			o.mutex.Unlock()
+			retry = time.After(retryDelay)
+		}
+		select {
+		case <-o.notify:
+		case <-retry:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// peek returns the oldest messages with the same target, up to MaxBatchMessages
+func (o *Outbox) peek() (string, []json.RawMessage, []int64) {
+	var target string
+	payloads := make([]json.RawMessage, 0)
+	sequences := make([]int64, 0)
+	for _, sequence := range o.sequences {
+		if len(sequences) == MaxBatchMessages {
+			break
+		}
+		var message Message
+		err := util.ReadFileWithBackup(o.getMessageFile(sequence), func(data []byte) error {
+			return json.Unmarshal(data, &message)
+		})
+		if err != nil {
+			if len(sequences) > 0 {
+				break
+			}
+			// A message which can not be read is never sent, it is dropped to not block the outbox
+			log.WithError(err).WithField("outbox", o.name).Error("Dropping unreadable Control Hub message")
+			o.removeOldest(1)
+			o.droppedCounter.Inc(1)
+			return o.peek()
+		}
+		if len(sequences) > 0 && message.Target != target {
+			break
+		}
+		target = message.Target
+		payloads = append(payloads, message.Payload)
+		sequences = append(sequences, sequence)
+	}
+	return target, payloads, sequences
+}
+
+func (o *Outbox) removeOldest(count int) {
+	for _, sequence := range o.sequences[:count] {
+		o.removeMessage(sequence)
+	}
+	o.sequences = o.sequences[count:]
+	o.pendingGauge.Update(int64(len(o.sequences)))
+}
+
+// remove removes a pending message which is not necessarily the oldest one
+func (o *Outbox) remove(sequence int64) {
+	for i, pendingSequence := range o.sequences {
+		if pendingSequence == sequence {
+			o.removeMessage(sequence)
+			o.sequences = append(o.sequences[:i:i], o.sequences[i+1:]...)
+			o.pendingGauge.Update(int64(len(o.sequences)))
+			return
+		}
+	}
+}
+
+func (o *Outbox) removeMessage(sequence int64) {
+	messageFile := o.getMessageFile(sequence)
+	if err := os.Remove(messageFile); err != nil && !os.IsNotExist(err) {
+		log.WithError(err).WithField("file", messageFile).Error("Failed to remove Control Hub message")
+	}
+	_ = os.Remove(messageFile + util.BackupFileSuffix)
+	for key, keySequence := range o.keys {
+		if keySequence == sequence {
+			delete(o.keys, key)
+		}
+	}
+}
+
+// recover rebuilds the outbox from the message files left by a previous run
+func (o *Outbox) recover() error {
+	files, err := ioutil.ReadDir(o.dir)
+	if err != nil {
+		return err
+	}
+
+	// Files are sorted by name, and names are the zero padded sequence numbers
+	for _, file := range files {
+		filePath := filepath.Join(o.dir, file.Name())
+		if strings.HasSuffix(file.Name(), util.TempFileSuffix) {
+			// Message was not completely written before the crash
+			if err := os.Remove(filePath); err != nil {
+				return err
+			}
+			continue
+		}
+		if !strings.HasSuffix(file.Name(), messageFileSuffix) {
+			continue
+		}
+		sequence, err := strconv.ParseInt(strings.TrimSuffix(file.Name(), messageFileSuffix), 10, 64)
+		if err != nil {
+			log.WithError(err).WithField("file", filePath).Warn("Ignoring unknown file in outbox directory")
+			continue
+		}
+		o.sequences = append(o.sequences, sequence)
+		o.nextSequence = sequence + 1
+		o.recoverKey(sequence)
+	}
+
+	if len(o.sequences) > 0 {
+		log.WithFields(log.Fields{
+			"outbox":   o.name,
+			"messages": len(o.sequences),
+		}).Info("Recovered pending Control Hub messages")
+	}
+	o.pendingGauge.Update(int64(len(o.sequences)))
+	return nil
+}
+
+// recoverKey restores the key of a recovered message, an older message with the same key left by a crash
+// while it was replaced is removed
+func (o *Outbox) recoverKey(sequence int64) {
+	var message Message
+	err := util.ReadFileWithBackup(o.getMessageFile(sequence), func(data []byte) error {
+		return json.Unmarshal(data, &message)
+	})
+	if err != nil || message.Key == "" {
+		// Unreadable messages are dropped when they are sent
+		return
+	}
+	if replacedSequence, ok := o.keys[message.Key]; ok {
+		o.remove(replacedSequence)
+	}
+	o.keys[message.Key] = sequence
+}
+
+func (o *Outbox) getMessageFile(sequence int64) string {
+	return filepath.Join(o.dir, fmt.Sprintf(messageFileFormat, sequence))
+}
+
+// getRetryDelay doubles the delay for every failure, starting at RetryBaseDelay and capped at RetryMaxDelay
+func getRetryDelay(failures int) time.Duration {
+	retryDelay := float64(RetryBaseDelay) * math.Pow(2, float64(failures-1))
+	if retryDelay > float64(RetryMaxDelay) {
+		return RetryMaxDelay
+	}
+	return time.Duration(retryDelay)
+}
+
+// NewOutbox opens the outbox stored in the directory, its health metrics are registered with the name as prefix
+func NewOutbox(name string, dir string, maxMessages int, metricRegistry metrics.Registry) (*Outbox, error) {
+	if maxMessages <= 0 {
+		maxMessages = DefaultMaxMessages
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	outbox := &Outbox{
+		name:                 name,
+		dir:                  dir,
+		maxMessages:          maxMessages,
+		sequences:            make([]int64, 0),
+		keys:                 make(map[string]int64),
+		notify:               make(chan struct{}, 1),
+		pendingGauge:         util.CreateGauge(metricRegistry, name+PendingMessages),
+		droppedCounter:       util.CreateCounter(metricRegistry, name+DroppedMessages),
+		sentCounter:          util.CreateCounter(metricRegistry, name+SentMessages),
+		failuresGauge:        util.CreateGauge(metricRegistry, name+SendFailures),
+		lastSuccessTimeGauge: util.CreateGauge(metricRegistry, name+LastSuccessTime),
+		connectedGauge:       util.CreateGauge(metricRegistry, name+Connected),
+	}
+	return outbox, outbox.recover()
+}
@@ -0,0 +1,186 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/rcrowley/go-metrics"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testSender struct {
+	targets  []string
+	payloads []string
+	err      error
+}
+
+func (s *testSender) send(target string, payloads []json.RawMessage) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.targets = append(s.targets, target)
+	for _, payload := range payloads {
+		s.payloads = append(s.payloads, string(payload))
+	}
+	return nil
+}
+
+func addTestMessages(t *testing.T, outbox *Outbox, target string, payloads ...string) {
+	for _, payload := range payloads {
+		if err := outbox.Add(Message{Target: target, Payload: json.RawMessage(payload)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestOutbox_FlushInOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	metricRegistry := metrics.NewRegistry()
+	outbox, err := NewOutbox("test", dir, 3, metricRegistry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addTestMessages(t, outbox, "url1", "1", "2")
+	addTestMessages(t, outbox, "url2", "3", "4")
+
+	if outbox.Len() != 3 {
+		t.Fatalf("Expected 3 messages, but got: %d", outbox.Len())
+	}
+	if dropped := metricRegistry.Get("test" + DroppedMessages + ".counter").(metrics.Counter).Count(); dropped != 1 {
+		t.Errorf("Expected 1 dropped message, but got: %d", dropped)
+	}
+
+	// Control Hub is unreachable, the messages are kept and sending is delayed
+	sender := &testSender{err: errors.New("connection refused")}
+	if err := outbox.Flush(sender.send); err != sender.err {
+		t.Errorf("Expected the send error, but got: %v", err)
+	}
+	if err := outbox.Flush(sender.send); err != ErrRetryPending {
+		t.Errorf("Expected %v, but got: %v", ErrRetryPending, err)
+	}
+	if connected := metricRegistry.Get("test" + Connected + ".gauge").(metrics.Gauge).Value(); connected != 0 {
+		t.Errorf("Expected to be disconnected, but got: %d", connected)
+	}
+
+	// The outbox is recovered after a restart
+	outbox, err = NewOutbox("test", dir, 3, metricRegistry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addTestMessages(t, outbox, "url1", "5")
+	sender.err = nil
+	if err := outbox.Flush(sender.send); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sender.targets, []string{"url2", "url1"}) {
+		t.Errorf("Expected messages sent grouped by target, but got: %v", sender.targets)
+	}
+	if !reflect.DeepEqual(sender.payloads, []string{"3", "4", "5"}) {
+		t.Errorf("Expected the newest messages sent in order, but got: %v", sender.payloads)
+	}
+	if outbox.Len() != 0 {
+		t.Errorf("Expected an empty outbox, but got: %d messages", outbox.Len())
+	}
+	if connected := metricRegistry.Get("test" + Connected + ".gauge").(metrics.Gauge).Value(); connected != 1 {
+		t.Errorf("Expected to be connected, but got: %d", connected)
+	}
+}
+
+func TestOutbox_ReplaceMessagesWithSameKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	outbox, err := NewOutbox("test", dir, 10, metrics.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	messages := []Message{
+		{Key: "status", Payload: json.RawMessage("1")},
+		{Payload: json.RawMessage("2")},
+		{Key: "metrics", Payload: json.RawMessage("3")},
+		{Key: "status", Payload: json.RawMessage("4")},
+		{Payload: json.RawMessage("5")},
+	}
+	for _, message := range messages {
+		if err := outbox.Add(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The replaced messages are not recovered after a restart, and keys are replaced in the recovered outbox
+	outbox, err = NewOutbox("test", dir, 10, metrics.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := outbox.Add(Message{Key: "metrics", Payload: json.RawMessage("6")}); err != nil {
+		t.Fatal(err)
+	}
+	sender := &testSender{}
+	if err := outbox.Flush(sender.send); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(sender.payloads, []string{"2", "4", "5", "6"}) {
+		t.Errorf("Expected only the latest message of each key, but got: %v", sender.payloads)
+	}
+}
+
+func TestOutbox_Run(t *testing.T) {
+	dir, err := ioutil.TempDir("", "outbox_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	outbox, err := NewOutbox("test", dir, 10, metrics.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := make(chan json.RawMessage, 10)
+	stop := make(chan struct{})
+	defer close(stop)
+	go outbox.Run(func(target string, payloads []json.RawMessage) error {
+		for _, payload := range payloads {
+			sent <- payload
+		}
+		return nil
+	}, stop)
+
+	addTestMessages(t, outbox, "url1", "1")
+	select {
+	case payload := <-sent:
+		if string(payload) != "1" {
+			t.Errorf("Expected message 1, but got: %s", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Message was not sent")
+	}
+}
+
+func TestGetRetryDelay(t *testing.T) {
+	if getRetryDelay(1) != RetryBaseDelay || getRetryDelay(2) != 2*RetryBaseDelay || getRetryDelay(20) != RetryMaxDelay {
+		t.Error("Expected exponential retry delays capped at the maximum delay")
+	}
+}
@@ -59,49 +59,65 @@ func RegisterWithControlHub(
 	runtimeInfo *common.RuntimeInfo,
 ) {
 	if schConfig.Enabled && schConfig.AppAuthToken != "" {
-		attributes := Attributes{
-			BaseHttpUrl:     runtimeInfo.HttpUrl,
-			Sdc2GoGoVersion: runtime.Version(),
-			Sdc2GoGoOS:      runtime.GOOS,
-			Sdc2GoGoArch:    runtime.GOARCH,
-			Sdc2GoBuildDate: buildInfo.BuiltDate,
-			Sdc2GoRepoSha:   buildInfo.BuiltRepoSha,
-			Sdc2GoVersion:   buildInfo.Version,
+		if err := registerComponent(schConfig.BaseUrl, schConfig.AppAuthToken, buildInfo, runtimeInfo); err != nil {
+			log.Panic(err)
 		}
+		runtimeInfo.DPMEnabled = true
+		runtimeInfo.SetAppAuthToken(schConfig.AppAuthToken)
+	} else {
+		runtimeInfo.DPMEnabled = false
+	}
+}
 
-		registrationData := RegistrationData{
-			AuthToken:   schConfig.AppAuthToken,
-			ComponentId: runtimeInfo.ID,
-			Attributes:  attributes,
-		}
+// registerComponent registers the edge with the app auth token as a Control Hub component
+func registerComponent(
+	controlHubUrl string,
+	appAuthToken string,
+	buildInfo *common.BuildInfo,
+	runtimeInfo *common.RuntimeInfo,
+) error {
+	attributes := Attributes{
+		BaseHttpUrl:     runtimeInfo.HttpUrl,
+		Sdc2GoGoVersion: runtime.Version(),
+		Sdc2GoGoOS:      runtime.GOOS,
+		Sdc2GoGoArch:    runtime.GOARCH,
+		Sdc2GoBuildDate: buildInfo.BuiltDate,
+		Sdc2GoRepoSha:   buildInfo.BuiltRepoSha,
+		Sdc2GoVersion:   buildInfo.Version,
+	}
 
-		jsonValue, err := json.Marshal(registrationData)
-		if err != nil {
-			log.Println(err)
-		}
+	registrationData := RegistrationData{
+		AuthToken:   appAuthToken,
+		ComponentId: runtimeInfo.ID,
+		Attributes:  attributes,
+	}
 
-		var registrationUrl = schConfig.BaseUrl + RegistrationUrlPath
+	jsonValue, err := json.Marshal(registrationData)
+	if err != nil {
+		return err
+	}
 
-		req, err := http.NewRequest(PostRequest, registrationUrl, bytes.NewBuffer(jsonValue))
-		req.Header.Set(common.HeaderXRestCall, EdgeComponentType)
-		req.Header.Set(common.HeaderContentType, common.ApplicationJson)
+	var registrationUrl = controlHubUrl + RegistrationUrlPath
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			panic(err)
-		}
-		defer resp.Body.Close()
+	req, err := http.NewRequest(PostRequest, registrationUrl, bytes.NewBuffer(jsonValue))
+	if err != nil {
+		return err
+	}
+	req.Header.Set(common.HeaderXRestCall, EdgeComponentType)
+	req.Header.Set(common.HeaderContentType, common.ApplicationJson)
 
-		log.WithField("status", resp.Status).Info("Control Hub Registration Status")
-		if resp.StatusCode != 200 {
-			log.Panic("Control Hub Registration failed")
-		}
-		runtimeInfo.DPMEnabled = true
-		runtimeInfo.AppAuthToken = schConfig.AppAuthToken
-	} else {
-		runtimeInfo.DPMEnabled = false
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	log.WithField("status", resp.Status).Info("Control Hub Registration Status")
+	if resp.StatusCode != 200 {
+		return errors.New("Control Hub Registration failed - " + resp.Status)
 	}
+	return nil
 }
 
 func EnableControlHub(
@@ -123,7 +139,10 @@ func EnableControlHub(
 		}
 	}
 
-	orgId := getControlHubOrgId(controlHubUser)
+	orgId, err := getControlHubOrgId(controlHubUser)
+	if err != nil {
+		return "", err
+	}
 	newComponentJson := map[string]interface{}{
 		"organization":       orgId,
 		"componentType":      EdgeComponentType,
@@ -179,12 +198,12 @@ func EnableControlHub(
 	return cast.ToString(fullAuthToken), err
 }
 
-func getControlHubOrgId(controlHubUser string) string {
+func getControlHubOrgId(controlHubUser string) (string, error) {
 	strArr := strings.Split(controlHubUser, "@")
 	if len(strArr) < 2 {
-		panic("Invalid Control Hub User Id")
+		return "", errors.New("invalid Control Hub User Id")
 	}
-	return strArr[1]
+	return strArr[1], nil
 }
 
 func retrieveUserToken(
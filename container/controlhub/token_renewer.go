@@ -0,0 +1,159 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package controlhub
+
+import (
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// MinTokenCreationInterval limits how often a new app auth token is created with the stored credentials
+	MinTokenCreationInterval = time.Minute
+)
+
+// TokenRenewer renews the Control Hub app auth token once Control Hub rejects it because it was rotated or
+// revoked. The new token is read from the app auth token file, or created with the stored Control Hub user
+// and password like -enableControlHub does. The edge is registered again with the new token, which is then
+// persisted. Run watches the app auth token file, so a rotated token is applied before it is rejected.
+type TokenRenewer struct {
+	schConfig        Config
+	buildInfo        *common.BuildInfo
+	runtimeInfo      *common.RuntimeInfo
+	persistToken     func(appAuthToken string) error
+	mutex            sync.Mutex
+	rejectedTokens   map[string]bool
+	lastCreation     time.Time
+	tokenFileModTime time.Time
+}
+
+// RenewAppAuthToken renews the rejected app auth token, unless it was already renewed since it was rejected
+func (r *TokenRenewer) RenewAppAuthToken(rejectedToken string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.runtimeInfo.GetAppAuthToken() != rejectedToken {
+		return nil
+	}
+	log.Warn("Control Hub rejected the app auth token, renewing it")
+	// A token is never applied again once it was rejected, even if it is still in the token file
+	r.rejectedTokens[rejectedToken] = true
+
+	if len(r.schConfig.AppAuthTokenFile) > 0 {
+		appAuthToken, err := readAppAuthTokenFile(r.schConfig.AppAuthTokenFile)
+		if err != nil {
+			log.WithError(err).Error("Error while reading the Control Hub app auth token file")
+		} else if len(appAuthToken) > 0 && !r.rejectedTokens[appAuthToken] {
+			return r.applyAppAuthToken(appAuthToken)
+		}
+	}
+
+	if len(r.schConfig.User) == 0 || len(r.schConfig.Password) == 0 {
+		return errors.New("no new app auth token in the app auth token file and no Control Hub user and " +
+			"password configured to create one")
+	}
+	if !r.lastCreation.IsZero() && time.Since(r.lastCreation) < MinTokenCreationInterval {
+		return errors.New("an app auth token was created less than a minute ago, not creating another one")
+	}
+	r.lastCreation = time.Now()
+	appAuthToken, err := EnableControlHub(r.schConfig.BaseUrl, r.schConfig.User, r.schConfig.Password, "")
+	if err != nil {
+		return err
+	}
+	return r.applyAppAuthToken(appAuthToken)
+}
+
+// Run checks the app auth token file every token file check interval until the stop channel is closed
+func (r *TokenRenewer) Run(stop <-chan struct{}) {
+	if len(r.schConfig.AppAuthTokenFile) == 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(r.schConfig.TokenFileCheckInterval) * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.checkAppAuthTokenFile(); err != nil {
+				log.WithError(err).Error("Error while applying the Control Hub app auth token file")
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// checkAppAuthTokenFile applies the token of the app auth token file if the file changed
+func (r *TokenRenewer) checkAppAuthTokenFile() error {
+	fileInfo, err := os.Stat(r.schConfig.AppAuthTokenFile)
+	if err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if fileInfo.ModTime().Equal(r.tokenFileModTime) {
+		return nil
+	}
+	r.tokenFileModTime = fileInfo.ModTime()
+
+	appAuthToken, err := readAppAuthTokenFile(r.schConfig.AppAuthTokenFile)
+	if err != nil {
+		return err
+	}
+	if len(appAuthToken) == 0 || appAuthToken == r.runtimeInfo.GetAppAuthToken() || r.rejectedTokens[appAuthToken] {
+		return nil
+	}
+	log.Info("Control Hub app auth token file changed, applying the new token")
+	return r.applyAppAuthToken(appAuthToken)
+}
+
+// applyAppAuthToken registers the edge with the new token, uses it to send events and metrics and persists it
+func (r *TokenRenewer) applyAppAuthToken(appAuthToken string) error {
+	if err := registerComponent(r.schConfig.BaseUrl, appAuthToken, r.buildInfo, r.runtimeInfo); err != nil {
+		return err
+	}
+	r.runtimeInfo.SetAppAuthToken(appAuthToken)
+	log.Info("Control Hub app auth token renewed")
+
+	if r.persistToken != nil {
+		if err := r.persistToken(appAuthToken); err != nil {
+			log.WithError(err).Error("Error while persisting the Control Hub app auth token")
+		}
+	}
+	return nil
+}
+
+// NewTokenRenewer returns a token renewer, which calls persistToken with every renewed app auth token
+func NewTokenRenewer(
+	schConfig Config,
+	buildInfo *common.BuildInfo,
+	runtimeInfo *common.RuntimeInfo,
+	persistToken func(appAuthToken string) error,
+) *TokenRenewer {
+	tokenRenewer := &TokenRenewer{
+		schConfig:      schConfig,
+		buildInfo:      buildInfo,
+		runtimeInfo:    runtimeInfo,
+		persistToken:   persistToken,
+		rejectedTokens: make(map[string]bool),
+	}
+	if len(schConfig.AppAuthTokenFile) > 0 {
+		if fileInfo, err := os.Stat(schConfig.AppAuthTokenFile); err == nil {
+			tokenRenewer.tokenFileModTime = fileInfo.ModTime()
+		}
+	}
+	return tokenRenewer
+}
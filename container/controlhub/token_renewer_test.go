@@ -0,0 +1,179 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package controlhub
+
+import (
+	"encoding/json"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testControlHub accepts the events of the valid token and creates token2 for the component
+type testControlHub struct {
+	validToken       string
+	mutex            sync.Mutex
+	registeredTokens []string
+	createdTokens    int
+}
+
+func (c *testControlHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	switch r.URL.Path {
+	case RegistrationUrlPath:
+		var registrationData RegistrationData
+		_ = json.NewDecoder(r.Body).Decode(&registrationData)
+		c.registeredTokens = append(c.registeredTokens, registrationData.AuthToken)
+	case LoginUrlPath:
+		w.Header().Set(common.HeaderXUserAuthToken, "userToken")
+	case "/security/rest/v1/organization/org/components":
+		c.createdTokens++
+		c.validToken = "token2"
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`[{"fullAuthToken": "token2"}]`))
+	case MessagingUrlPath:
+		if r.Header.Get(common.HeaderXAppAuthToken) != c.validToken {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func newTestTokenRenewer(schConfig Config, persistedTokens *[]string) (*TokenRenewer, *common.RuntimeInfo) {
+	runtimeInfo := &common.RuntimeInfo{ID: "edge1"}
+	runtimeInfo.SetAppAuthToken("token1")
+	tokenRenewer := NewTokenRenewer(schConfig, &common.BuildInfo{}, runtimeInfo, func(appAuthToken string) error {
+		*persistedTokens = append(*persistedTokens, appAuthToken)
+		return nil
+	})
+	runtimeInfo.SetAppAuthTokenRenewer(tokenRenewer.RenewAppAuthToken)
+	return tokenRenewer, runtimeInfo
+}
+
+func TestTokenRenewer_Credentials(t *testing.T) {
+	controlHub := &testControlHub{validToken: "token0"}
+	server := httptest.NewServer(controlHub)
+	defer server.Close()
+
+	schConfig := NewConfig()
+	schConfig.BaseUrl = server.URL
+	schConfig.User = "admin@org"
+	schConfig.Password = "password"
+	var persistedTokens []string
+	_, runtimeInfo := newTestTokenRenewer(schConfig, &persistedTokens)
+
+	handler := &MessageEventHandler{schConfig: schConfig, runtimeInfo: runtimeInfo, httpClient: &http.Client{}}
+	if err := handler.exchangeEvents(nil); err == nil {
+		t.Fatal("Expected the events of the rejected token to fail")
+	}
+	if appAuthToken := runtimeInfo.GetAppAuthToken(); appAuthToken != "token2" {
+		t.Fatalf("Expected the app auth token to be renewed, but got: %s", appAuthToken)
+	}
+	if len(controlHub.registeredTokens) != 1 || controlHub.registeredTokens[0] != "token2" {
+		t.Errorf("Expected the edge registered with the new token, but got: %v", controlHub.registeredTokens)
+	}
+	if len(persistedTokens) != 1 || persistedTokens[0] != "token2" {
+		t.Errorf("Expected the new token persisted, but got: %v", persistedTokens)
+	}
+	if err := handler.exchangeEvents(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Senders rejected with the old token do not renew the token again
+	if err := runtimeInfo.RenewAppAuthToken("token1"); err != nil {
+		t.Fatal(err)
+	}
+	if controlHub.createdTokens != 1 {
+		t.Errorf("Expected one token created, but got: %d", controlHub.createdTokens)
+	}
+	if err := runtimeInfo.RenewAppAuthToken("token2"); err == nil {
+		t.Error("Expected creating another token right away to fail")
+	}
+}
+
+func TestTokenRenewer_TokenFile(t *testing.T) {
+	controlHub := &testControlHub{validToken: "token1"}
+	server := httptest.NewServer(controlHub)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "token_renewer_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token.txt")
+	if err := ioutil.WriteFile(tokenFile, []byte("token1\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	schConfig := NewConfig()
+	schConfig.BaseUrl = server.URL
+	schConfig.AppAuthTokenFile = tokenFile
+	var persistedTokens []string
+	tokenRenewer, runtimeInfo := newTestTokenRenewer(schConfig, &persistedTokens)
+
+	if err := ioutil.WriteFile(tokenFile, []byte("token2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(tokenFile, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if err := tokenRenewer.checkAppAuthTokenFile(); err != nil {
+		t.Fatal(err)
+	}
+	if appAuthToken := runtimeInfo.GetAppAuthToken(); appAuthToken != "token2" {
+		t.Fatalf("Expected the token of the changed file, but got: %s", appAuthToken)
+	}
+	if len(controlHub.registeredTokens) != 1 || len(persistedTokens) != 1 {
+		t.Errorf("Expected the new token registered and persisted, but got: %v and %v",
+			controlHub.registeredTokens, persistedTokens)
+	}
+
+	// The rejected token is still in the file and there are no credentials to create a new one
+	if err := runtimeInfo.RenewAppAuthToken("token2"); err == nil {
+		t.Error("Expected renewing the token to fail")
+	}
+	if appAuthToken := runtimeInfo.GetAppAuthToken(); appAuthToken != "token2" {
+		t.Errorf("Expected the token to be unchanged, but got: %s", appAuthToken)
+	}
+}
+
+func TestTokenRenewer_RunStops(t *testing.T) {
+	schConfig := NewConfig()
+	schConfig.AppAuthTokenFile = filepath.Join(os.TempDir(), "missing_token.txt")
+	schConfig.TokenFileCheckInterval = 10
+	var persistedTokens []string
+	tokenRenewer, _ := newTestTokenRenewer(schConfig, &persistedTokens)
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		tokenRenewer.Run(stop)
+		close(stopped)
+	}()
+	close(stop)
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the token renewer to stop")
+	}
+}
@@ -25,6 +25,8 @@ type PipelineBean struct {
 	Stages               []StageBean
 	ErrorStage           StageBean
 	StatsAggregatorStage StageBean
+	StartEventStages     []StageBean
+	StopEventStages      []StageBean
 	ElContext            context.Context
 }
 
@@ -81,9 +83,50 @@ func NewPipelineBean(
 		}
 	}
 
+	var eventStageIssues []validation.Issue
+	if pipelineBean.StartEventStages, eventStageIssues = newEventStageBeans(
+		pipelineConfig.StartEventStages,
+		runtimeParameters,
+		pipelineBean.ElContext,
+	); len(eventStageIssues) > 0 {
+		return pipelineBean, append(issues, eventStageIssues...)
+	}
+	if pipelineBean.StopEventStages, eventStageIssues = newEventStageBeans(
+		pipelineConfig.StopEventStages,
+		runtimeParameters,
+		pipelineBean.ElContext,
+	); len(eventStageIssues) > 0 {
+		return pipelineBean, append(issues, eventStageIssues...)
+	}
+
 	return pipelineBean, issues
 }
 
+// newEventStageBeans creates the beans of the pipeline start or stop event stages
+func newEventStageBeans(
+	stageConfigs []*common.StageConfiguration,
+	runtimeParameters map[string]interface{},
+	elContext context.Context,
+) ([]StageBean, []validation.Issue) {
+	stageBeans := make([]StageBean, 0, len(stageConfigs))
+	for _, stageConfig := range stageConfigs {
+		if stageConfig == nil || stageConfig.InstanceName == "" {
+			continue
+		}
+		stageBean, err := NewStageBean(stageConfig, runtimeParameters, elContext)
+		if err != nil {
+			return nil, []validation.Issue{{
+				InstanceName: stageConfig.InstanceName,
+				Level:        common.StageConfig,
+				Count:        1,
+				Message:      err.Error(),
+			}}
+		}
+		stageBeans = append(stageBeans, stageBean)
+	}
+	return stageBeans, nil
+}
+
 func initializeElContext(
 	pipelineConfig common.PipelineConfiguration,
 	configBean PipelineConfigBean,
@@ -32,6 +32,8 @@ const (
 	MaxRunners           = "maxRunners"
 	StatsAggregatorStage = "statsAggregatorStage"
 	ErrorRecordPolicy    = "errorRecordPolicy"
+	StoreAndForward      = "storeAndForward"
+	StoreAndForwardMaxMB = "storeAndForwardMaxSizeMB"
 
 	ClusterSlaveMemory   = "clusterSlaveMemory"
 	ClusterSlaveJavaOpts = "clusterSlaveJavaOpts"
@@ -58,6 +60,9 @@ type PipelineConfigBean struct {
 	StatsAggregatorStage string
 	RateLimit            float64
 	MaxRunners           float64
+	StoreAndForward      bool
+	StoreAndForwardMaxMB float64
+	WebhookConfigs       []interface{}
 }
 
 func NewPipelineConfigBean(pipelineConfig common.PipelineConfiguration) PipelineConfigBean {
@@ -104,6 +109,12 @@ func NewPipelineConfigBean(pipelineConfig common.PipelineConfiguration) Pipeline
 			pipelineConfigBean.RateLimit = config.Value.(float64)
 		case MaxRunners:
 			pipelineConfigBean.MaxRunners = config.Value.(float64)
+		case StoreAndForward:
+			pipelineConfigBean.StoreAndForward = config.Value.(bool)
+		case StoreAndForwardMaxMB:
+			pipelineConfigBean.StoreAndForwardMaxMB = config.Value.(float64)
+		case WebHookConfigs:
+			pipelineConfigBean.WebhookConfigs = config.Value.([]interface{})
 		}
 	}
 
@@ -130,6 +141,8 @@ func GetDefaultPipelineConfigs() []common.Config {
 		{Name: HdfsS3ConfigDir, Value: nil},
 		{Name: RateLimit, Value: 0},
 		{Name: MaxRunners, Value: 0},
+		{Name: StoreAndForward, Value: false},
+		{Name: StoreAndForwardMaxMB, Value: 100},
 		{Name: WebHookConfigs, Value: []interface{}{}},
 		{Name: StatsAggregatorStage, Value: "streamsets-datacollector-basic-lib::com_streamsets_pipeline_stage_destination_devnull_StatsDpmDirectlyDTarget::1"},
 	}
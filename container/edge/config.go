@@ -18,6 +18,7 @@ import (
 	"github.com/streamsets/datacollector-edge/container/controlhub"
 	"github.com/streamsets/datacollector-edge/container/execution"
 	"github.com/streamsets/datacollector-edge/container/http"
+	"github.com/streamsets/datacollector-edge/container/notification"
 	"github.com/streamsets/datacollector-edge/container/process"
 	"github.com/streamsets/datacollector-edge/container/util"
 	"os"
@@ -25,11 +26,12 @@ import (
 
 // Config represents the configuration format for the Data Collector Edge binary.
 type Config struct {
-	LogDir    string `toml:"log-dir"`
-	Execution execution.Config
-	Http      http.Config
-	SCH       controlhub.Config
-	Process   process.Config
+	LogDir       string `toml:"log-dir"`
+	Execution    execution.Config
+	Http         http.Config
+	SCH          controlhub.Config
+	Process      process.Config
+	Notification notification.Config
 }
 
 // NewConfig returns a new Config with default settings.
@@ -39,6 +41,7 @@ func NewConfig() *Config {
 	c.Http = http.NewConfig()
 	c.SCH = controlhub.NewConfig()
 	c.Process = process.NewConfig()
+	c.Notification = notification.NewConfig()
 	return c
 }
 
@@ -13,6 +13,7 @@
 package edge
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -20,12 +21,19 @@ import (
 	"github.com/streamsets/datacollector-edge/container/common"
 	"github.com/streamsets/datacollector-edge/container/controlhub"
 	"github.com/streamsets/datacollector-edge/container/execution/manager"
+	"github.com/streamsets/datacollector-edge/container/execution/runner"
+	executionStore "github.com/streamsets/datacollector-edge/container/execution/store"
 	"github.com/streamsets/datacollector-edge/container/http"
+	"github.com/streamsets/datacollector-edge/container/notification"
 	"github.com/streamsets/datacollector-edge/container/process"
 	"github.com/streamsets/datacollector-edge/container/store"
+	"github.com/streamsets/datacollector-edge/container/util"
+	"io/ioutil"
 	"os"
 	"path"
+	"regexp"
 	"runtime"
+	"strconv"
 	"strings"
 )
 
@@ -48,6 +56,7 @@ type DataCollectorEdgeMain struct {
 	Manager                manager.Manager
 	processManager         process.Manager
 	DPMMessageEventHandler *controlhub.MessageEventHandler
+	stopTokenRenewer       chan struct{}
 }
 
 func DoMain(
@@ -100,6 +109,11 @@ func newDataCollectorEdge(
 	if err != nil {
 		return nil, err
 	}
+	config.Http.ResolvePaths(path.Dir(baseDir + DefaultConfigFilePath))
+	config.SCH.ResolvePaths(path.Dir(baseDir + DefaultConfigFilePath))
+	if err := config.SCH.ReadAppAuthTokenFile(); err != nil {
+		return nil, err
+	}
 
 	err = initializeLog(debugFlag, logToConsoleFlag, baseDir, config.LogDir)
 	if err != nil {
@@ -108,6 +122,9 @@ func newDataCollectorEdge(
 
 	hostName, _ := os.Hostname()
 	var httpUrl = "http://" + hostName + config.Http.BindAddress
+	if config.Http.TLS.Enabled {
+		httpUrl = "https://" + hostName + config.Http.BindAddress
+	}
 
 	if len(config.Http.BaseHttpUrl) > 0 {
 		httpUrl = config.Http.BaseHttpUrl
@@ -123,7 +140,12 @@ func newDataCollectorEdge(
 	}
 
 	runtimeInfo, _ := common.NewRuntimeInfo(httpUrl, baseDir)
-	pipelineStoreTask := store.NewFilePipelineStoreTask(*runtimeInfo)
+	pipelineStoreTask := store.NewFilePipelineStoreTask(runtimeInfo)
+	notifier := notification.NewNotifier(config.Notification, runtimeInfo, pipelineStoreTask)
+	executionStore.AddStateListener(notifier.OnStateChange)
+	if err := executionStore.OpenStorage(config.Execution.Storage); err != nil {
+		return nil, err
+	}
 	pipelineManager, _ := manager.NewManager(config.Execution, runtimeInfo, pipelineStoreTask)
 
 	processManager, err := process.NewManager(config.Process)
@@ -132,18 +154,45 @@ func newDataCollectorEdge(
 		return nil, err
 	}
 
-	webServerTask, _ := http.NewWebServerTask(config.Http, buildInfo, pipelineManager, pipelineStoreTask, processManager)
+	webServerTask, err := http.NewWebServerTask(config.Http, buildInfo, pipelineManager, pipelineStoreTask, processManager)
+	if err != nil {
+		return nil, err
+	}
 	controlhub.RegisterWithControlHub(config.SCH, buildInfo, runtimeInfo)
 
 	var messagingEventHandler *controlhub.MessageEventHandler
+	stopTokenRenewer := make(chan struct{})
 	if runtimeInfo.DPMEnabled {
-		messagingEventHandler = controlhub.NewMessageEventHandler(
+		tokenRenewer := controlhub.NewTokenRenewer(
+			config.SCH,
+			buildInfo,
+			runtimeInfo,
+			persistAppAuthToken(baseDir+DefaultConfigFilePath, config.SCH.AppAuthTokenFile),
+		)
+		runtimeInfo.SetAppAuthTokenRenewer(tokenRenewer.RenewAppAuthToken)
+		go tokenRenewer.Run(stopTokenRenewer)
+
+		messagingEventHandler, err = controlhub.NewMessageEventHandler(
 			config.SCH,
 			buildInfo, runtimeInfo,
 			pipelineStoreTask,
 			pipelineManager,
+			processManager.GetProcessMetrics(),
 		)
+		if err != nil {
+			return nil, err
+		}
 		messagingEventHandler.Init()
+
+		err = runner.OpenMetricsOutbox(
+			runtimeInfo.BaseDir+controlhub.OutboxFolder+controlhub.MetricsOutboxFolder,
+			config.SCH.OutboxMaxMessages,
+			runtimeInfo,
+			processManager.GetProcessMetrics(),
+		)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &DataCollectorEdgeMain{
@@ -154,9 +203,51 @@ func newDataCollectorEdge(
 		Manager:                pipelineManager,
 		PipelineStoreTask:      pipelineStoreTask,
 		DPMMessageEventHandler: messagingEventHandler,
+		stopTokenRenewer:       stopTokenRenewer,
 	}, nil
 }
 
+// Shutdown stops the web server and the Control Hub event handler and token renewer
+func (d *DataCollectorEdgeMain) Shutdown() {
+	d.WebServerTask.Shutdown()
+	if d.RuntimeInfo.DPMEnabled {
+		d.DPMMessageEventHandler.Shutdown()
+	}
+	close(d.stopTokenRenewer)
+}
+
+// appAuthTokenLine matches the value of the app auth token in the config file
+var appAuthTokenLine = regexp.MustCompile(`(?m)^(\s*app-auth-token\s*=\s*)"[^"\n]*"`)
+
+// persistAppAuthToken returns a function which saves a renewed Control Hub app auth token in the app auth
+// token file if configured, otherwise in the config file. Only the token line of the config file is changed,
+// its comments and layout are kept.
+func persistAppAuthToken(configFile string, appAuthTokenFile string) func(appAuthToken string) error {
+	return func(appAuthToken string) error {
+		if len(appAuthTokenFile) > 0 {
+			return util.WriteFileAtomic(appAuthTokenFile, []byte(appAuthToken+"\n"), 0600)
+		}
+
+		fileInfo, err := os.Stat(configFile)
+		if err != nil {
+			return err
+		}
+		configData, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			return err
+		}
+		match := appAuthTokenLine.FindSubmatchIndex(configData)
+		if match == nil {
+			return fmt.Errorf("no app-auth-token setting in config file %s", configFile)
+		}
+		var newConfigData bytes.Buffer
+		newConfigData.Write(configData[:match[3]])
+		newConfigData.WriteString(strconv.Quote(appAuthToken))
+		newConfigData.Write(configData[match[1]:])
+		return util.WriteFileAtomic(configFile, newConfigData.Bytes(), fileInfo.Mode())
+	}
+}
+
 type ContextHook struct{}
 
 func (hook ContextHook) Levels() []log.Level {
@@ -0,0 +1,213 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package edge
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"github.com/streamsets/datacollector-edge/container/execution"
+	"github.com/streamsets/datacollector-edge/container/execution/manager"
+	"github.com/streamsets/datacollector-edge/container/execution/runner"
+	executionStore "github.com/streamsets/datacollector-edge/container/execution/store"
+	"github.com/streamsets/datacollector-edge/container/store"
+	"github.com/streamsets/datacollector-edge/container/util"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	OfflineRunSucceeded = 0
+	OfflineRunFailed    = 1
+)
+
+// offlinePipelineStoreTask serves the pipeline loaded from a JSON file in place of the pipeline store
+type offlinePipelineStoreTask struct {
+	store.PipelineStoreTask
+	pipelineConfig common.PipelineConfiguration
+}
+
+func (s *offlinePipelineStoreTask) LoadPipelineConfig(pipelineId string) (common.PipelineConfiguration, error) {
+	if pipelineId == s.pipelineConfig.PipelineId {
+		return s.pipelineConfig, nil
+	}
+	return s.PipelineStoreTask.LoadPipelineConfig(pipelineId)
+}
+
+// RunOffline runs a pipeline once without the web server and Control Hub, until the origin is finished or
+// maxBatches batches are processed, and prints a metrics summary. The pipeline is either the id of a pipeline
+// in the store or the path of a pipeline JSON file. It returns the exit code of the process, which is
+// OfflineRunFailed when the pipeline fails to start, fails while running or is interrupted.
+// Pipeline retries are not attempted, the first run error fails the run.
+func RunOffline(
+	baseDir string,
+	debugFlag bool,
+	logToConsoleFlag bool,
+	pipeline string,
+	runtimeParametersArg string,
+	maxBatches int64,
+) int {
+	config := NewConfig()
+	if err := config.FromTomlFile(baseDir + DefaultConfigFilePath); err != nil {
+		fmt.Println(err)
+		return OfflineRunFailed
+	}
+	if err := initializeLog(debugFlag, logToConsoleFlag, baseDir, config.LogDir); err != nil {
+		fmt.Println(err)
+		return OfflineRunFailed
+	}
+
+	var runtimeParameters map[string]interface{}
+	if len(runtimeParametersArg) > 0 {
+		if err := json.Unmarshal([]byte(runtimeParametersArg), &runtimeParameters); err != nil {
+			fmt.Println(err)
+			return OfflineRunFailed
+		}
+	}
+
+	runtimeInfo, err := common.NewRuntimeInfo("", baseDir)
+	if err != nil {
+		fmt.Println(err)
+		return OfflineRunFailed
+	}
+	var pipelineStoreTask = store.NewFilePipelineStoreTask(runtimeInfo)
+	pipelineId := pipeline
+	if _, err := os.Stat(pipeline); err == nil {
+		pipelineConfig, err := loadPipelineFile(pipeline)
+		if err != nil {
+			fmt.Println(err)
+			return OfflineRunFailed
+		}
+		pipelineId = pipelineConfig.PipelineId
+		pipelineStoreTask = &offlinePipelineStoreTask{
+			PipelineStoreTask: pipelineStoreTask,
+			pipelineConfig:    pipelineConfig,
+		}
+	}
+
+	if err := executionStore.OpenStorage(config.Execution.Storage); err != nil {
+		fmt.Println(err)
+		return OfflineRunFailed
+	}
+	defer executionStore.CloseStorage()
+
+	// Final states of the run, a pipeline in RETRY is not retried but stopped
+	finalStates := make(chan common.PipelineState, 1)
+	executionStore.AddStateListener(func(statePipelineId string, pipelineState common.PipelineState) {
+		if statePipelineId != pipelineId {
+			return
+		}
+		switch pipelineState.Status {
+		case common.FINISHED, common.START_ERROR, common.RUN_ERROR, common.RETRY, common.STOPPED:
+			select {
+			case finalStates <- pipelineState:
+			default:
+			}
+		}
+	})
+
+	config.Execution.MaxBatches = maxBatches
+	pipelineManager, err := manager.NewManager(config.Execution, runtimeInfo, pipelineStoreTask)
+	if err != nil {
+		fmt.Println(err)
+		return OfflineRunFailed
+	}
+	pipelineRunner := pipelineManager.GetRunner(pipelineId)
+	if state, _ := pipelineRunner.GetStatus(); state != nil && state.Status == common.RUNNING {
+		// The previous run did not stop cleanly, change it back to stopped
+		pipelineRunner.StopPipeline()
+		select {
+		case <-finalStates:
+		default:
+		}
+	}
+
+	fmt.Println("Running Pipeline: ", pipelineId)
+	start := time.Now()
+	if _, err := pipelineRunner.StartPipeline(runtimeParameters); err != nil {
+		fmt.Println(err)
+		return OfflineRunFailed
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	var finalState common.PipelineState
+	select {
+	case finalState = <-finalStates:
+	case sig := <-signals:
+		log.Infof("Program got a system signal %v", sig)
+		if _, err := pipelineRunner.StopPipeline(); err != nil {
+			log.WithError(err).WithField("id", pipelineId).Error("Error stopping pipeline")
+		}
+		finalState = <-finalStates
+	}
+	if finalState.Status == common.RETRY {
+		if _, err := pipelineRunner.StopPipeline(); err != nil {
+			log.WithError(err).WithField("id", pipelineId).Error("Error stopping pipeline")
+		}
+	}
+
+	printOfflineRunSummary(pipelineRunner, finalState, time.Since(start))
+	if finalState.Status == common.FINISHED {
+		return OfflineRunSucceeded
+	}
+	return OfflineRunFailed
+}
+
+// loadPipelineFile reads a pipeline JSON file, the file name is the pipeline id if the file has none
+func loadPipelineFile(pipelineFile string) (common.PipelineConfiguration, error) {
+	pipelineConfig := common.PipelineConfiguration{}
+	pipelineJson, err := ioutil.ReadFile(pipelineFile)
+	if err != nil {
+		return pipelineConfig, err
+	}
+	if err := json.Unmarshal(pipelineJson, &pipelineConfig); err != nil {
+		return pipelineConfig, fmt.Errorf("invalid pipeline file '%s': %s", pipelineFile, err)
+	}
+	if len(pipelineConfig.PipelineId) == 0 {
+		pipelineConfig.PipelineId = strings.TrimSuffix(filepath.Base(pipelineFile), filepath.Ext(pipelineFile))
+	}
+	return pipelineConfig, nil
+}
+
+func printOfflineRunSummary(pipelineRunner execution.Runner, finalState common.PipelineState, duration time.Duration) {
+	fmt.Printf("Pipeline %s in %s\n", finalState.Status, duration.Round(time.Millisecond))
+	if len(finalState.Message) > 0 {
+		fmt.Println("Message: ", finalState.Message)
+	}
+
+	metricRegistry, err := pipelineRunner.GetMetrics()
+	if err != nil {
+		return
+	}
+	for _, metric := range []struct {
+		label string
+		name  string
+	}{
+		{"Batches", runner.PipelineBatchCount},
+		{"Input records", runner.PipelineBatchInputRecords},
+		{"Output records", runner.PipelineBatchOutputRecords},
+		{"Error records", runner.PipelineBatchErrorRecords},
+		{"Error messages", runner.PipelineBatchErrorMessages},
+	} {
+		fmt.Printf("%-15s %d\n", metric.label+":", util.CreateCounter(metricRegistry, metric.name).Count())
+	}
+}
@@ -42,6 +42,7 @@ func Evaluate(
 			&PipelineEL{Context: elContext},
 			&JobEL{Context: elContext},
 			&SdcEL{},
+			&JvmEL{},
 		},
 	)
 	return evaluator.Evaluate(value)
@@ -0,0 +1,45 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package el
+
+import (
+	"errors"
+	"fmt"
+	"github.com/madhukard/govaluate"
+	"github.com/streamsets/datacollector-edge/container/util"
+)
+
+// JvmEL provides the jvm functions used by pipelines designed in Data Collector, there is no
+// JVM heap in Data Collector Edge so the host memory is used instead
+type JvmEL struct {
+}
+
+func (j *JvmEL) MaxMemoryMB(args ...interface{}) (interface{}, error) {
+	if len(args) != 0 {
+		return nil, errors.New(
+			fmt.Sprintf("The function 'jvm:maxMemoryMB' requires 0 arguments but was passed %d", len(args)),
+		)
+	}
+	totalMemory, err := util.GetTotalMemory()
+	if err != nil {
+		return nil, err
+	}
+	return float64(totalMemory / util.BytesPerMB), nil
+}
+
+func (j *JvmEL) GetELFunctionDefinitions() map[string]govaluate.ExpressionFunction {
+	functions := map[string]govaluate.ExpressionFunction{
+		"jvm:maxMemoryMB": j.MaxMemoryMB,
+	}
+	return functions
+}
@@ -0,0 +1,46 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package el
+
+import (
+	"github.com/streamsets/datacollector-edge/container/util"
+	"testing"
+)
+
+func TestJvmEL(t *testing.T) {
+	totalMemory, err := util.GetTotalMemory()
+	if err != nil {
+		t.Skip("Total memory is not available: ", err)
+	}
+	maxMemoryMB := float64(totalMemory / util.BytesPerMB)
+
+	evaluationTests := []EvaluationTest{
+		{
+			Name:       "Test function jvm:maxMemoryMB",
+			Expression: "${jvm:maxMemoryMB()}",
+			Expected:   maxMemoryMB,
+		},
+		{
+			Name:       "Test function jvm:maxMemoryMB - Default memory limit",
+			Expression: "${jvm:maxMemoryMB() * 0.65}",
+			Expected:   maxMemoryMB * 0.65,
+		},
+		{
+			Name:       "Test function jvm:maxMemoryMB - Error 1",
+			Expression: "${jvm:maxMemoryMB('invalid param')}",
+			Expected:   "The function 'jvm:maxMemoryMB' requires 0 arguments but was passed 1",
+			ErrorCase:  true,
+		},
+	}
+	RunEvaluationTests(evaluationTests, []Definitions{&JvmEL{}}, t)
+}
@@ -12,17 +12,29 @@
 // limitations under the License.
 package execution
 
+import (
+	"github.com/streamsets/datacollector-edge/container/execution/store"
+)
+
 const (
 	DefaultMaxBatchSize = 1000
+	DefaultDrainTimeout = 30000
 )
 
 type Config struct {
-	MaxBatchSize int `toml:"max-batch-size"`
+	MaxBatchSize int          `toml:"max-batch-size"`
+	DrainTimeout int          `toml:"drain-timeout"`
+	Storage      store.Config `toml:"storage"`
+	// MaxBatches finishes pipelines after that many batches, 0 runs them until the origin is finished.
+	// It is set by the offline run mode only.
+	MaxBatches int64 `toml:"-"`
 }
 
 // NewConfig returns a new Config with default settings.
 func NewConfig() Config {
 	return Config{
 		MaxBatchSize: DefaultMaxBatchSize,
+		DrainTimeout: DefaultDrainTimeout,
+		Storage:      store.NewConfig(),
 	}
 }
@@ -0,0 +1,25 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package execution
+
+import "github.com/streamsets/datacollector-edge/api"
+
+// LaneTap streams sampled records flowing through a lane of a running pipeline
+type LaneTap interface {
+	GetLane() string
+	// Records returns the tapped records, the channel is closed when the tap is closed or the pipeline stops
+	Records() <-chan api.Record
+	// GetDroppedRecords returns the number of sampled records dropped because the reader was too slow
+	GetDroppedRecords() int64
+	Close()
+}
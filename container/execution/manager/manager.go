@@ -27,4 +27,8 @@ type Manager interface {
 	) (*common.PipelineState, error)
 	StopPipeline(pipelineId string) (*common.PipelineState, error)
 	ResetOffset(pipelineId string) error
+	ValidatePipeline(pipelineId string, timeoutMillis int64) (execution.PreviewOutput, error)
+	DeletePipeline(pipelineId string) error
+	DeleteHistory(pipelineId string) error
+	UpdatePipelineInfo(pipelineId string, title string, description string) (common.PipelineInfo, error)
 }
@@ -15,19 +15,43 @@ package manager
 import (
 	"errors"
 	"fmt"
+	log "github.com/sirupsen/logrus"
 	"github.com/streamsets/datacollector-edge/container/common"
 	"github.com/streamsets/datacollector-edge/container/execution"
 	"github.com/streamsets/datacollector-edge/container/execution/preview"
 	"github.com/streamsets/datacollector-edge/container/execution/runner"
+	executionStore "github.com/streamsets/datacollector-edge/container/execution/store"
 	"github.com/streamsets/datacollector-edge/container/store"
+	"github.com/streamsets/datacollector-edge/container/util"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	deleteActivePipelineError = "CONTAINER_0062 - Cannot delete pipeline '%s' in status '%s'"
+	deleteActiveHistoryError  = "CONTAINER_0063 - Cannot delete history of pipeline '%s' in status '%s'"
+	emptyPipelineTitleError   = "CONTAINER_0064 - Pipeline title of pipeline '%s' cannot be empty"
+	// PreviewerExpiry is the time a previewer and its output are kept after they were last accessed
+	PreviewerExpiry = 30 * time.Minute
 )
 
 type PipelineManager struct {
 	config            execution.Config
 	runnerMap         map[string]execution.Runner
-	previewerMap      map[string]execution.Previewer
+	runnerMutex       sync.Mutex
+	previewerMap      map[string]*previewerEntry
+	previewerMutex    sync.Mutex
 	runtimeInfo       *common.RuntimeInfo
 	pipelineStoreTask store.PipelineStoreTask
+	// startDeleteMutex is held by starts and deletes, so a pipeline can not be started between the check
+	// that it is not active and the delete
+	startDeleteMutex sync.Mutex
+}
+
+type previewerEntry struct {
+	previewer  execution.Previewer
+	lastAccess time.Time
 }
 
 func (p *PipelineManager) CreatePreviewer(pipelineId string) (execution.Previewer, error) {
@@ -35,18 +59,41 @@ func (p *PipelineManager) CreatePreviewer(pipelineId string) (execution.Previewe
 	if err != nil {
 		return nil, err
 	}
-	p.previewerMap[previewer.GetId()] = previewer
+	p.previewerMutex.Lock()
+	defer p.previewerMutex.Unlock()
+	p.removeExpiredPreviewers(time.Now())
+	p.previewerMap[previewer.GetId()] = &previewerEntry{previewer: previewer, lastAccess: time.Now()}
 	return previewer, nil
 }
 
 func (p *PipelineManager) GetPreviewer(previewerId string) (execution.Previewer, error) {
-	if p.previewerMap[previewerId] == nil {
+	p.previewerMutex.Lock()
+	defer p.previewerMutex.Unlock()
+	entry := p.previewerMap[previewerId]
+	if entry == nil {
 		return nil, errors.New(fmt.Sprintf("Cannot find the previewer in cache for id: %s", previewerId))
 	}
-	return p.previewerMap[previewerId], nil
+	entry.lastAccess = time.Now()
+	return entry.previewer, nil
+}
+
+// removeExpiredPreviewers stops and removes the previewers which were not accessed for PreviewerExpiry, so
+// the batches of previews which are never read again are not kept for the life of the process
+func (p *PipelineManager) removeExpiredPreviewers(now time.Time) {
+	for previewerId, entry := range p.previewerMap {
+		if now.Sub(entry.lastAccess) < PreviewerExpiry {
+			continue
+		}
+		if err := entry.previewer.Stop(); err != nil {
+			log.WithError(err).WithField("previewerId", previewerId).Warn("Failed to stop expired previewer")
+		}
+		delete(p.previewerMap, previewerId)
+	}
 }
 
 func (p *PipelineManager) GetRunner(pipelineId string) execution.Runner {
+	p.runnerMutex.Lock()
+	defer p.runnerMutex.Unlock()
 	if p.runnerMap[pipelineId] == nil {
 		pRunner, err := runner.NewEdgeRunner(pipelineId, p.config, p.runtimeInfo, p.pipelineStoreTask)
 		if err != nil {
@@ -61,6 +108,8 @@ func (p *PipelineManager) StartPipeline(
 	pipelineId string,
 	runtimeParameters map[string]interface{},
 ) (*common.PipelineState, error) {
+	p.startDeleteMutex.Lock()
+	defer p.startDeleteMutex.Unlock()
 	return p.GetRunner(pipelineId).StartPipeline(runtimeParameters)
 }
 
@@ -69,9 +118,85 @@ func (p *PipelineManager) StopPipeline(pipelineId string) (*common.PipelineState
 }
 
 func (p *PipelineManager) ResetOffset(pipelineId string) error {
+	if _, err := p.pipelineStoreTask.GetInfo(pipelineId); err != nil {
+		return err
+	}
 	return p.GetRunner(pipelineId).ResetOffset()
 }
 
+// ValidatePipeline validates the pipeline configuration and blocks until the validation is done or timed out
+func (p *PipelineManager) ValidatePipeline(pipelineId string, timeoutMillis int64) (execution.PreviewOutput, error) {
+	previewer := preview.NewSyncPreviewer(pipelineId, p.config, p.pipelineStoreTask)
+	err := previewer.ValidateConfigs(timeoutMillis)
+	return previewer.GetOutput(), err
+}
+
+// DeletePipeline deletes the pipeline with its offsets, states, history, errors and snapshots, the pipeline
+// must not be active
+func (p *PipelineManager) DeletePipeline(pipelineId string) error {
+	p.startDeleteMutex.Lock()
+	defer p.startDeleteMutex.Unlock()
+	if err := p.checkNotActive(pipelineId, deleteActivePipelineError); err != nil {
+		return err
+	}
+	if err := p.pipelineStoreTask.Delete(pipelineId); err != nil {
+		return err
+	}
+	// A pipeline created again with the same id starts with a new runner
+	p.runnerMutex.Lock()
+	delete(p.runnerMap, pipelineId)
+	p.runnerMutex.Unlock()
+	return nil
+}
+
+// DeleteHistory deletes the state history of the pipeline, the pipeline must not be active
+func (p *PipelineManager) DeleteHistory(pipelineId string) error {
+	p.startDeleteMutex.Lock()
+	defer p.startDeleteMutex.Unlock()
+	if err := p.checkNotActive(pipelineId, deleteActiveHistoryError); err != nil {
+		return err
+	}
+	return executionStore.DeleteHistory(pipelineId)
+}
+
+// UpdatePipelineInfo changes the title and description of the pipeline
+func (p *PipelineManager) UpdatePipelineInfo(
+	pipelineId string,
+	title string,
+	description string,
+) (common.PipelineInfo, error) {
+	if len(strings.TrimSpace(title)) == 0 {
+		return common.PipelineInfo{}, fmt.Errorf(emptyPipelineTitleError, pipelineId)
+	}
+	if _, err := p.pipelineStoreTask.GetInfo(pipelineId); err != nil {
+		return common.PipelineInfo{}, err
+	}
+	pipelineConfiguration, err := p.pipelineStoreTask.LoadPipelineConfig(pipelineId)
+	if err != nil {
+		return common.PipelineInfo{}, err
+	}
+	pipelineConfiguration.Title = title
+	pipelineConfiguration.Description = description
+	pipelineConfiguration, err = p.pipelineStoreTask.Save(pipelineId, pipelineConfiguration)
+	return pipelineConfiguration.Info, err
+}
+
+// checkNotActive returns an error with the message format if the pipeline does not exist or is active
+func (p *PipelineManager) checkNotActive(pipelineId string, activeErrorFormat string) error {
+	// The existence is checked first, getting the runner of a missing pipeline fails
+	if _, err := p.pipelineStoreTask.GetInfo(pipelineId); err != nil {
+		return err
+	}
+	state, err := p.GetRunner(pipelineId).GetStatus()
+	if err != nil {
+		return err
+	}
+	if state != nil && util.Contains(runner.ActiveStatuses, state.Status) {
+		return fmt.Errorf(activeErrorFormat, pipelineId, state.Status)
+	}
+	return nil
+}
+
 func NewManager(
 	config execution.Config,
 	runtimeInfo *common.RuntimeInfo,
@@ -80,7 +205,7 @@ func NewManager(
 	pipelineManager := PipelineManager{
 		config:            config,
 		runnerMap:         make(map[string]execution.Runner),
-		previewerMap:      make(map[string]execution.Previewer),
+		previewerMap:      make(map[string]*previewerEntry),
 		runtimeInfo:       runtimeInfo,
 		pipelineStoreTask: pipelineStoreTask,
 	}
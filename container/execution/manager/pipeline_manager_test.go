@@ -0,0 +1,141 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package manager
+
+import (
+	"github.com/streamsets/datacollector-edge/container/common"
+	"github.com/streamsets/datacollector-edge/container/execution"
+	executionStore "github.com/streamsets/datacollector-edge/container/execution/store"
+	"github.com/streamsets/datacollector-edge/container/store"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func getTestManager(t *testing.T) (Manager, store.PipelineStoreTask, func()) {
+	baseDir, err := ioutil.TempDir("", "pipeline_manager_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runtimeInfo := &common.RuntimeInfo{BaseDir: baseDir}
+	pipelineStoreTask := store.NewFilePipelineStoreTask(runtimeInfo)
+	manager, err := NewManager(execution.NewConfig(), runtimeInfo, pipelineStoreTask)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return manager, pipelineStoreTask, func() { os.RemoveAll(baseDir) }
+}
+
+func TestPipelineManager_DeletePipeline(t *testing.T) {
+	manager, pipelineStoreTask, cleanup := getTestManager(t)
+	defer cleanup()
+
+	if err := manager.DeletePipeline("missingPipeline"); err == nil {
+		t.Error("Expected an error for a missing pipeline")
+	}
+
+	if _, err := pipelineStoreTask.Create("pipeline1", "Pipeline 1", "", false); err != nil {
+		t.Fatal(err)
+	}
+	runningState := &common.PipelineState{PipelineId: "pipeline1", Status: common.RUNNING}
+	if err := executionStore.SaveState("pipeline1", runningState); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.DeletePipeline("pipeline1"); err == nil {
+		t.Error("Expected an error for deleting a running pipeline")
+	}
+	if err := manager.DeleteHistory("pipeline1"); err == nil {
+		t.Error("Expected an error for deleting the history of a running pipeline")
+	}
+
+	// The runner keeps the state it loaded, stopping it changes the state to STOPPED
+	if _, err := manager.StopPipeline("pipeline1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.DeleteHistory("pipeline1"); err != nil {
+		t.Fatal(err)
+	}
+	if history, err := manager.GetRunner("pipeline1").GetHistory(); err != nil || len(history) != 0 {
+		t.Errorf("Expected empty history, but got: %v %v", history, err)
+	}
+
+	if err := manager.DeletePipeline("pipeline1"); err != nil {
+		t.Fatal(err)
+	}
+	if pipelines, _ := pipelineStoreTask.GetPipelines(); len(pipelines) != 0 {
+		t.Errorf("Expected no pipelines, but got: %v", pipelines)
+	}
+
+	// A pipeline created again with the same id starts in the edited status
+	if _, err := pipelineStoreTask.Create("pipeline1", "Pipeline 1", "", false); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := manager.GetRunner("pipeline1").GetStatus(); state.Status != common.EDITED {
+		t.Errorf("Expected status %s, but got: %s", common.EDITED, state.Status)
+	}
+}
+
+func TestPipelineManager_UpdatePipelineInfo(t *testing.T) {
+	manager, pipelineStoreTask, cleanup := getTestManager(t)
+	defer cleanup()
+
+	if _, err := pipelineStoreTask.Create("pipeline1", "Pipeline 1", "", false); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := manager.UpdatePipelineInfo("pipeline1", " ", "description"); err == nil {
+		t.Error("Expected an error for an empty title")
+	}
+
+	pipelineInfo, err := manager.UpdatePipelineInfo("pipeline1", "Renamed", "New description")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pipelineInfo.Title != "Renamed" || pipelineInfo.Description != "New description" {
+		t.Errorf("Unexpected pipeline info: %+v", pipelineInfo)
+	}
+
+	pipelines, _ := pipelineStoreTask.GetPipelines()
+	if len(pipelines) != 1 || pipelines[0].Title != "Renamed" {
+		t.Errorf("Expected the renamed pipeline in the pipeline list, but got: %+v", pipelines)
+	}
+	pipelineConfig, err := pipelineStoreTask.LoadPipelineConfig("pipeline1")
+	if err != nil || pipelineConfig.Title != "Renamed" || pipelineConfig.Description != "New description" {
+		t.Errorf("Expected the renamed pipeline configuration, but got: %+v %v", pipelineConfig.Info, err)
+	}
+}
+
+func TestPipelineManager_RemoveExpiredPreviewers(t *testing.T) {
+	manager, _, cleanup := getTestManager(t)
+	defer cleanup()
+	pipelineManager := manager.(*PipelineManager)
+
+	expiredPreviewer, err := manager.CreatePreviewer("pipeline1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipelineManager.previewerMap[expiredPreviewer.GetId()].lastAccess = time.Now().Add(-PreviewerExpiry)
+
+	// Creating a previewer removes the expired ones
+	previewer, err := manager.CreatePreviewer("pipeline1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.GetPreviewer(expiredPreviewer.GetId()); err == nil {
+		t.Error("Expected the expired previewer to be removed")
+	}
+	if _, err := manager.GetPreviewer(previewer.GetId()); err != nil {
+		t.Error(err)
+	}
+}
@@ -13,13 +13,13 @@
 package preview
 
 import (
-	"github.com/satori/go.uuid"
 	"github.com/streamsets/datacollector-edge/container/execution"
 	pipelineStore "github.com/streamsets/datacollector-edge/container/store"
 )
 
+// AsyncPreviewer validates and previews in the background, the status and output are polled by the caller
 type AsyncPreviewer struct {
-	syncPreviewer SyncPreviewer
+	syncPreviewer *SyncPreviewer
 }
 
 func (p *AsyncPreviewer) GetId() string {
@@ -27,6 +27,8 @@ func (p *AsyncPreviewer) GetId() string {
 }
 
 func (p *AsyncPreviewer) ValidateConfigs(timeoutMillis int64) error {
+	p.syncPreviewer.setStatus(Validating)
+	go p.syncPreviewer.ValidateConfigs(timeoutMillis)
 	return nil
 }
 
@@ -39,6 +41,7 @@ func (p *AsyncPreviewer) Start(
 	timeoutMillis int64,
 	testOrigin bool,
 ) error {
+	p.syncPreviewer.setStatus(Starting)
 	go p.syncPreviewer.Start(batches, batchSize, skipTargets, stopStage, stagesOverride, timeoutMillis, testOrigin)
 	return nil
 }
@@ -60,12 +63,5 @@ func NewAsyncPreviewer(
 	config execution.Config,
 	pipelineStoreTask pipelineStore.PipelineStoreTask,
 ) (execution.Previewer, error) {
-	syncPreviewer := &SyncPreviewer{
-		pipelineId:        pipelineId,
-		previewerId:       uuid.NewV4().String(),
-		config:            config,
-		pipelineStoreTask: pipelineStoreTask,
-		previewOutput:     execution.PreviewOutput{},
-	}
-	return syncPreviewer, nil
+	return &AsyncPreviewer{syncPreviewer: NewSyncPreviewer(pipelineId, config, pipelineStoreTask)}, nil
 }
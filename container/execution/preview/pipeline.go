@@ -21,6 +21,7 @@ import (
 	"github.com/streamsets/datacollector-edge/container/creation"
 	"github.com/streamsets/datacollector-edge/container/execution"
 	"github.com/streamsets/datacollector-edge/container/execution/runner"
+	"sync"
 )
 
 type Pipeline struct {
@@ -31,11 +32,14 @@ type Pipeline struct {
 	pipes             []runner.Pipe
 	offsetTracker     execution.SourceOffsetTracker
 	errorStageRuntime runner.StageRuntime
-	stop              bool
+	stopChan          chan struct{}
+	stopOnce          sync.Once
 	errorSink         *common.ErrorSink
 	eventSink         *common.EventSink
 	BatchesOutput     [][]execution.StageOutput
 	stagesToSkip      map[string]execution.StageOutputJson
+	// guards BatchesOutput, which is read by a previewer that stopped waiting for a timed out preview
+	batchesMutex sync.Mutex
 }
 
 func (p *Pipeline) ValidateConfigs() []validation.Issue {
@@ -59,15 +63,19 @@ func (p *Pipeline) Init() []validation.Issue {
 	return issues
 }
 
+// Run previews up to the given number of batches, fewer if the origin is finished or the preview is cancelled.
+// Stages after the stop stage are not run, stages with an override output are not run either.
 func (p *Pipeline) Run(
 	batches int,
 	batchSize int,
 	skipTargets bool,
 	stopStage string,
 	stagesOverride []execution.StageOutputJson,
-) {
+) error {
 	log.Debug("Preview Pipeline Run()")
-	p.BatchesOutput = make([][]execution.StageOutput, batches)
+	p.batchesMutex.Lock()
+	p.BatchesOutput = make([][]execution.StageOutput, 0, batches)
+	p.batchesMutex.Unlock()
 	p.stagesToSkip = make(map[string]execution.StageOutputJson)
 
 	if stagesOverride != nil && len(stagesOverride) > 0 {
@@ -76,31 +84,36 @@ func (p *Pipeline) Run(
 		}
 	}
 
-	err := p.runBatch(0, batchSize, skipTargets)
-	if err != nil {
-		log.WithError(err).Error("Error while processing batch")
-		log.Info("Stopping Pipeline")
-		p.Stop()
+	for batchCount := 0; batchCount < batches && !p.offsetTracker.IsFinished() && !p.isCancelled(); batchCount++ {
+		if err := p.runBatch(batchSize, skipTargets, stopStage); err != nil {
+			log.WithError(err).Error("Error while processing batch")
+			return err
+		}
 	}
+	return nil
 }
 
-func (p *Pipeline) runBatch(batchCount int, batchSize int, skipTargets bool) error {
+func (p *Pipeline) runBatch(batchSize int, skipTargets bool, stopStage string) error {
 	p.errorSink.ClearErrorRecordsAndMessages()
+	p.eventSink.ClearEventRecords()
 	previousOffset := p.offsetTracker.GetOffset()
 	pipeBatch := runner.NewFullPipeBatch(p.offsetTracker, batchSize, p.errorSink, p.eventSink, true)
 
 	for _, pipe := range p.pipes {
 		if !(skipTargets && pipe.IsTarget()) {
 			if stageOutputJson, ok := p.stagesToSkip[pipe.GetInstanceName()]; ok {
-				stageOutput, _ := execution.NewStageOutput(pipe.GetStageContext(), stageOutputJson)
-				pipeBatch.OverrideStageOutput(pipe, stageOutput)
-			} else {
-				err := pipe.Process(pipeBatch)
+				stageOutput, err := execution.NewStageOutput(pipe.GetStageContext(), stageOutputJson)
 				if err != nil {
-					log.WithError(err).Error()
+					return err
 				}
+				pipeBatch.OverrideStageOutput(pipe, stageOutput)
+			} else if err := pipe.Process(pipeBatch); err != nil {
+				return err
 			}
 		}
+		if pipe.GetInstanceName() == stopStage {
+			break
+		}
 	}
 
 	errorRecords := make([]api.Record, 0)
@@ -118,9 +131,39 @@ func (p *Pipeline) runBatch(batchCount int, batchSize int, skipTargets bool) err
 		}
 	}
 
-	p.BatchesOutput[batchCount] = pipeBatch.GetSnapshotsOfAllStagesOutput()
+	batchOutput := pipeBatch.GetSnapshotsOfAllStagesOutput()
+	p.batchesMutex.Lock()
+	p.BatchesOutput = append(p.BatchesOutput, batchOutput)
+	p.batchesMutex.Unlock()
 
-	return nil
+	// The preview offset is kept in memory only, the next batch continues where this one ended
+	return p.offsetTracker.CommitOffset()
+}
+
+// Cancel stops the preview after the batch in progress, the stages are told to stop producing
+func (p *Pipeline) Cancel() {
+	for _, stagePipe := range p.pipes {
+		stagePipe.GetStageContext().SetStop()
+	}
+	p.stopOnce.Do(func() {
+		close(p.stopChan)
+	})
+}
+
+// GetBatchesOutput returns the output of the batches previewed so far, it can be called while the preview runs
+func (p *Pipeline) GetBatchesOutput() [][]execution.StageOutput {
+	p.batchesMutex.Lock()
+	defer p.batchesMutex.Unlock()
+	return append([][]execution.StageOutput{}, p.BatchesOutput...)
+}
+
+func (p *Pipeline) isCancelled() bool {
+	select {
+	case <-p.stopChan:
+		return true
+	default:
+		return false
+	}
 }
 
 func (p *Pipeline) Stop() {
@@ -129,7 +172,6 @@ func (p *Pipeline) Stop() {
 		stagePipe.Destroy()
 	}
 	p.errorStageRuntime.Destroy()
-	p.stop = true
 }
 
 func NewPreviewPipeline(
@@ -170,6 +212,7 @@ func NewPreviewPipeline(
 			errorSink,
 			false,
 			pipelineConfigForParam.ErrorRecordPolicy,
+			stageBean.SystemConfigs.StageOnRecordError,
 			services,
 			pipelineBean.ElContext,
 			eventSink,
@@ -196,6 +239,7 @@ func NewPreviewPipeline(
 		errorSink,
 		true,
 		pipelineConfigForParam.ErrorRecordPolicy,
+		"",
 		nil,
 		pipelineBean.ElContext,
 		eventSink,
@@ -220,6 +264,7 @@ func NewPreviewPipeline(
 		errorSink:         errorSink,
 		eventSink:         eventSink,
 		offsetTracker:     sourceOffsetTracker,
+		stopChan:          make(chan struct{}),
 	}
 
 	return p, issues
@@ -29,7 +29,7 @@ type PreviewSourceOffsetTracker struct {
 var emptyOffset = ""
 
 func (o *PreviewSourceOffsetTracker) IsFinished() bool {
-	return false
+	return o.finished
 }
 
 func (o *PreviewSourceOffsetTracker) SetOffset(newOffset *string) {
@@ -38,7 +38,7 @@ func (o *PreviewSourceOffsetTracker) SetOffset(newOffset *string) {
 
 func (o *PreviewSourceOffsetTracker) CommitOffset() error {
 	o.currentOffset.Offset[common.PollSourceOffsetKey] = o.newOffset
-	o.finished = o.currentOffset.Offset[common.PollSourceOffsetKey] == &emptyOffset
+	o.finished = o.currentOffset.Offset[common.PollSourceOffsetKey] == nil
 	o.newOffset = &emptyOffset
 	return nil
 }
@@ -13,11 +13,15 @@
 package preview
 
 import (
+	"github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
 	"github.com/streamsets/datacollector-edge/api/validation"
 	"github.com/streamsets/datacollector-edge/container/common"
 	"github.com/streamsets/datacollector-edge/container/execution"
 	"github.com/streamsets/datacollector-edge/container/execution/runner"
 	pipelineStore "github.com/streamsets/datacollector-edge/container/store"
+	"sync"
+	"time"
 )
 
 const (
@@ -37,6 +41,9 @@ const (
 	Cancelled       = "CANCELLED"        // preview has been manually stopped
 	TimingOut       = "TIMING_OUT"       // preview/validate time out
 	TimedOut        = "TIMED_OUT"        // preview/validate time out
+
+	// TimeoutGracePeriod is how long a timed out preview waits for the cancelled stages to stop
+	TimeoutGracePeriod = 5 * time.Second
 )
 
 type SyncPreviewer struct {
@@ -48,40 +55,54 @@ type SyncPreviewer struct {
 	previewPipeline      *Pipeline
 	metricsEventRunnable *runner.MetricsEventRunnable
 	pipelineStoreTask    pipelineStore.PipelineStoreTask
+	cancelled            bool
+	timeoutGracePeriod   time.Duration
+	mutex                sync.RWMutex
 }
 
 func (p *SyncPreviewer) GetId() string {
 	return p.previewerId
 }
 
+// ValidateConfigs initializes and destroys the stages of the pipeline and reports the issues found. If the
+// validation takes longer than timeoutMillis the status is TIMED_OUT and the late result is ignored.
 func (p *SyncPreviewer) ValidateConfigs(timeoutMillis int64) error {
-	p.previewOutput.PreviewStatus = Validating
-	var err error
-	p.pipelineConfig, err = p.pipelineStoreTask.LoadPipelineConfig(p.pipelineId)
+	p.setStatus(Validating)
+	pipelineConfig, err := p.pipelineStoreTask.LoadPipelineConfig(p.pipelineId)
 	if err != nil {
-		p.previewOutput.PreviewStatus = ValidationError
-		p.previewOutput.Message = err.Error()
+		p.setError(ValidationError, err)
 		return err
 	}
 
-	previewPipeline, issues := NewPreviewPipeline(p.config, p.pipelineConfig)
+	previewPipeline, issues := NewPreviewPipeline(p.config, pipelineConfig)
 	if len(issues) > 0 {
-		p.previewOutput.PreviewStatus = ValidationError
-		p.previewOutput.Issues = validation.NewIssues(issues)
-		return err
+		p.setIssues(ValidationError, issues)
+		return nil
+	}
+
+	done := make(chan []validation.Issue, 1)
+	go func() {
+		done <- previewPipeline.ValidateConfigs()
+	}()
+
+	select {
+	case issues = <-done:
+	case <-getTimeout(timeoutMillis):
+		log.WithField("previewer", p.previewerId).Warn("Validation timed out")
+		p.setStatus(TimedOut)
+		return nil
 	}
 
-	issues = previewPipeline.ValidateConfigs()
-	p.previewOutput.Issues = validation.NewIssues(issues)
 	if len(issues) > 0 {
-		p.previewOutput.PreviewStatus = InValid
+		p.setIssues(InValid, issues)
 	} else {
-		p.previewOutput.PreviewStatus = Valid
+		p.setIssues(Valid, issues)
 	}
-
 	return nil
 }
 
+// Start runs the preview and blocks until it is finished, cancelled or timed out. If the preview takes longer
+// than timeoutMillis it is cancelled and the status is TIMED_OUT, the batches previewed so far are kept.
 func (p *SyncPreviewer) Start(
 	batches int,
 	batchSize int,
@@ -91,11 +112,11 @@ func (p *SyncPreviewer) Start(
 	timeoutMillis int64,
 	testOrigin bool,
 ) error {
-	p.previewOutput.PreviewStatus = Starting
+	p.setStatus(Starting)
 	var err error
 	p.pipelineConfig, err = p.pipelineStoreTask.LoadPipelineConfig(p.pipelineId)
 	if err != nil {
-		p.previewOutput.Message = err.Error()
+		p.setError(StartError, err)
 		return err
 	}
 
@@ -105,46 +126,151 @@ func (p *SyncPreviewer) Start(
 
 	previewPipeline, issues := NewPreviewPipeline(p.config, p.pipelineConfig)
 	if len(issues) > 0 {
-		p.previewOutput.PreviewStatus = StartError
-		p.previewOutput.Issues = validation.NewIssues(issues)
-		return err
+		p.setIssues(StartError, issues)
+		return nil
 	}
 
 	issues = previewPipeline.Init()
 	if len(issues) > 0 {
-		p.previewOutput.PreviewStatus = InValid
-		p.previewOutput.Issues = validation.NewIssues(issues)
+		previewPipeline.Stop()
+		p.setIssues(InValid, issues)
+		return nil
+	}
+
+	p.mutex.Lock()
+	if p.cancelled {
+		p.mutex.Unlock()
+		previewPipeline.Stop()
+		p.setStatus(Cancelled)
 		return nil
-	} else {
-		p.previewOutput.PreviewStatus = Running
 	}
+	p.previewPipeline = previewPipeline
+	p.previewOutput.PreviewStatus = Running
+	p.mutex.Unlock()
 
-	previewPipeline.Run(batches, batchSize, skipTargets, stopStage, stagesOverride)
+	done := make(chan error, 1)
+	go func() {
+		done <- previewPipeline.Run(batches, batchSize, skipTargets, stopStage, stagesOverride)
+	}()
 
-	previewOutput, err := execution.NewPreviewOutput(previewPipeline.BatchesOutput)
-	if err != nil {
-		p.previewOutput.PreviewStatus = RunError
-		p.previewOutput.Message = err.Error()
-		return err
+	timedOut := false
+	runEnded := true
+	var runErr error
+	select {
+	case runErr = <-done:
+	case <-getTimeout(timeoutMillis):
+		log.WithField("previewer", p.previewerId).Warn("Preview timed out")
+		timedOut = true
+		p.setStatus(TimingOut)
+		previewPipeline.Cancel()
+		select {
+		case runErr = <-done:
+		case <-time.After(p.timeoutGracePeriod):
+			// A stage ignores the cancel, the preview is reported as timed out without waiting for it
+			log.WithField("previewer", p.previewerId).Warn("Preview did not stop after it timed out")
+			runEnded = false
+		}
 	}
 
+	previewOutput, err := execution.NewPreviewOutput(previewPipeline.GetBatchesOutput())
+	p.mutex.Lock()
 	p.previewOutput.Output = previewOutput
-
 	p.previewOutput.PreviewStatus = Finishing
+	cancelled := p.cancelled
+	p.mutex.Unlock()
 
-	previewPipeline.Stop()
-	p.previewOutput.PreviewStatus = Finished
+	if runEnded {
+		previewPipeline.Stop()
+	} else {
+		// The stages are destroyed once the run returns, not while a stage is still running
+		go func() {
+			<-done
+			previewPipeline.Stop()
+		}()
+	}
+
+	switch {
+	case timedOut:
+		p.setStatus(TimedOut)
+	case cancelled:
+		p.setStatus(Cancelled)
+	case runErr != nil:
+		p.setError(RunError, runErr)
+	case err != nil:
+		p.setError(RunError, err)
+	default:
+		p.setStatus(Finished)
+	}
 	return nil
 }
 
+// Stop cancels the running preview, the batch in progress is completed first
 func (p *SyncPreviewer) Stop() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.cancelled {
+		return nil
+	}
+	p.cancelled = true
+	if p.previewPipeline != nil && p.previewOutput.PreviewStatus == Running {
+		p.previewOutput.PreviewStatus = Cancelling
+		p.previewPipeline.Cancel()
+	}
 	return nil
 }
 
 func (p *SyncPreviewer) GetStatus() string {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
 	return p.previewOutput.PreviewStatus
 }
 
 func (p *SyncPreviewer) GetOutput() execution.PreviewOutput {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
 	return p.previewOutput
 }
+
+func (p *SyncPreviewer) setStatus(status string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.previewOutput.PreviewStatus = status
+}
+
+func (p *SyncPreviewer) setError(status string, err error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.previewOutput.PreviewStatus = status
+	p.previewOutput.Message = err.Error()
+}
+
+func (p *SyncPreviewer) setIssues(status string, issues []validation.Issue) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.previewOutput.PreviewStatus = status
+	p.previewOutput.Issues = validation.NewIssues(issues)
+}
+
+// getTimeout returns a channel receiving once the timeout expired, a timeout of 0 or less never expires
+func getTimeout(timeoutMillis int64) <-chan time.Time {
+	if timeoutMillis <= 0 {
+		return nil
+	}
+	return time.After(time.Duration(timeoutMillis) * time.Millisecond)
+}
+
+// NewSyncPreviewer returns a previewer whose ValidateConfigs and Start block until they are done
+func NewSyncPreviewer(
+	pipelineId string,
+	config execution.Config,
+	pipelineStoreTask pipelineStore.PipelineStoreTask,
+) *SyncPreviewer {
+	return &SyncPreviewer{
+		pipelineId:         pipelineId,
+		previewerId:        uuid.NewV4().String(),
+		config:             config,
+		pipelineStoreTask:  pipelineStoreTask,
+		previewOutput:      execution.PreviewOutput{PreviewStatus: CREATED},
+		timeoutGracePeriod: TimeoutGracePeriod,
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package preview
+
+import (
+	"github.com/streamsets/datacollector-edge/api"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"github.com/streamsets/datacollector-edge/container/creation"
+	"github.com/streamsets/datacollector-edge/container/execution"
+	pipelineStore "github.com/streamsets/datacollector-edge/container/store"
+	"github.com/streamsets/datacollector-edge/stages/stagelibrary"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const (
+	previewTestLibrary     = "preview-test-lib"
+	previewTestOrigin      = "countingOrigin"
+	previewTestSlowOrigin  = "slowOrigin"
+	previewTestStuckOrigin = "stuckOrigin"
+	previewTestProcessor   = "identityProcessor"
+	previewTestDestination = "nullDestination"
+	previewTestLastBatch   = 3
+)
+
+// countingOrigin produces one record per batch and finishes with the third batch
+type countingOrigin struct {
+	*common.BaseStage
+}
+
+func (o *countingOrigin) Produce(lastSourceOffset *string, maxBatchSize int, batchMaker api.BatchMaker) (*string, error) {
+	count, _ := strconv.Atoi(*lastSourceOffset)
+	count++
+	record, _ := o.GetStageContext().CreateRecord(strconv.Itoa(count), map[string]interface{}{"count": count})
+	batchMaker.AddRecord(record)
+	if count >= previewTestLastBatch {
+		return nil, nil
+	}
+	offset := strconv.Itoa(count)
+	return &offset, nil
+}
+
+// slowOrigin produces nothing until the pipeline is stopped
+type slowOrigin struct {
+	*common.BaseStage
+}
+
+func (o *slowOrigin) Produce(lastSourceOffset *string, maxBatchSize int, batchMaker api.BatchMaker) (*string, error) {
+	for !o.GetStageContext().IsStopped() {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return lastSourceOffset, nil
+}
+
+// stuckOrigin ignores the stop of the pipeline and produces nothing until the test releases it
+type stuckOrigin struct {
+	*common.BaseStage
+}
+
+var releaseStuckOrigin = make(chan struct{})
+
+func (o *stuckOrigin) Produce(lastSourceOffset *string, maxBatchSize int, batchMaker api.BatchMaker) (*string, error) {
+	<-releaseStuckOrigin
+	return lastSourceOffset, nil
+}
+
+type identityProcessor struct {
+	*common.BaseStage
+}
+
+func (p *identityProcessor) Process(batch api.Batch, batchMaker api.BatchMaker) error {
+	for _, record := range batch.GetRecords() {
+		batchMaker.AddRecord(record)
+	}
+	return nil
+}
+
+type nullDestination struct {
+	*common.BaseStage
+}
+
+func (d *nullDestination) Write(batch api.Batch) error {
+	return nil
+}
+
+// previewTestStoreTask returns the same pipeline configuration for every pipeline id
+type previewTestStoreTask struct {
+	pipelineStore.PipelineStoreTask
+	pipelineConfig common.PipelineConfiguration
+}
+
+func (s *previewTestStoreTask) LoadPipelineConfig(pipelineId string) (common.PipelineConfiguration, error) {
+	return s.pipelineConfig, nil
+}
+
+func init() {
+	stagelibrary.SetCreator(previewTestLibrary, previewTestOrigin, func() api.Stage {
+		return &countingOrigin{BaseStage: &common.BaseStage{}}
+	})
+	stagelibrary.SetCreator(previewTestLibrary, previewTestSlowOrigin, func() api.Stage {
+		return &slowOrigin{BaseStage: &common.BaseStage{}}
+	})
+	stagelibrary.SetCreator(previewTestLibrary, previewTestStuckOrigin, func() api.Stage {
+		return &stuckOrigin{BaseStage: &common.BaseStage{}}
+	})
+	stagelibrary.SetCreator(previewTestLibrary, previewTestProcessor, func() api.Stage {
+		return &identityProcessor{BaseStage: &common.BaseStage{}}
+	})
+	stagelibrary.SetCreator(previewTestLibrary, previewTestDestination, func() api.Stage {
+		return &nullDestination{BaseStage: &common.BaseStage{}}
+	})
+}
+
+func getPreviewTestStageConfig(instanceName string, stageName string, stageType string) *common.StageConfiguration {
+	return &common.StageConfiguration{
+		InstanceName:  instanceName,
+		Library:       previewTestLibrary,
+		StageName:     stageName,
+		Configuration: []common.Config{},
+		UiInfo:        map[string]interface{}{creation.STAGE_TYPE: stageType},
+		InputLanes:    []string{},
+		OutputLanes:   []string{},
+		EventLanes:    []string{},
+	}
+}
+
+func getPreviewTestPreviewer(originName string) *SyncPreviewer {
+	originConfig := getPreviewTestStageConfig("origin1", originName, creation.SOURCE)
+	originConfig.OutputLanes = []string{"lane1"}
+	processorConfig := getPreviewTestStageConfig("processor1", previewTestProcessor, creation.PROCESSOR)
+	processorConfig.InputLanes = []string{"lane1"}
+	processorConfig.OutputLanes = []string{"lane2"}
+	destinationConfig := getPreviewTestStageConfig("destination1", previewTestDestination, creation.TARGET)
+	destinationConfig.InputLanes = []string{"lane2"}
+	pipelineConfig := common.PipelineConfiguration{
+		PipelineId: "previewPipeline",
+		Stages:     []*common.StageConfiguration{originConfig, processorConfig, destinationConfig},
+		ErrorStage: getPreviewTestStageConfig("errorStage", previewTestDestination, creation.TARGET),
+	}
+
+	previewer, _ := NewAsyncPreviewer(
+		pipelineConfig.PipelineId,
+		execution.NewConfig(),
+		&previewTestStoreTask{pipelineConfig: pipelineConfig},
+	)
+	return previewer.(*AsyncPreviewer).syncPreviewer
+}
+
+func TestSyncPreviewer_Batches(t *testing.T) {
+	previewer := getPreviewTestPreviewer(previewTestOrigin)
+	if err := previewer.Start(10, 10, false, "", nil, 0, false); err != nil {
+		t.Fatal(err)
+	}
+
+	previewOutput := previewer.GetOutput()
+	if previewOutput.PreviewStatus != Finished {
+		t.Fatalf("Expected status %s, but got: %s %s", Finished, previewOutput.PreviewStatus, previewOutput.Message)
+	}
+	if len(previewOutput.Output) != previewTestLastBatch {
+		t.Fatalf("Expected %d batches until the origin finished, but got: %d", previewTestLastBatch, len(previewOutput.Output))
+	}
+	for i, batchOutput := range previewOutput.Output {
+		if len(batchOutput) != 3 {
+			t.Fatalf("Expected the output of 3 stages, but got: %d", len(batchOutput))
+		}
+		records := batchOutput[0].Output["lane1"]
+		if len(records) != 1 || records[0].Header.SourceId != strconv.Itoa(i+1) {
+			t.Errorf("Expected record %d in batch %d, but got: %+v", i+1, i, records)
+		}
+	}
+}
+
+func TestSyncPreviewer_StopStage(t *testing.T) {
+	previewer := getPreviewTestPreviewer(previewTestOrigin)
+	if err := previewer.Start(2, 10, false, "processor1", nil, 0, false); err != nil {
+		t.Fatal(err)
+	}
+
+	previewOutput := previewer.GetOutput()
+	if previewOutput.PreviewStatus != Finished || len(previewOutput.Output) != 2 {
+		t.Fatalf("Expected 2 finished batches, but got: %s %d", previewOutput.PreviewStatus, len(previewOutput.Output))
+	}
+	for _, batchOutput := range previewOutput.Output {
+		if len(batchOutput) != 2 || batchOutput[1].InstanceName != "processor1" {
+			t.Errorf("Expected the preview to stop at processor1, but got: %+v", batchOutput)
+		}
+	}
+}
+
+func TestSyncPreviewer_Timeout(t *testing.T) {
+	previewer := getPreviewTestPreviewer(previewTestSlowOrigin)
+	if err := previewer.Start(1, 10, true, "", nil, 50, false); err != nil {
+		t.Fatal(err)
+	}
+	if status := previewer.GetStatus(); status != TimedOut {
+		t.Errorf("Expected status %s, but got: %s", TimedOut, status)
+	}
+}
+
+func TestSyncPreviewer_TimeoutIgnoredByStage(t *testing.T) {
+	defer close(releaseStuckOrigin)
+	previewer := getPreviewTestPreviewer(previewTestStuckOrigin)
+	previewer.timeoutGracePeriod = 50 * time.Millisecond
+
+	started := time.Now()
+	if err := previewer.Start(1, 10, true, "", nil, 50, false); err != nil {
+		t.Fatal(err)
+	}
+	if status := previewer.GetStatus(); status != TimedOut {
+		t.Errorf("Expected status %s, but got: %s", TimedOut, status)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("Expected the preview to time out without waiting for the stage, but it took: %s", elapsed)
+	}
+}
+
+func TestAsyncPreviewer_Stop(t *testing.T) {
+	previewer := &AsyncPreviewer{syncPreviewer: getPreviewTestPreviewer(previewTestSlowOrigin)}
+	if err := previewer.Start(1, 10, true, "", nil, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	if status := previewer.GetStatus(); status != Starting && status != Running {
+		t.Fatalf("Expected the preview to run in the background, but got status: %s", status)
+	}
+
+	for previewer.GetStatus() != Running {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := previewer.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for previewer.GetStatus() != Cancelled && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if status := previewer.GetStatus(); status != Cancelled {
+		t.Errorf("Expected status %s, but got: %s", Cancelled, status)
+	}
+}
@@ -16,6 +16,8 @@ import (
 	"github.com/rcrowley/go-metrics"
 	"github.com/streamsets/datacollector-edge/api"
 	"github.com/streamsets/datacollector-edge/container/common"
+	"github.com/streamsets/datacollector-edge/container/execution/store"
+	"github.com/streamsets/datacollector-edge/container/recordio/sdcrecord"
 )
 
 type Runner interface {
@@ -29,6 +31,15 @@ type Runner interface {
 	CommitOffset(sourceOffset common.SourceOffset) error
 	GetOffset() (common.SourceOffset, error)
 	IsRemotePipeline() bool
-	GetErrorRecords(stageInstanceName string, size int) ([]api.Record, error)
-	GetErrorMessages(stageInstanceName string, size int) ([]api.ErrorMessage, error)
+	GetErrorRecords(stageInstanceName string, query store.ErrorQuery) ([]sdcrecord.SDCRecord, error)
+	GetErrorMessages(stageInstanceName string, query store.ErrorQuery) ([]api.ErrorMessage, error)
+	ReplayErrorRecords(stageInstanceName string, query store.ErrorQuery) (int, error)
+	GetAlerts() ([]*common.Alert, error)
+	DeleteAlert(ruleId string) (bool, error)
+	CaptureSnapshot(snapshotName string, label string, user string, batches int, batchSize int) (*store.SnapshotInfo, error)
+	GetSnapshotInfo(snapshotName string) (*store.SnapshotInfo, error)
+	GetSnapshotsInfo() ([]*store.SnapshotInfo, error)
+	GetSnapshot(snapshotName string) ([]byte, error)
+	DeleteSnapshot(snapshotName string) error
+	TapLane(lane string, samplingPercentage float64) (LaneTap, error)
 }
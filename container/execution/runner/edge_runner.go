@@ -16,16 +16,25 @@ import (
 	"errors"
 	"github.com/rcrowley/go-metrics"
 	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
 	"github.com/streamsets/datacollector-edge/api"
 	"github.com/streamsets/datacollector-edge/api/validation"
 	"github.com/streamsets/datacollector-edge/container/common"
 	"github.com/streamsets/datacollector-edge/container/execution"
 	"github.com/streamsets/datacollector-edge/container/execution/store"
+	"github.com/streamsets/datacollector-edge/container/recordio/sdcrecord"
 	pipelineStore "github.com/streamsets/datacollector-edge/container/store"
 	"github.com/streamsets/datacollector-edge/container/util"
+	"math"
+	"sync"
 	"time"
 )
 
+const (
+	RetryBaseDelay = 15 * time.Second
+	RetryMaxDelay  = 5 * time.Minute
+)
+
 var (
 	RestOffsetDisallowedStatuses = []string{
 		common.FINISHING,
@@ -34,6 +43,8 @@ var (
 		common.STARTING,
 		common.STOPPING,
 	}
+	// ActiveStatuses are the statuses of a pipeline which runs or is about to run
+	ActiveStatuses              = RestOffsetDisallowedStatuses
 	UpdateOffsetAllowedStatuses = []string{
 		common.EDITED,
 		common.FINISHED,
@@ -51,6 +62,12 @@ type EdgeRunner struct {
 	prodPipeline         *ProductionPipeline
 	metricsEventRunnable *MetricsEventRunnable
 	pipelineStoreTask    pipelineStore.PipelineStoreTask
+	retryTimer           *time.Timer
+	// stopRequested is set by StopPipeline, the run goroutine of a stopped pipeline never changes its state
+	stopRequested bool
+	// mutex guards pipelineState, prodPipeline, metricsEventRunnable, retryTimer and stopRequested, they are
+	// changed by the REST and Control Hub handlers as well as by the pipeline run goroutine and the retry timer
+	mutex sync.Mutex
 }
 
 func (edgeRunner *EdgeRunner) init() error {
@@ -73,11 +90,28 @@ func (edgeRunner *EdgeRunner) init() error {
 }
 
 func (edgeRunner *EdgeRunner) GetPipelineConfig() common.PipelineConfiguration {
+	edgeRunner.mutex.Lock()
+	defer edgeRunner.mutex.Unlock()
 	return edgeRunner.pipelineConfig
 }
 
 func (edgeRunner *EdgeRunner) GetStatus() (*common.PipelineState, error) {
-	return edgeRunner.pipelineState, nil
+	edgeRunner.mutex.Lock()
+	defer edgeRunner.mutex.Unlock()
+	return edgeRunner.getStateCopy(), nil
+}
+
+// getStateCopy returns a copy of the pipeline state which callers can read and marshal while the runner
+// keeps changing its own state, the mutex must be held
+func (edgeRunner *EdgeRunner) getStateCopy() *common.PipelineState {
+	pipelineState := *edgeRunner.pipelineState
+	if edgeRunner.pipelineState.Attributes != nil {
+		pipelineState.Attributes = make(map[string]interface{}, len(edgeRunner.pipelineState.Attributes))
+		for key, value := range edgeRunner.pipelineState.Attributes {
+			pipelineState.Attributes[key] = value
+		}
+	}
+	return &pipelineState
 }
 
 func (edgeRunner *EdgeRunner) GetHistory() ([]*common.PipelineState, error) {
@@ -85,14 +119,39 @@ func (edgeRunner *EdgeRunner) GetHistory() ([]*common.PipelineState, error) {
 }
 
 func (edgeRunner *EdgeRunner) GetMetrics() (metrics.Registry, error) {
-	if edgeRunner.prodPipeline != nil {
-		return edgeRunner.prodPipeline.MetricRegistry, nil
+	if prodPipeline := edgeRunner.getProdPipeline(); prodPipeline != nil {
+		return prodPipeline.MetricRegistry, nil
 	}
 	return nil, errors.New("pipeline is not running")
 }
 
+func (edgeRunner *EdgeRunner) getProdPipeline() *ProductionPipeline {
+	edgeRunner.mutex.Lock()
+	defer edgeRunner.mutex.Unlock()
+	return edgeRunner.prodPipeline
+}
+
+// getRunningProdPipeline returns the production pipeline when the pipeline is running, nil otherwise
+func (edgeRunner *EdgeRunner) getRunningProdPipeline() *ProductionPipeline {
+	edgeRunner.mutex.Lock()
+	defer edgeRunner.mutex.Unlock()
+	if edgeRunner.pipelineState.Status != common.RUNNING {
+		return nil
+	}
+	return edgeRunner.prodPipeline
+}
+
 func (edgeRunner *EdgeRunner) StartPipeline(
 	runtimeParameters map[string]interface{},
+) (*common.PipelineState, error) {
+	edgeRunner.mutex.Lock()
+	defer edgeRunner.mutex.Unlock()
+	return edgeRunner.startPipeline(runtimeParameters)
+}
+
+// startPipeline starts the pipeline, the mutex must be held
+func (edgeRunner *EdgeRunner) startPipeline(
+	runtimeParameters map[string]interface{},
 ) (*common.PipelineState, error) {
 	log.WithField("id", edgeRunner.pipelineId).Info("Starting pipeline")
 	var err error
@@ -108,6 +167,10 @@ func (edgeRunner *EdgeRunner) StartPipeline(
 		return nil, err
 	}
 
+	if edgeRunner.pipelineState.Status != common.RETRY {
+		edgeRunner.clearRetryAttempt()
+	}
+
 	var issues []validation.Issue
 	if edgeRunner.prodPipeline, issues = NewProductionPipeline(
 		edgeRunner.pipelineId,
@@ -123,25 +186,28 @@ func (edgeRunner *EdgeRunner) StartPipeline(
 		return edgeRunner.setStateToStartError(issues)
 	}
 
+	if statsAggregator := edgeRunner.prodPipeline.Pipeline.statsAggregator; statsAggregator != nil {
+		statsAggregator.sdcId = edgeRunner.runtimeInfo.ID
+	}
+
 	issues = edgeRunner.prodPipeline.Init()
 
 	if len(issues) != 0 {
 		return edgeRunner.setStateToStartError(issues)
 	}
 
-	go func() {
-		edgeRunner.prodPipeline.Run()
-		if edgeRunner.prodPipeline.Pipeline.offsetTracker.IsFinished() {
-			edgeRunner.pipelineState.Status = common.FINISHED
-			edgeRunner.pipelineState.TimeStamp = util.ConvertTimeToLong(time.Now())
-			err = store.SaveState(edgeRunner.pipelineId, edgeRunner.pipelineState)
-			if err != nil {
-				log.WithError(err).Error("Failed to save pipeline state to finished")
-			}
-		}
-	}()
+	edgeRunner.prodPipeline.Pipeline.onBatchSuccess = edgeRunner.resetRetryAttempt
+	edgeRunner.stopRequested = false
+
+	// The state is saved before the pipeline runs, a pipeline which fails or finishes right away must not
+	// have its final state overwritten by RUNNING
+	edgeRunner.pipelineState.Status = common.RUNNING
+	edgeRunner.pipelineState.TimeStamp = util.ConvertTimeToLong(time.Now())
+	if err = store.SaveState(edgeRunner.pipelineId, edgeRunner.pipelineState); err != nil {
+		return nil, err
+	}
 
-	if edgeRunner.runtimeInfo.DPMEnabled && edgeRunner.IsRemotePipeline() {
+	if edgeRunner.runtimeInfo.DPMEnabled && edgeRunner.isRemotePipeline() {
 		edgeRunner.metricsEventRunnable = NewMetricsEventRunnable(
 			edgeRunner.pipelineId,
 			edgeRunner.pipelineConfig,
@@ -152,14 +218,49 @@ func (edgeRunner *EdgeRunner) StartPipeline(
 		go edgeRunner.metricsEventRunnable.Run()
 	}
 
-	edgeRunner.pipelineState.Status = common.RUNNING
-	edgeRunner.pipelineState.TimeStamp = util.ConvertTimeToLong(time.Now())
+	prodPipeline := edgeRunner.prodPipeline
+	go func() {
+		err := prodPipeline.Run()
+		// The runnables are stopped without holding the mutex, which the batch and retry callbacks take as well
+		metricsEventRunnable := edgeRunner.runEnded(prodPipeline, err, runtimeParameters)
+		if metricsEventRunnable != nil {
+			metricsEventRunnable.Stop()
+		}
+	}()
 
-	if err = store.SaveState(edgeRunner.pipelineId, edgeRunner.pipelineState); err != nil {
-		return nil, err
-	}
+	return edgeRunner.getStateCopy(), nil
+}
 
-	return edgeRunner.pipelineState, nil
+// runEnded saves the state of the pipeline after its run ended, and returns the metrics event runnable to stop
+// once the mutex is released
+func (edgeRunner *EdgeRunner) runEnded(
+	prodPipeline *ProductionPipeline,
+	runError error,
+	runtimeParameters map[string]interface{},
+) *MetricsEventRunnable {
+	edgeRunner.mutex.Lock()
+	defer edgeRunner.mutex.Unlock()
+	if edgeRunner.stopRequested || prodPipeline != edgeRunner.prodPipeline {
+		// Pipeline was stopped, StopPipeline reports the final state even when the run outlasts the drain timeout
+		if runError != nil {
+			log.WithError(runError).Warn("Pipeline stopped with error")
+		}
+		return nil
+	}
+	if runError != nil {
+		metricsEventRunnable := edgeRunner.metricsEventRunnable
+		edgeRunner.metricsEventRunnable = nil
+		edgeRunner.handleRunError(runError, runtimeParameters)
+		return metricsEventRunnable
+	}
+	if prodPipeline.Pipeline.offsetTracker.IsFinished() || prodPipeline.Pipeline.isMaxBatchesReached() {
+		edgeRunner.pipelineState.Status = common.FINISHED
+		edgeRunner.pipelineState.TimeStamp = util.ConvertTimeToLong(time.Now())
+		if err := store.SaveState(edgeRunner.pipelineId, edgeRunner.pipelineState); err != nil {
+			log.WithError(err).Error("Failed to save pipeline state to finished")
+		}
+	}
+	return nil
 }
 
 func (edgeRunner *EdgeRunner) setStateToStartError(issues []validation.Issue) (*common.PipelineState, error) {
@@ -170,36 +271,147 @@ func (edgeRunner *EdgeRunner) setStateToStartError(issues []validation.Issue) (*
 	if err := store.SaveState(edgeRunner.pipelineId, edgeRunner.pipelineState); err != nil {
 		return nil, err
 	}
-	return edgeRunner.pipelineState, nil
+	return edgeRunner.getStateCopy(), nil
+}
+
+// handleRunError moves the pipeline to RUNNING_ERROR and then either schedules a retry with exponential
+// backoff or moves it to RUN_ERROR, depending on the pipeline retry configuration, the mutex must be held
+func (edgeRunner *EdgeRunner) handleRunError(runError error, runtimeParameters map[string]interface{}) {
+	edgeRunner.saveRunErrorState(common.RUNNING_ERROR, runError)
+
+	pipelineConfigBean := edgeRunner.prodPipeline.Pipeline.pipelineBean.Config
+	retryAttempt := cast.ToInt(edgeRunner.pipelineState.Attributes[store.RETRY_ATTEMPT]) + 1
+	if !pipelineConfigBean.ShouldRetry ||
+		(pipelineConfigBean.RetryAttempts >= 0 && float64(retryAttempt) > pipelineConfigBean.RetryAttempts) {
+		edgeRunner.saveRunErrorState(common.RUN_ERROR, runError)
+		return
+	}
+
+	retryDelay := getRetryDelay(retryAttempt)
+	edgeRunner.pipelineState.Attributes[store.RETRY_ATTEMPT] = retryAttempt
+	edgeRunner.pipelineState.Attributes[store.NEXT_RETRY_TIME_STAMP] =
+		util.ConvertTimeToLong(time.Now().Add(retryDelay))
+	edgeRunner.saveRunErrorState(common.RETRY, runError)
+
+	log.WithFields(log.Fields{
+		"id":      edgeRunner.pipelineId,
+		"attempt": retryAttempt,
+		"delay":   retryDelay,
+	}).Info("Scheduling pipeline retry")
+	edgeRunner.retryTimer = time.AfterFunc(retryDelay, func() {
+		edgeRunner.retry(runtimeParameters)
+	})
+}
+
+func (edgeRunner *EdgeRunner) saveRunErrorState(status string, runError error) {
+	edgeRunner.pipelineState.Status = status
+	edgeRunner.pipelineState.TimeStamp = util.ConvertTimeToLong(time.Now())
+	edgeRunner.pipelineState.Message = runError.Error()
+	if err := store.SaveState(edgeRunner.pipelineId, edgeRunner.pipelineState); err != nil {
+		log.WithError(err).Errorf("Failed to save pipeline state to %s", status)
+	}
+}
+
+func (edgeRunner *EdgeRunner) retry(runtimeParameters map[string]interface{}) {
+	edgeRunner.mutex.Lock()
+	defer edgeRunner.mutex.Unlock()
+	if edgeRunner.pipelineState.Status != common.RETRY {
+		// Pipeline was stopped while waiting for the retry
+		return
+	}
+	log.WithField("id", edgeRunner.pipelineId).Info("Retrying pipeline")
+	if _, err := edgeRunner.startPipeline(runtimeParameters); err != nil {
+		log.WithError(err).WithField("id", edgeRunner.pipelineId).Error("Failed to retry pipeline")
+	}
+}
+
+// resetRetryAttempt is called after every successful batch, the state is only persisted when a retry
+// attempt was recorded
+func (edgeRunner *EdgeRunner) resetRetryAttempt() {
+	edgeRunner.mutex.Lock()
+	defer edgeRunner.mutex.Unlock()
+	if cast.ToInt(edgeRunner.pipelineState.Attributes[store.RETRY_ATTEMPT]) == 0 {
+		return
+	}
+	edgeRunner.clearRetryAttempt()
+	if err := store.SaveState(edgeRunner.pipelineId, edgeRunner.pipelineState); err != nil {
+		log.WithError(err).Error("Failed to reset pipeline retry attempt")
+	}
+}
+
+func (edgeRunner *EdgeRunner) clearRetryAttempt() {
+	if edgeRunner.pipelineState.Attributes == nil {
+		edgeRunner.pipelineState.Attributes = make(map[string]interface{})
+	}
+	edgeRunner.pipelineState.Attributes[store.RETRY_ATTEMPT] = 0
+	delete(edgeRunner.pipelineState.Attributes, store.NEXT_RETRY_TIME_STAMP)
+}
+
+// getRetryDelay doubles the delay for every attempt, starting at RetryBaseDelay and capped at RetryMaxDelay
+func getRetryDelay(retryAttempt int) time.Duration {
+	retryDelay := float64(RetryBaseDelay) * math.Pow(2, float64(retryAttempt-1))
+	if retryDelay > float64(RetryMaxDelay) {
+		return RetryMaxDelay
+	}
+	return time.Duration(retryDelay)
 }
 
 func (edgeRunner *EdgeRunner) StopPipeline() (*common.PipelineState, error) {
 	log.WithField("id", edgeRunner.pipelineId).Info("Stopping pipeline")
+	edgeRunner.mutex.Lock()
 	var err error
 	err = edgeRunner.checkState(common.STOPPING)
 	if err != nil {
+		edgeRunner.mutex.Unlock()
 		return nil, err
 	}
 
-	if edgeRunner.prodPipeline != nil {
-		edgeRunner.prodPipeline.Stop()
+	retryPending := edgeRunner.pipelineState.Status == common.RETRY
+	if edgeRunner.retryTimer != nil {
+		edgeRunner.retryTimer.Stop()
 	}
 
-	if edgeRunner.metricsEventRunnable != nil {
-		edgeRunner.metricsEventRunnable.Stop()
+	edgeRunner.pipelineState.Status = common.STOPPING
+	edgeRunner.pipelineState.TimeStamp = util.ConvertTimeToLong(time.Now())
+	if err = store.SaveState(edgeRunner.pipelineId, edgeRunner.pipelineState); err != nil {
+		edgeRunner.mutex.Unlock()
+		return nil, err
+	}
+	edgeRunner.stopRequested = true
+	prodPipeline := edgeRunner.prodPipeline
+	edgeRunner.mutex.Unlock()
+
+	// The mutex is not held while draining, the in-flight batch updates the runner state when it succeeds
+	if prodPipeline != nil && !retryPending {
+		drainTimeout := time.Duration(edgeRunner.config.DrainTimeout) * time.Millisecond
+		if !prodPipeline.StopAndWait(drainTimeout) {
+			log.WithField("id", edgeRunner.pipelineId).
+				WithField("drainTimeout", drainTimeout).
+				Warn("Pipeline did not stop within the drain timeout, forcing stop")
+		}
 	}
 
+	edgeRunner.mutex.Lock()
+	metricsEventRunnable := edgeRunner.metricsEventRunnable
+	edgeRunner.metricsEventRunnable = nil
 	edgeRunner.pipelineState.Status = common.STOPPED
 	edgeRunner.pipelineState.TimeStamp = util.ConvertTimeToLong(time.Now())
 	err = store.SaveState(edgeRunner.pipelineId, edgeRunner.pipelineState)
+	pipelineState := edgeRunner.getStateCopy()
+	edgeRunner.mutex.Unlock()
+
+	if metricsEventRunnable != nil {
+		metricsEventRunnable.Stop()
+	}
 	if err != nil {
 		return nil, err
 	}
-
-	return edgeRunner.pipelineState, nil
+	return pipelineState, nil
 }
 
 func (edgeRunner *EdgeRunner) ResetOffset() error {
+	edgeRunner.mutex.Lock()
+	defer edgeRunner.mutex.Unlock()
 	if util.Contains(RestOffsetDisallowedStatuses, edgeRunner.pipelineState.Status) {
 		return errors.New("cannot reset the source offset when the pipeline is running")
 	}
@@ -208,6 +420,8 @@ func (edgeRunner *EdgeRunner) ResetOffset() error {
 }
 
 func (edgeRunner *EdgeRunner) CommitOffset(sourceOffset common.SourceOffset) error {
+	edgeRunner.mutex.Lock()
+	defer edgeRunner.mutex.Unlock()
 	if util.Contains(UpdateOffsetAllowedStatuses, edgeRunner.pipelineState.Status) {
 		return store.SaveOffset(edgeRunner.pipelineId, sourceOffset)
 	} else {
@@ -219,6 +433,7 @@ func (edgeRunner *EdgeRunner) GetOffset() (common.SourceOffset, error) {
 	return store.GetOffset(edgeRunner.pipelineId)
 }
 
+// checkState returns an error when the pipeline cannot change to the state, the mutex must be held
 func (edgeRunner *EdgeRunner) checkState(toState string) error {
 	supportedList := edgeRunner.validTransitions[edgeRunner.pipelineState.Status]
 	if !util.Contains(supportedList, toState) {
@@ -229,16 +444,112 @@ func (edgeRunner *EdgeRunner) checkState(toState string) error {
 }
 
 func (edgeRunner *EdgeRunner) IsRemotePipeline() bool {
+	edgeRunner.mutex.Lock()
+	defer edgeRunner.mutex.Unlock()
+	return edgeRunner.isRemotePipeline()
+}
+
+func (edgeRunner *EdgeRunner) isRemotePipeline() bool {
 	attributes := edgeRunner.pipelineState.Attributes
 	return attributes != nil && attributes[store.IS_REMOTE_PIPELINE] == true
 }
 
-func (edgeRunner *EdgeRunner) GetErrorRecords(stageInstanceName string, size int) ([]api.Record, error) {
-	return edgeRunner.prodPipeline.Pipeline.GetErrorRecords(stageInstanceName, size)
+// GetErrorRecords returns the retained error records of the stage, they are available while the pipeline is
+// not running and after a restart as well
+func (edgeRunner *EdgeRunner) GetErrorRecords(
+	stageInstanceName string,
+	query store.ErrorQuery,
+) ([]sdcrecord.SDCRecord, error) {
+	return edgeRunner.getErrorStore().GetErrorRecords(stageInstanceName, query)
+}
+
+func (edgeRunner *EdgeRunner) GetErrorMessages(
+	stageInstanceName string,
+	query store.ErrorQuery,
+) ([]api.ErrorMessage, error) {
+	return edgeRunner.getErrorStore().GetErrorMessages(stageInstanceName, query)
+}
+
+// ReplayErrorRecords feeds the retained error records of the stage matching the query back into the running
+// pipeline, starting at that stage. It returns the number of replayed records.
+func (edgeRunner *EdgeRunner) ReplayErrorRecords(stageInstanceName string, query store.ErrorQuery) (int, error) {
+	prodPipeline := edgeRunner.getRunningProdPipeline()
+	if prodPipeline == nil {
+		return 0, errors.New("cannot replay error records when the pipeline is not running")
+	}
+
+	errorRecords, err := edgeRunner.getErrorStore().GetErrorRecords(stageInstanceName, query)
+	if err != nil {
+		return 0, err
+	}
+	// Records are retained newest first, they are replayed in the order they failed
+	for i, j := 0, len(errorRecords)-1; i < j; i, j = i+1, j-1 {
+		errorRecords[i], errorRecords[j] = errorRecords[j], errorRecords[i]
+	}
+	return prodPipeline.Pipeline.ReplayErrorRecords(stageInstanceName, errorRecords)
+}
+
+// GetAlerts returns the alerts raised by the running pipeline, alerts are not kept when the pipeline stops
+func (edgeRunner *EdgeRunner) GetAlerts() ([]*common.Alert, error) {
+	if prodPipeline := edgeRunner.getProdPipeline(); prodPipeline != nil {
+		return prodPipeline.Pipeline.GetAlerts(), nil
+	}
+	return []*common.Alert{}, nil
+}
+
+func (edgeRunner *EdgeRunner) DeleteAlert(ruleId string) (bool, error) {
+	if prodPipeline := edgeRunner.getProdPipeline(); prodPipeline != nil {
+		return prodPipeline.Pipeline.DeleteAlert(ruleId), nil
+	}
+	return false, nil
+}
+
+// CaptureSnapshot captures the stage outputs of the next batches of the running pipeline as the named snapshot
+func (edgeRunner *EdgeRunner) CaptureSnapshot(
+	snapshotName string,
+	label string,
+	user string,
+	batches int,
+	batchSize int,
+) (*store.SnapshotInfo, error) {
+	prodPipeline := edgeRunner.getRunningProdPipeline()
+	if prodPipeline == nil {
+		return nil, errors.New("cannot capture a snapshot when the pipeline is not running")
+	}
+	return prodPipeline.Pipeline.CaptureSnapshot(snapshotName, label, user, batches, batchSize)
+}
+
+func (edgeRunner *EdgeRunner) GetSnapshotInfo(snapshotName string) (*store.SnapshotInfo, error) {
+	return store.GetSnapshotInfo(edgeRunner.pipelineId, snapshotName)
+}
+
+func (edgeRunner *EdgeRunner) GetSnapshotsInfo() ([]*store.SnapshotInfo, error) {
+	return store.GetSnapshotsInfo(edgeRunner.pipelineId)
+}
+
+// GetSnapshot returns the captured batches of the snapshot as SnapshotData JSON
+func (edgeRunner *EdgeRunner) GetSnapshot(snapshotName string) ([]byte, error) {
+	return store.GetSnapshotData(edgeRunner.pipelineId, snapshotName)
+}
+
+func (edgeRunner *EdgeRunner) DeleteSnapshot(snapshotName string) error {
+	if prodPipeline := edgeRunner.getProdPipeline(); prodPipeline != nil {
+		return prodPipeline.Pipeline.DeleteSnapshot(snapshotName)
+	}
+	return store.DeleteSnapshot(edgeRunner.pipelineId, snapshotName)
+}
+
+// TapLane streams sampled records of the lane of the running pipeline until the tap is closed
+func (edgeRunner *EdgeRunner) TapLane(lane string, samplingPercentage float64) (execution.LaneTap, error) {
+	prodPipeline := edgeRunner.getRunningProdPipeline()
+	if prodPipeline == nil {
+		return nil, errors.New("cannot tap a lane when the pipeline is not running")
+	}
+	return prodPipeline.Pipeline.TapLane(lane, samplingPercentage)
 }
 
-func (edgeRunner *EdgeRunner) GetErrorMessages(stageInstanceName string, size int) ([]api.ErrorMessage, error) {
-	return edgeRunner.prodPipeline.Pipeline.GetErrorMessages(stageInstanceName, size)
+func (edgeRunner *EdgeRunner) getErrorStore() *store.ErrorStore {
+	return store.GetErrorStore(edgeRunner.pipelineId, edgeRunner.config.Storage.ErrorRecordsRetention)
 }
 
 func NewEdgeRunner(
@@ -0,0 +1,283 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package runner
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/spf13/cast"
+	"github.com/streamsets/datacollector-edge/api"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"github.com/streamsets/datacollector-edge/container/creation"
+	"github.com/streamsets/datacollector-edge/container/execution"
+	"github.com/streamsets/datacollector-edge/container/execution/store"
+	pipelineStore "github.com/streamsets/datacollector-edge/container/store"
+	"github.com/streamsets/datacollector-edge/stages/stagelibrary"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+const (
+	failTestOriginName     = "failingOrigin"
+	slowFailTestOriginName = "slowFailingOrigin"
+)
+
+var slowFailTestOriginInstance *slowFailTestOrigin
+
+// failTestOrigin fails the first batch, the pipeline run ends right after it started
+type failTestOrigin struct {
+	*common.BaseStage
+}
+
+func (o *failTestOrigin) Produce(lastSourceOffset *string, maxBatchSize int, batchMaker api.BatchMaker) (*string, error) {
+	return nil, errors.New("origin unavailable")
+}
+
+// slowFailTestOrigin blocks in Produce until the release channel is closed and then fails the batch
+type slowFailTestOrigin struct {
+	*common.BaseStage
+	producing chan struct{}
+	release   chan struct{}
+}
+
+func (o *slowFailTestOrigin) Produce(lastSourceOffset *string, maxBatchSize int, batchMaker api.BatchMaker) (*string, error) {
+	select {
+	case o.producing <- struct{}{}:
+	default:
+	}
+	<-o.release
+	return nil, errors.New("origin unavailable")
+}
+
+func init() {
+	stagelibrary.SetCreator(stopTestLibrary, failTestOriginName, func() api.Stage {
+		return &failTestOrigin{BaseStage: &common.BaseStage{}}
+	})
+	stagelibrary.SetCreator(stopTestLibrary, slowFailTestOriginName, func() api.Stage {
+		slowFailTestOriginInstance = &slowFailTestOrigin{
+			BaseStage: &common.BaseStage{},
+			producing: make(chan struct{}, 1),
+			release:   make(chan struct{}),
+		}
+		return slowFailTestOriginInstance
+	})
+}
+
+// testPipelineStoreTask only loads the pipeline configuration it was created with
+type testPipelineStoreTask struct {
+	pipelineStore.PipelineStoreTask
+	pipelineConfig common.PipelineConfiguration
+}
+
+func (s *testPipelineStoreTask) LoadPipelineConfig(pipelineId string) (common.PipelineConfiguration, error) {
+	return s.pipelineConfig, nil
+}
+
+func getEdgeRunnerForRetry(t *testing.T, pipelineConfigBean creation.PipelineConfigBean) *EdgeRunner {
+	var err error
+	store.BaseDir, err = ioutil.TempDir("", "edge_runner_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edgeRunner := &EdgeRunner{
+		pipelineId: "retryPipeline",
+		prodPipeline: &ProductionPipeline{
+			Pipeline: &Pipeline{pipelineBean: creation.PipelineBean{Config: pipelineConfigBean}},
+		},
+	}
+	if err := edgeRunner.init(); err != nil {
+		t.Fatal(err)
+	}
+	edgeRunner.pipelineState.Status = common.RUNNING
+	return edgeRunner
+}
+
+func TestGetRetryDelay(t *testing.T) {
+	expectedDelays := []time.Duration{
+		15 * time.Second,
+		30 * time.Second,
+		60 * time.Second,
+		120 * time.Second,
+		240 * time.Second,
+		RetryMaxDelay,
+		RetryMaxDelay,
+	}
+	for i, expectedDelay := range expectedDelays {
+		if retryDelay := getRetryDelay(i + 1); retryDelay != expectedDelay {
+			t.Errorf("Expected delay %v for attempt %d, but got: %v", expectedDelay, i+1, retryDelay)
+		}
+	}
+}
+
+func TestEdgeRunner_HandleRunErrorRetry(t *testing.T) {
+	edgeRunner := getEdgeRunnerForRetry(t, creation.PipelineConfigBean{ShouldRetry: true, RetryAttempts: 1})
+	defer os.RemoveAll(store.BaseDir)
+
+	edgeRunner.handleRunError(errors.New("destination unavailable"), nil)
+	edgeRunner.retryTimer.Stop()
+
+	pipelineState, err := store.GetState(edgeRunner.pipelineId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pipelineState.Status != common.RETRY {
+		t.Errorf("Expected state %s, but got: %s", common.RETRY, pipelineState.Status)
+	}
+	if cast.ToInt(pipelineState.Attributes[store.RETRY_ATTEMPT]) != 1 {
+		t.Errorf("Expected retry attempt 1, but got: %v", pipelineState.Attributes[store.RETRY_ATTEMPT])
+	}
+	if pipelineState.Attributes[store.NEXT_RETRY_TIME_STAMP] == nil {
+		t.Error("Expected next retry time stamp to be recorded")
+	}
+
+	// Second failure exceeds the configured retry attempts
+	edgeRunner.pipelineState.Status = common.RUNNING
+	edgeRunner.handleRunError(errors.New("destination unavailable"), nil)
+	if edgeRunner.pipelineState.Status != common.RUN_ERROR {
+		t.Errorf("Expected state %s, but got: %s", common.RUN_ERROR, edgeRunner.pipelineState.Status)
+	}
+
+	edgeRunner.resetRetryAttempt()
+	pipelineState, err = store.GetState(edgeRunner.pipelineId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cast.ToInt(pipelineState.Attributes[store.RETRY_ATTEMPT]) != 0 {
+		t.Errorf("Expected retry attempt to be reset, but got: %v", pipelineState.Attributes[store.RETRY_ATTEMPT])
+	}
+	if _, ok := pipelineState.Attributes[store.NEXT_RETRY_TIME_STAMP]; ok {
+		t.Error("Expected next retry time stamp to be cleared")
+	}
+}
+
+func TestEdgeRunner_HandleRunErrorNoRetry(t *testing.T) {
+	edgeRunner := getEdgeRunnerForRetry(t, creation.PipelineConfigBean{ShouldRetry: false})
+	defer os.RemoveAll(store.BaseDir)
+
+	edgeRunner.handleRunError(errors.New("destination unavailable"), nil)
+
+	if edgeRunner.retryTimer != nil {
+		t.Error("Expected no retry to be scheduled")
+	}
+	if edgeRunner.pipelineState.Status != common.RUN_ERROR {
+		t.Errorf("Expected state %s, but got: %s", common.RUN_ERROR, edgeRunner.pipelineState.Status)
+	}
+}
+
+// getEdgeRunnerForOrigin returns a runner of a pipeline with the test origin which does not retry on errors
+func getEdgeRunnerForOrigin(t *testing.T, originName string) *EdgeRunner {
+	originConfig := getPushTestStageConfig("origin1", originName, creation.SOURCE)
+	originConfig.Library = stopTestLibrary
+	originConfig.OutputLanes = []string{"lane1"}
+	destinationConfig := getPushTestStageConfig("destination1", pushTestDestinationName, creation.TARGET)
+	destinationConfig.InputLanes = []string{"lane1"}
+	pipelineConfig := common.PipelineConfiguration{
+		PipelineId:    originName + "Pipeline",
+		Configuration: []common.Config{{Name: creation.ShouldRetry, Value: false}},
+		Stages:        []*common.StageConfiguration{originConfig, destinationConfig},
+		ErrorStage:    getPushTestStageConfig("errorStage", pushTestDestinationName, creation.TARGET),
+	}
+
+	edgeRunner := &EdgeRunner{
+		pipelineId:        pipelineConfig.PipelineId,
+		config:            execution.NewConfig(),
+		runtimeInfo:       &common.RuntimeInfo{},
+		pipelineStoreTask: &testPipelineStoreTask{pipelineConfig: pipelineConfig},
+	}
+	if err := edgeRunner.init(); err != nil {
+		t.Fatal(err)
+	}
+	return edgeRunner
+}
+
+func TestEdgeRunner_StartPipelineRunFailsRightAway(t *testing.T) {
+	var err error
+	store.BaseDir, err = ioutil.TempDir("", "edge_runner_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store.BaseDir)
+
+	edgeRunner := getEdgeRunnerForOrigin(t, failTestOriginName)
+	if _, err := edgeRunner.StartPipeline(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The status is read and marshalled while the run goroutine changes it, run with -race
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pipelineState, err := edgeRunner.GetStatus()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := json.Marshal(pipelineState); err != nil {
+			t.Fatal(err)
+		}
+		if pipelineState.Status == common.RUN_ERROR {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected state %s, but got: %s", common.RUN_ERROR, pipelineState.Status)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// The final state is not overwritten by RUNNING
+	time.Sleep(20 * time.Millisecond)
+	pipelineState, err := store.GetState(edgeRunner.pipelineId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pipelineState.Status != common.RUN_ERROR {
+		t.Errorf("Expected saved state %s, but got: %s", common.RUN_ERROR, pipelineState.Status)
+	}
+}
+
+func TestEdgeRunner_StopPipelineDrainTimeout(t *testing.T) {
+	var err error
+	store.BaseDir, err = ioutil.TempDir("", "edge_runner_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store.BaseDir)
+
+	edgeRunner := getEdgeRunnerForOrigin(t, slowFailTestOriginName)
+	edgeRunner.config.DrainTimeout = 10
+	if _, err := edgeRunner.StartPipeline(nil); err != nil {
+		t.Fatal(err)
+	}
+	<-slowFailTestOriginInstance.producing
+
+	pipelineState, err := edgeRunner.StopPipeline()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pipelineState.Status != common.STOPPED {
+		t.Fatalf("Expected state %s, but got: %s", common.STOPPED, pipelineState.Status)
+	}
+
+	// The run fails after the drain timeout, the stopped pipeline is neither moved to an error state nor retried
+	close(slowFailTestOriginInstance.release)
+	<-edgeRunner.getProdPipeline().Pipeline.runDone
+	time.Sleep(20 * time.Millisecond)
+
+	if pipelineState, err = store.GetState(edgeRunner.pipelineId); err != nil {
+		t.Fatal(err)
+	}
+	if pipelineState.Status != common.STOPPED {
+		t.Errorf("Expected saved state %s, but got: %s", common.STOPPED, pipelineState.Status)
+	}
+}
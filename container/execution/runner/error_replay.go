@@ -0,0 +1,152 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package runner
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/streamsets/datacollector-edge/api"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"github.com/streamsets/datacollector-edge/container/recordio/sdcrecord"
+	"time"
+)
+
+const (
+	// ReplayedRecordAttribute marks records which were replayed from the retained error records
+	ReplayedRecordAttribute    = "sdc.replayed"
+	PipelineReplayedRecords    = "pipeline.replayedRecords"
+	replayStageNotFoundError   = "CONTAINER_0055 - Stage '%s' not found in the pipeline"
+	replayPipelineStoppedError = "CONTAINER_0056 - Pipeline is stopping, error records were not replayed"
+)
+
+// ReplayErrorRecords feeds error records back into the pipeline starting at the stage which reported them.
+// Records of the origin are passed to the stages following the origin. The replayed batch runs with the same
+// stage instances and sinks as the regular batches and is serialized with them, offsets are not committed.
+func (p *Pipeline) ReplayErrorRecords(stageInstanceName string, errorRecords []sdcrecord.SDCRecord) (int, error) {
+	if len(errorRecords) == 0 {
+		return 0, nil
+	}
+
+	var pipes []Pipe
+	var errorSink *common.ErrorSink
+	var eventSink *common.EventSink
+	if p.runners != nil {
+		// Push origins, the replayed batch is processed by an idle runner
+		var runner *pipeRunner
+		select {
+		case runner = <-p.idleRunners:
+		case <-p.stopChan:
+			return 0, fmt.Errorf(replayPipelineStoppedError)
+		}
+		defer func() {
+			p.idleRunners <- runner
+		}()
+		pipes, errorSink, eventSink = runner.pipes, runner.errorSink, runner.eventSink
+	} else {
+		p.batchMutex.Lock()
+		defer p.batchMutex.Unlock()
+		if p.spoolQueue != nil {
+			pipes, errorSink, eventSink = p.pipes[1:], p.drainErrorSink, p.drainEventSink
+		} else {
+			pipes, errorSink, eventSink = p.pipes[1:], p.errorSink, p.eventSink
+		}
+	}
+	if p.isStopped() {
+		return 0, fmt.Errorf(replayPipelineStoppedError)
+	}
+
+	// Lanes which carry the replayed records and the records derived from them
+	replayLanes := make(map[string]bool)
+	var startPipe *StagePipe
+	var startLanes []string
+	if originPipe := p.pipes[0].(*StagePipe); originPipe.GetInstanceName() == stageInstanceName {
+		startPipe = originPipe
+		startLanes = originPipe.OutputLanes
+	} else {
+		for _, pipe := range pipes {
+			if pipe.GetInstanceName() == stageInstanceName {
+				startPipe = pipe.(*StagePipe)
+				break
+			}
+		}
+		if startPipe == nil {
+			return 0, fmt.Errorf(replayStageNotFoundError, stageInstanceName)
+		}
+		startLanes = startPipe.InputLanes
+	}
+	if len(startLanes) == 0 {
+		return 0, fmt.Errorf(replayStageNotFoundError, stageInstanceName)
+	}
+	if startPipe == p.pipes[0] {
+		replayLanes[startLanes[0]] = true
+	}
+
+	records := make([]api.Record, 0, len(errorRecords))
+	for i := range errorRecords {
+		record, err := sdcrecord.NewRecordFromSDCRecord(startPipe.GetStageContext(), &errorRecords[i])
+		if err != nil {
+			return 0, err
+		}
+		headerImpl := record.GetHeader().(*common.HeaderImpl)
+		if headerImpl.Attributes == nil {
+			headerImpl.Attributes = make(map[string]interface{})
+		}
+		headerImpl.SetAttribute(ReplayedRecordAttribute, "true")
+		records = append(records, record)
+	}
+
+	start := time.Now()
+	errorSink.ClearErrorRecordsAndMessages()
+	eventSink.ClearEventRecords()
+	pipeBatch := NewFullPipeBatch(&fixedOffsetTracker{}, len(records), errorSink, eventSink, false)
+	pipeBatch.(*FullPipeBatch).fullPayload[startLanes[0]] = records
+
+	// Only the start stage and the stages downstream of it process the replayed batch
+	for _, pipe := range pipes {
+		stagePipe := pipe.(*StagePipe)
+		if stagePipe != startPipe && !readsReplayLane(stagePipe, replayLanes) {
+			continue
+		}
+		if err := pipe.Process(pipeBatch); err != nil {
+			return 0, err
+		}
+		for _, lane := range append(stagePipe.OutputLanes, stagePipe.EventLanes...) {
+			replayLanes[lane] = true
+		}
+	}
+
+	if err := p.processErrorRecords(errorSink, nil); err != nil {
+		return 0, err
+	}
+	p.rulesEvaluator.evaluateDataRules(pipeBatch)
+
+	p.updateOutputRecordsMetrics(pipeBatch.GetOutputRecords())
+	p.updateErrorMetrics(pipeBatch.GetErrorRecords(), pipeBatch.GetErrorMessages())
+	p.retainErrors(errorSink)
+	p.replayedRecordsCounter.Inc(int64(len(records)))
+
+	log.WithField("stage", stageInstanceName).
+		WithField("records", len(records)).
+		WithField("duration", time.Since(start)).
+		Info("Replayed error records")
+	return len(records), nil
+}
+
+func readsReplayLane(stagePipe *StagePipe, replayLanes map[string]bool) bool {
+	for _, inputLane := range stagePipe.InputLanes {
+		if replayLanes[inputLane] {
+			return true
+		}
+	}
+	return false
+}
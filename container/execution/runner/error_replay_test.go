@@ -0,0 +1,127 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package runner
+
+import (
+	"github.com/rcrowley/go-metrics"
+	"github.com/streamsets/datacollector-edge/api"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"github.com/streamsets/datacollector-edge/container/creation"
+	"github.com/streamsets/datacollector-edge/container/execution"
+	"github.com/streamsets/datacollector-edge/container/execution/store"
+	"github.com/streamsets/datacollector-edge/container/recordio/sdcrecord"
+	"github.com/streamsets/datacollector-edge/stages/stagelibrary"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const replayTestDestinationName = "replayDestination"
+
+var replayTestDestinationInstance *replayTestDestination
+
+type replayTestDestination struct {
+	*common.BaseStage
+	records []api.Record
+}
+
+func (d *replayTestDestination) Write(batch api.Batch) error {
+	d.records = append(d.records, batch.GetRecords()...)
+	return nil
+}
+
+func init() {
+	stagelibrary.SetCreator(stopTestLibrary, replayTestDestinationName, func() api.Stage {
+		replayTestDestinationInstance = &replayTestDestination{BaseStage: &common.BaseStage{}}
+		return replayTestDestinationInstance
+	})
+}
+
+func TestPipeline_ReplayErrorRecords(t *testing.T) {
+	var err error
+	store.BaseDir, err = ioutil.TempDir("", "error_replay_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store.BaseDir)
+
+	originConfig := getPushTestStageConfig("origin1", stopTestOriginName, creation.SOURCE)
+	originConfig.Library = stopTestLibrary
+	originConfig.OutputLanes = []string{"lane1"}
+	destinationConfig := getPushTestStageConfig("destination1", replayTestDestinationName, creation.TARGET)
+	destinationConfig.Library = stopTestLibrary
+	destinationConfig.InputLanes = []string{"lane1"}
+	pipelineConfig := common.PipelineConfiguration{
+		PipelineId:    "replayPipeline",
+		Configuration: []common.Config{{Name: creation.DeliveryGuarantee, Value: AtLeastOnce}},
+		Stages:        []*common.StageConfiguration{originConfig, destinationConfig},
+		ErrorStage:    getPushTestStageConfig("errorStage", pushTestDestinationName, creation.TARGET),
+	}
+	if _, err := store.GetState(pipelineConfig.PipelineId); err != nil {
+		t.Fatal(err)
+	}
+	offsetTracker, err := NewProductionSourceOffsetTracker(pipelineConfig.PipelineId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline, issues := NewPipeline(execution.NewConfig(), pipelineConfig, offsetTracker, nil, metrics.NewRegistry())
+	if len(issues) > 0 {
+		t.Fatal(issues[0].Message)
+	}
+	if issues := pipeline.Init(); len(issues) > 0 {
+		t.Fatal(issues[0].Message)
+	}
+
+	errorRecords := make([]sdcrecord.SDCRecord, 0)
+	for _, value := range []string{"a", "b"} {
+		record, _ := pipeline.pipes[0].GetStageContext().CreateRecord(value, map[string]interface{}{"value": value})
+		record.GetHeader().(*common.HeaderImpl).SetErrorStageInstance("origin1")
+		sdcRecord, err := sdcrecord.NewSdcRecordFromRecord(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		errorRecords = append(errorRecords, *sdcRecord)
+	}
+
+	if _, err := pipeline.ReplayErrorRecords("unknown", errorRecords); err == nil {
+		t.Error("Expected an error replaying records of an unknown stage")
+	}
+
+	// Records of the origin are passed to the stages following the origin
+	replayedRecords, err := pipeline.ReplayErrorRecords("origin1", errorRecords)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replayedRecords != 2 || len(replayTestDestinationInstance.records) != 2 {
+		t.Fatalf("Expected 2 replayed records, but got: %d", len(replayTestDestinationInstance.records))
+	}
+	for _, record := range replayTestDestinationInstance.records {
+		if record.GetHeader().GetAttribute(ReplayedRecordAttribute) != "true" {
+			t.Errorf("Expected replayed record to have the %s header attribute", ReplayedRecordAttribute)
+		}
+	}
+	if value, _ := replayTestDestinationInstance.records[1].Get("/value"); value == nil || value.Value != "b" {
+		t.Errorf("Expected the replayed record value 'b', but got: %v", value)
+	}
+
+	// Records of the destination are written again by the destination
+	if _, err := pipeline.ReplayErrorRecords("destination1", errorRecords[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if len(replayTestDestinationInstance.records) != 3 {
+		t.Errorf("Expected 3 records written, but got: %d", len(replayTestDestinationInstance.records))
+	}
+	if count := pipeline.replayedRecordsCounter.Count(); count != 3 {
+		t.Errorf("Expected 3 replayed records in the metrics, but got: %d", count)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package runner
+
+import (
+	"fmt"
+	"github.com/streamsets/datacollector-edge/api"
+	"github.com/streamsets/datacollector-edge/container/execution"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	LaneTapBufferSize = 1000
+	unknownLaneError  = "CONTAINER_0061 - Lane '%s' does not exist in pipeline '%s'"
+)
+
+// laneTap buffers sampled records of a lane for a reader. Records are offered without blocking and dropped
+// when the buffer is full, so a slow reader never slows the pipeline down.
+type laneTap struct {
+	pipeline           *Pipeline
+	lane               string
+	samplingPercentage float64
+	records            chan api.Record
+	droppedRecords     int64
+	closeOnce          sync.Once
+}
+
+func (t *laneTap) GetLane() string {
+	return t.lane
+}
+
+func (t *laneTap) Records() <-chan api.Record {
+	return t.records
+}
+
+func (t *laneTap) GetDroppedRecords() int64 {
+	return atomic.LoadInt64(&t.droppedRecords)
+}
+
+func (t *laneTap) Close() {
+	t.pipeline.removeLaneTap(t)
+}
+
+func (t *laneTap) offer(records []api.Record) {
+	for _, record := range records {
+		if rand.Float64()*100 >= t.samplingPercentage {
+			continue
+		}
+		select {
+		case t.records <- record:
+		default:
+			atomic.AddInt64(&t.droppedRecords, 1)
+		}
+	}
+}
+
+// TapLane starts streaming the records of the lane sampled with the given percentage until the tap is closed
+// or the pipeline stops. Records are tapped once the batch is processed by all stages.
+func (p *Pipeline) TapLane(lane string, samplingPercentage float64) (execution.LaneTap, error) {
+	laneExists := false
+	for _, stageBean := range p.pipelineBean.Stages {
+		for _, stageLane := range append(stageBean.Config.OutputLanes, stageBean.Config.EventLanes...) {
+			laneExists = laneExists || stageLane == lane
+		}
+	}
+	if !laneExists {
+		return nil, fmt.Errorf(unknownLaneError, lane, p.pipelineConf.PipelineId)
+	}
+
+	tap := &laneTap{
+		pipeline:           p,
+		lane:               lane,
+		samplingPercentage: samplingPercentage,
+		records:            make(chan api.Record, LaneTapBufferSize),
+	}
+	p.laneTapsMutex.Lock()
+	defer p.laneTapsMutex.Unlock()
+	if p.laneTapsClosed {
+		tap.closeOnce.Do(func() {
+			close(tap.records)
+		})
+	} else {
+		p.laneTaps = append(p.laneTaps, tap)
+	}
+	return tap, nil
+}
+
+// tapLanes offers the records of the tapped lanes of a processed batch
+func (p *Pipeline) tapLanes(pipeBatch PipeBatch) {
+	p.laneTapsMutex.RLock()
+	defer p.laneTapsMutex.RUnlock()
+	for _, tap := range p.laneTaps {
+		tap.offer(pipeBatch.(*FullPipeBatch).fullPayload[tap.lane])
+	}
+}
+
+func (p *Pipeline) removeLaneTap(tap *laneTap) {
+	p.laneTapsMutex.Lock()
+	defer p.laneTapsMutex.Unlock()
+	for i, laneTap := range p.laneTaps {
+		if laneTap == tap {
+			p.laneTaps = append(p.laneTaps[:i], p.laneTaps[i+1:]...)
+			break
+		}
+	}
+	tap.closeOnce.Do(func() {
+		close(tap.records)
+	})
+}
+
+// closeLaneTaps closes the taps when the pipeline stops, taps added afterwards are closed right away
+func (p *Pipeline) closeLaneTaps() {
+	p.laneTapsMutex.Lock()
+	defer p.laneTapsMutex.Unlock()
+	for _, tap := range p.laneTaps {
+		tap.closeOnce.Do(func() {
+			close(tap.records)
+		})
+	}
+	p.laneTaps = nil
+	p.laneTapsClosed = true
+}
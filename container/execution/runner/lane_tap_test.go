@@ -0,0 +1,81 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package runner
+
+import (
+	"github.com/streamsets/datacollector-edge/api"
+	"github.com/streamsets/datacollector-edge/container/execution/store"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestPipeline_TapLane(t *testing.T) {
+	var err error
+	store.BaseDir, err = ioutil.TempDir("", "lane_tap_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store.BaseDir)
+
+	pipeline, _ := getStopTestPipeline(t)
+	close(stopTestOriginInstance.release)
+
+	if _, err := pipeline.TapLane("unknownLane", 100); err == nil {
+		t.Error("Expected an error tapping an unknown lane")
+	}
+	tap, err := pipeline.TapLane("lane1", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	skippedTap, err := pipeline.TapLane("lane1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pipeline.runBatch(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case record := <-tap.Records():
+		if record.GetHeader().GetSourceId() != "record1" {
+			t.Errorf("Expected the tapped record record1, but got: %s", record.GetHeader().GetSourceId())
+		}
+	default:
+		t.Fatal("Expected a tapped record")
+	}
+	if len(skippedTap.Records()) != 0 {
+		t.Error("Expected no records for a sampling percentage of 0")
+	}
+
+	// A full buffer drops records instead of blocking the pipeline
+	records := make([]api.Record, LaneTapBufferSize+5)
+	for i := range records {
+		records[i], _ = pipeline.pipes[0].GetStageContext().CreateRecord("record", "value")
+	}
+	tap.(*laneTap).offer(records)
+	if dropped := tap.GetDroppedRecords(); dropped != 5 {
+		t.Errorf("Expected 5 dropped records, but got: %d", dropped)
+	}
+
+	skippedTap.Close()
+	pipeline.closeLaneTaps()
+	received := 0
+	for range tap.Records() {
+		received++
+	}
+	if received != LaneTapBufferSize {
+		t.Errorf("Expected %d buffered records, but got: %d", LaneTapBufferSize, received)
+	}
+	tap.Close()
+}
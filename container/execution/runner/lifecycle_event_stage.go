@@ -0,0 +1,139 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package runner
+
+import (
+	"fmt"
+	"github.com/rcrowley/go-metrics"
+	"github.com/streamsets/datacollector-edge/api"
+	"github.com/streamsets/datacollector-edge/api/validation"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"github.com/streamsets/datacollector-edge/container/creation"
+)
+
+const (
+	PipelineStartEventType       = "pipeline-start"
+	PipelineStopEventType        = "pipeline-stop"
+	LifecycleEventVersion        = 1
+	StopReasonFinished           = "FINISHED"
+	StopReasonUserAction         = "USER_ACTION"
+	StopReasonFailure            = "FAILURE"
+	lifecycleEventRecordSourceId = "pipelineLifecycle"
+	lifecycleEventStageError     = "CONTAINER_0057 - Pipeline %s event stage '%s' failed: %s"
+)
+
+// LifecycleEventStage is a pipeline start or stop event stage, it gets a single lifecycle event record before
+// the first batch or after the last batch of the pipeline
+type LifecycleEventStage struct {
+	stageRuntime StageRuntime
+	errorSink    *common.ErrorSink
+	eventType    string
+}
+
+func (s *LifecycleEventStage) Init() []validation.Issue {
+	return s.stageRuntime.Init()
+}
+
+func (s *LifecycleEventStage) Destroy() {
+	s.stageRuntime.Destroy()
+}
+
+// handleEvent writes the lifecycle event record to the stage, an error record fails the event as well
+func (s *LifecycleEventStage) handleEvent(value map[string]interface{}) error {
+	instanceName := s.stageRuntime.config.InstanceName
+	record, err := s.stageRuntime.stageContext.CreateEventRecord(
+		lifecycleEventRecordSourceId,
+		value,
+		s.eventType,
+		LifecycleEventVersion,
+	)
+	if err != nil {
+		return fmt.Errorf(lifecycleEventStageError, s.eventType, instanceName, err.Error())
+	}
+
+	s.errorSink.ClearErrorRecordsAndMessages()
+	batch := NewBatchImpl(instanceName, []api.Record{record}, nil)
+	if _, err := s.stageRuntime.Execute(nil, -1, batch, nil); err != nil {
+		return fmt.Errorf(lifecycleEventStageError, s.eventType, instanceName, err.Error())
+	}
+	if errorRecords := s.errorSink.GetStageErrorRecords(instanceName); len(errorRecords) > 0 {
+		return fmt.Errorf(
+			lifecycleEventStageError,
+			s.eventType,
+			instanceName,
+			errorRecords[0].GetHeader().GetErrorMessage(),
+		)
+	}
+	return nil
+}
+
+func newPipelineStartEvent(pipelineConfig common.PipelineConfiguration, parameters map[string]interface{}) map[string]interface{} {
+	if parameters == nil {
+		parameters = make(map[string]interface{})
+	}
+	return map[string]interface{}{
+		"pipelineId":    pipelineConfig.PipelineId,
+		"pipelineTitle": pipelineConfig.Title,
+		"user":          pipelineConfig.Info.LastModifier,
+		"parameters":    parameters,
+	}
+}
+
+func newPipelineStopEvent(pipelineConfig common.PipelineConfiguration, reason string) map[string]interface{} {
+	return map[string]interface{}{
+		"pipelineId":    pipelineConfig.PipelineId,
+		"pipelineTitle": pipelineConfig.Title,
+		"user":          pipelineConfig.Info.LastModifier,
+		"reason":        reason,
+	}
+}
+
+func NewLifecycleEventStages(
+	pipelineBean creation.PipelineBean,
+	stageBeans []creation.StageBean,
+	eventType string,
+	resolvedParameters map[string]interface{},
+	metricRegistry metrics.Registry,
+) ([]*LifecycleEventStage, *validation.Issue) {
+	lifecycleEventStages := make([]*LifecycleEventStage, 0, len(stageBeans))
+	for _, stageBean := range stageBeans {
+		errorSink := common.NewErrorSink()
+		stageContext, err := common.NewStageContext(
+			stageBean.Config,
+			resolvedParameters,
+			metricRegistry,
+			errorSink,
+			false,
+			pipelineBean.Config.ErrorRecordPolicy,
+			"",
+			nil,
+			pipelineBean.ElContext,
+			common.NewEventSink(),
+			false,
+		)
+		if err != nil {
+			return nil, &validation.Issue{
+				InstanceName: stageBean.Config.InstanceName,
+				Level:        common.StageConfig,
+				Count:        1,
+				Message:      err.Error(),
+			}
+		}
+		lifecycleEventStages = append(lifecycleEventStages, &LifecycleEventStage{
+			stageRuntime: NewStageRuntime(pipelineBean, stageBean, stageContext),
+			errorSink:    errorSink,
+			eventType:    eventType,
+		})
+	}
+	return lifecycleEventStages, nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package runner
+
+import (
+	"github.com/rcrowley/go-metrics"
+	"github.com/streamsets/datacollector-edge/api"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"github.com/streamsets/datacollector-edge/container/creation"
+	"github.com/streamsets/datacollector-edge/container/execution"
+	"github.com/streamsets/datacollector-edge/container/execution/store"
+	"github.com/streamsets/datacollector-edge/stages/stagelibrary"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+const lifecycleTestDestinationName = "lifecycleDestination"
+
+var (
+	lifecycleTestRecords      []api.Record
+	lifecycleTestRecordsMutex sync.Mutex
+)
+
+type lifecycleTestDestination struct {
+	*common.BaseStage
+}
+
+func (d *lifecycleTestDestination) Write(batch api.Batch) error {
+	lifecycleTestRecordsMutex.Lock()
+	defer lifecycleTestRecordsMutex.Unlock()
+	lifecycleTestRecords = append(lifecycleTestRecords, batch.GetRecords()...)
+	return nil
+}
+
+func init() {
+	stagelibrary.SetCreator(stopTestLibrary, lifecycleTestDestinationName, func() api.Stage {
+		return &lifecycleTestDestination{BaseStage: &common.BaseStage{}}
+	})
+}
+
+func TestPipeline_LifecycleEvents(t *testing.T) {
+	var err error
+	store.BaseDir, err = ioutil.TempDir("", "lifecycle_event_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store.BaseDir)
+	lifecycleTestRecords = nil
+
+	originConfig := getPushTestStageConfig("origin1", stopTestOriginName, creation.SOURCE)
+	originConfig.Library = stopTestLibrary
+	originConfig.OutputLanes = []string{"lane1"}
+	destinationConfig := getPushTestStageConfig("destination1", pushTestDestinationName, creation.TARGET)
+	destinationConfig.InputLanes = []string{"lane1"}
+	startEventConfig := getPushTestStageConfig("startEvent", lifecycleTestDestinationName, creation.TARGET)
+	startEventConfig.Library = stopTestLibrary
+	stopEventConfig := getPushTestStageConfig("stopEvent", lifecycleTestDestinationName, creation.TARGET)
+	stopEventConfig.Library = stopTestLibrary
+	pipelineConfig := common.PipelineConfiguration{
+		PipelineId: "lifecyclePipeline",
+		Title:      "Lifecycle Pipeline",
+		Configuration: []common.Config{
+			{Name: creation.DeliveryGuarantee, Value: AtLeastOnce},
+			{Name: creation.Constants, Value: []interface{}{map[string]interface{}{"key": "param1", "value": "default"}}},
+		},
+		Stages:           []*common.StageConfiguration{originConfig, destinationConfig},
+		ErrorStage:       getPushTestStageConfig("errorStage", pushTestDestinationName, creation.TARGET),
+		StartEventStages: []*common.StageConfiguration{startEventConfig},
+		StopEventStages:  []*common.StageConfiguration{stopEventConfig},
+		Info:             common.PipelineInfo{LastModifier: "admin"},
+	}
+	if _, err := store.GetState(pipelineConfig.PipelineId); err != nil {
+		t.Fatal(err)
+	}
+	offsetTracker, err := NewProductionSourceOffsetTracker(pipelineConfig.PipelineId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline, issues := NewPipeline(
+		execution.NewConfig(),
+		pipelineConfig,
+		offsetTracker,
+		map[string]interface{}{"param1": "value1"},
+		metrics.NewRegistry(),
+	)
+	if len(issues) > 0 {
+		t.Fatal(issues[0].Message)
+	}
+	if issues := pipeline.Init(); len(issues) > 0 {
+		t.Fatal(issues[0].Message)
+	}
+
+	go pipeline.Run()
+	// The start event is handled before the first batch
+	<-stopTestOriginInstance.producing
+	lifecycleTestRecordsMutex.Lock()
+	if len(lifecycleTestRecords) != 1 {
+		t.Fatalf("Expected the start event record, but got: %d records", len(lifecycleTestRecords))
+	}
+	lifecycleTestRecordsMutex.Unlock()
+
+	close(stopTestOriginInstance.release)
+	if !pipeline.StopAndWait(5 * time.Second) {
+		t.Fatal("Expected pipeline to stop within the drain timeout")
+	}
+
+	if len(lifecycleTestRecords) != 2 {
+		t.Fatalf("Expected start and stop event records, but got: %d records", len(lifecycleTestRecords))
+	}
+	startEvent, stopEvent := lifecycleTestRecords[0], lifecycleTestRecords[1]
+	if eventType := startEvent.GetHeader().GetAttribute(api.EventRecordHeaderType); eventType != PipelineStartEventType {
+		t.Errorf("Expected event type %s, but got: %v", PipelineStartEventType, eventType)
+	}
+	if user, _ := startEvent.Get("/user"); user == nil || user.Value != "admin" {
+		t.Errorf("Expected the start event user admin, but got: %v", user)
+	}
+	if parameter, _ := startEvent.Get("/parameters/param1"); parameter == nil || parameter.Value != "value1" {
+		t.Errorf("Expected the start event parameter value1, but got: %v", parameter)
+	}
+	if eventType := stopEvent.GetHeader().GetAttribute(api.EventRecordHeaderType); eventType != PipelineStopEventType {
+		t.Errorf("Expected event type %s, but got: %v", PipelineStopEventType, eventType)
+	}
+	if reason, _ := stopEvent.Get("/reason"); reason == nil || reason.Value != StopReasonUserAction {
+		t.Errorf("Expected the stop reason %s, but got: %v", StopReasonUserAction, reason)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package runner
+
+import (
+	"context"
+	"fmt"
+	"github.com/rcrowley/go-metrics"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+	"github.com/streamsets/datacollector-edge/container/creation"
+	"github.com/streamsets/datacollector-edge/container/el"
+	"github.com/streamsets/datacollector-edge/container/util"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	MemoryLimitExceededStopPipeline = "STOP_PIPELINE"
+	MemoryLimitExceededLog          = "LOG"
+	MemoryLimitExceededAlert        = "ALERT"
+	PipelineMemoryLimit             = "pipeline.memoryLimit"
+	PipelineMemoryUsage             = "pipeline.memoryUsage"
+	PipelineMemoryLimitAlerts       = "pipeline.memoryLimitAlerts"
+	MemoryWatchdogInterval          = 5 * time.Second
+	memoryLimitExceededError        = "CONTAINER_0011 - Pipeline memory consumption %d MB exceeded allowed memory %d MB"
+	invalidMemoryLimitError         = "CONTAINER_0053 - Invalid memory limit '%s', expected a number of MB, " +
+		"a size with a B, KB, MB or GB unit or a percentage of the host memory"
+)
+
+var memoryLimitUnits = []struct {
+	suffix string
+	bytes  float64
+}{
+	{"KB", 1024},
+	{"MB", util.BytesPerMB},
+	{"GB", 1024 * util.BytesPerMB},
+	{"B", 1},
+}
+
+// MemoryWatchdog periodically compares the memory used by the edge process with the pipeline memory limit
+// and applies the configured memoryLimitExceeded action. The Go runtime can not attribute memory to a single
+// pipeline, so the memory of the whole process is measured.
+type MemoryWatchdog struct {
+	limit            int64
+	action           string
+	interval         time.Duration
+	getMemoryUsage   func() int64
+	stopPipeline     func(err error)
+	exceeded         bool
+	memoryUsageGauge metrics.Gauge
+	alertsCounter    metrics.Counter
+}
+
+// Run checks the memory usage every interval until the stop channel is closed
+func (w *MemoryWatchdog) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			w.check()
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (w *MemoryWatchdog) check() {
+	memoryUsage := w.getMemoryUsage()
+	w.memoryUsageGauge.Update(memoryUsage)
+	if memoryUsage <= w.limit {
+		w.exceeded = false
+		return
+	}
+
+	if w.exceeded {
+		// Exceeding the limit is reported once until the usage drops below the limit again
+		return
+	}
+	w.exceeded = true
+
+	err := fmt.Errorf(memoryLimitExceededError, memoryUsage/util.BytesPerMB, w.limit/util.BytesPerMB)
+	switch w.action {
+	case MemoryLimitExceededStopPipeline:
+		log.WithError(err).Error("Memory limit exceeded, stopping pipeline")
+		w.stopPipeline(err)
+	case MemoryLimitExceededAlert:
+		w.alertsCounter.Inc(1)
+		log.WithError(err).Warn("Memory limit exceeded")
+	default:
+		log.WithError(err).Warn("Memory limit exceeded")
+	}
+}
+
+// ParseMemoryLimit returns the memory limit in bytes, 0 if there is no limit. The limit is either a number
+// of MB like in Data Collector, a size with a B, KB, MB or GB unit, or a percentage of the host memory.
+// EL expressions like the default ${jvm:maxMemoryMB() * 0.65} are evaluated to a number of MB.
+func ParseMemoryLimit(memoryLimit string, elContext context.Context) (int64, error) {
+	memoryLimit = strings.TrimSpace(memoryLimit)
+	if len(memoryLimit) == 0 {
+		return 0, nil
+	}
+
+	if el.IsElString(memoryLimit) {
+		result, err := el.Evaluate(memoryLimit, creation.MemoryLimit, nil, elContext)
+		if err != nil {
+			return 0, err
+		}
+		memoryLimitMB, err := cast.ToFloat64E(result)
+		if err != nil {
+			return 0, fmt.Errorf(invalidMemoryLimitError, memoryLimit)
+		}
+		return int64(memoryLimitMB * util.BytesPerMB), nil
+	}
+
+	if strings.HasSuffix(memoryLimit, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(memoryLimit, "%")), 64)
+		if err != nil {
+			return 0, fmt.Errorf(invalidMemoryLimitError, memoryLimit)
+		}
+		totalMemory, err := util.GetTotalMemory()
+		if err != nil {
+			return 0, err
+		}
+		return int64(float64(totalMemory) * percent / 100), nil
+	}
+
+	unitBytes := float64(util.BytesPerMB)
+	value := strings.ToUpper(memoryLimit)
+	for _, unit := range memoryLimitUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			unitBytes = unit.bytes
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			break
+		}
+	}
+	size, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf(invalidMemoryLimitError, memoryLimit)
+	}
+	return int64(size * unitBytes), nil
+}
+
+func NewMemoryWatchdog(
+	limit int64,
+	action string,
+	stopPipeline func(err error),
+	metricRegistry metrics.Registry,
+) *MemoryWatchdog {
+	util.CreateGauge(metricRegistry, PipelineMemoryLimit).Update(limit)
+	return &MemoryWatchdog{
+		limit:            limit,
+		action:           action,
+		interval:         MemoryWatchdogInterval,
+		getMemoryUsage:   util.GetMemoryUsage,
+		stopPipeline:     stopPipeline,
+		memoryUsageGauge: util.CreateGauge(metricRegistry, PipelineMemoryUsage),
+		alertsCounter:    util.CreateCounter(metricRegistry, PipelineMemoryLimitAlerts),
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package runner
+
+import (
+	"context"
+	"github.com/rcrowley/go-metrics"
+	"github.com/streamsets/datacollector-edge/container/util"
+	"strings"
+	"testing"
+)
+
+func TestParseMemoryLimit(t *testing.T) {
+	memoryLimitTests := map[string]int64{
+		"":       0,
+		"0":      0,
+		"512":    512 * util.BytesPerMB,
+		"1.5GB":  1536 * util.BytesPerMB,
+		"256 mb": 256 * util.BytesPerMB,
+		"64KB":   64 * 1024,
+		"1000B":  1000,
+	}
+	for memoryLimit, expected := range memoryLimitTests {
+		limit, err := ParseMemoryLimit(memoryLimit, context.Background())
+		if err != nil {
+			t.Errorf("Failed to parse memory limit '%s': %s", memoryLimit, err)
+		} else if limit != expected {
+			t.Errorf("Expected %d bytes for memory limit '%s', but got: %d", expected, memoryLimit, limit)
+		}
+	}
+
+	if totalMemory, err := util.GetTotalMemory(); err == nil {
+		limit, err := ParseMemoryLimit("50%", context.Background())
+		if err != nil {
+			t.Error(err)
+		} else if limit != totalMemory/2 {
+			t.Errorf("Expected %d bytes for half of the host memory, but got: %d", totalMemory/2, limit)
+		}
+	}
+
+	for _, memoryLimit := range []string{"abc", "10TB", "%"} {
+		if _, err := ParseMemoryLimit(memoryLimit, context.Background()); err == nil ||
+			!strings.Contains(err.Error(), "CONTAINER_0053") {
+			t.Errorf("Expected invalid memory limit error for '%s', but got: %v", memoryLimit, err)
+		}
+	}
+}
+
+func TestMemoryWatchdog_Check(t *testing.T) {
+	var stopErrors []error
+	memoryUsage := int64(0)
+	metricRegistry := metrics.NewRegistry()
+	memoryWatchdog := NewMemoryWatchdog(
+		100*util.BytesPerMB,
+		MemoryLimitExceededStopPipeline,
+		func(err error) { stopErrors = append(stopErrors, err) },
+		metricRegistry,
+	)
+	memoryWatchdog.getMemoryUsage = func() int64 { return memoryUsage }
+
+	memoryUsage = 50 * util.BytesPerMB
+	memoryWatchdog.check()
+	if len(stopErrors) != 0 {
+		t.Fatal("Expected pipeline to keep running below the memory limit")
+	}
+
+	memoryUsage = 150 * util.BytesPerMB
+	memoryWatchdog.check()
+	memoryWatchdog.check()
+	if len(stopErrors) != 1 {
+		t.Fatalf("Expected pipeline to be stopped once, but got: %d", len(stopErrors))
+	}
+	if !strings.Contains(stopErrors[0].Error(), "CONTAINER_0011") {
+		t.Errorf("Unexpected error: %s", stopErrors[0])
+	}
+	if value := memoryWatchdog.memoryUsageGauge.Value(); value != memoryUsage {
+		t.Errorf("Expected memory usage gauge %d, but got: %d", memoryUsage, value)
+	}
+
+	memoryWatchdog.action = MemoryLimitExceededAlert
+	memoryUsage = 50 * util.BytesPerMB
+	memoryWatchdog.check()
+	memoryUsage = 150 * util.BytesPerMB
+	memoryWatchdog.check()
+	if count := memoryWatchdog.alertsCounter.Count(); count != 1 {
+		t.Errorf("Expected 1 memory limit alert, but got: %d", count)
+	}
+	if len(stopErrors) != 1 {
+		t.Error("Expected ALERT action not to stop the pipeline")
+	}
+}
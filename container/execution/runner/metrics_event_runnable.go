@@ -20,11 +20,13 @@ import (
 	"github.com/rcrowley/go-metrics"
 	log "github.com/sirupsen/logrus"
 	"github.com/streamsets/datacollector-edge/container/common"
+	"github.com/streamsets/datacollector-edge/container/controlhub/outbox"
 	"github.com/streamsets/datacollector-edge/container/creation"
 	"github.com/streamsets/datacollector-edge/container/util"
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 )
 
@@ -38,6 +40,12 @@ const (
 	DPM_JOB_ID                       = "dpm.job.id"
 	TIME_SERIES_ANALYSIS_PARAM_ID    = "TIME_SERIES_ANALYSIS"
 	TIME_SERIES_ANALYSIS_METADATA_ID = "timeSeriesAnalysis"
+	MetricsOutboxName                = "controlhub.metrics"
+)
+
+var (
+	metricsOutboxInstance *outbox.Outbox
+	metricsOutboxMutex    sync.RWMutex
 )
 
 type MetricsEventRunnable struct {
@@ -48,10 +56,7 @@ type MetricsEventRunnable struct {
 	runtimeInfo             *common.RuntimeInfo
 	quitSendingMetricsToDPM chan bool
 	remoteTimeSeriesUrl     string
-	pipelineCommitId        string
-	jobId                   string
 	waitTimeBetweenUpdates  int64
-	timeSeriesAnalysis      bool
 	metadata                map[string]string
 	httpClient              *http.Client
 }
@@ -99,28 +104,43 @@ func (m *MetricsEventRunnable) Stop() {
 
 func (m *MetricsEventRunnable) sendMetricsToDPM() error {
 	log.Debug("Sending metrics to Control Hub")
-	metricsJson := SDCMetrics{
-		Timestamp:   util.ConvertTimeToLong(time.Now()),
-		Metadata:    m.metadata,
-		SdcId:       m.runtimeInfo.ID,
-		Aggregated:  false,
-		MasterSdcId: "",
-		Metrics:     util.FormatMetricsRegistry(m.metricRegistry),
+	metricsJson, err := json.Marshal(newSDCMetrics(m.metadata, m.runtimeInfo.ID, m.metricRegistry))
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+
+	if metricsOutbox := getMetricsOutbox(); metricsOutbox != nil {
+		// The outbox sends the metrics in the background and keeps them while Control Hub is unreachable
+		return metricsOutbox.Add(outbox.Message{Target: m.remoteTimeSeriesUrl, Payload: metricsJson})
 	}
+	return postMetrics(m.httpClient, m.runtimeInfo, m.remoteTimeSeriesUrl, []json.RawMessage{metricsJson})
+}
 
-	jsonValue, err := json.Marshal([]SDCMetrics{metricsJson})
+// postMetrics posts a list of SDCMetrics to the Control Hub time series URL
+func postMetrics(
+	httpClient *http.Client,
+	runtimeInfo *common.RuntimeInfo,
+	remoteTimeSeriesUrl string,
+	metricsList []json.RawMessage,
+) error {
+	jsonValue, err := json.Marshal(metricsList)
 	if err != nil {
 		log.Println(err)
 		return err
 	}
 
-	req, err := http.NewRequest(common.HttpPost, m.remoteTimeSeriesUrl, bytes.NewBuffer(jsonValue))
-	req.Header.Set(common.HeaderXAppAuthToken, m.runtimeInfo.AppAuthToken)
-	req.Header.Set(common.HeaderXAppComponentId, m.runtimeInfo.ID)
+	req, err := http.NewRequest(common.HttpPost, remoteTimeSeriesUrl, bytes.NewBuffer(jsonValue))
+	if err != nil {
+		return err
+	}
+	appAuthToken := runtimeInfo.GetAppAuthToken()
+	req.Header.Set(common.HeaderXAppAuthToken, appAuthToken)
+	req.Header.Set(common.HeaderXAppComponentId, runtimeInfo.ID)
 	req.Header.Set(common.HeaderXRestCall, common.HeaderXRestCallValue)
 	req.Header.Set(common.HeaderContentType, common.ApplicationJson)
 
-	resp, err := m.httpClient.Do(req)
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return err
 	}
@@ -131,6 +151,13 @@ func (m *MetricsEventRunnable) sendMetricsToDPM() error {
 	}()
 
 	log.WithField("status", resp.Status).Debug("Control Hub Send Metrics Status")
+	if common.IsAppAuthTokenRejected(resp.StatusCode) {
+		// The metrics are sent again with the renewed token
+		if err := runtimeInfo.RenewAppAuthToken(appAuthToken); err != nil {
+			log.WithError(err).Error("Error while renewing the Control Hub app auth token")
+		}
+		return errors.New(fmt.Sprintf("Control Hub Send Metrics failed - %s ", resp.Status))
+	}
 	if resp.StatusCode != 200 {
 		responseData, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
@@ -155,27 +182,84 @@ func (m *MetricsEventRunnable) initializeDPMMetricsVariables() {
 		switch k {
 		case REMOTE_TIMESERIES_URL:
 			m.remoteTimeSeriesUrl = v.(string)
-		case PIPELINE_COMMIT_ID:
-			m.pipelineCommitId = v.(string)
-		case JOB_ID:
-			m.jobId = v.(string)
 		case UPDATE_WAIT_TIME_MS:
 			m.waitTimeBetweenUpdates = int64(v.(float64))
+		}
+	}
+
+	m.metadata = newMetricsMetadata(m.pipelineConfig, m.pipelineBean.Config.Constants)
+}
+
+// newMetricsMetadata returns the metadata sent along with the pipeline metrics, built from the Control Hub
+// pipeline constants and the pipeline metadata
+func newMetricsMetadata(
+	pipelineConfig common.PipelineConfiguration,
+	constants map[string]interface{},
+) map[string]string {
+	var pipelineCommitId, jobId string
+	var timeSeriesAnalysis bool
+	for k, v := range constants {
+		switch k {
+		case PIPELINE_COMMIT_ID:
+			pipelineCommitId = v.(string)
+		case JOB_ID:
+			jobId = v.(string)
 		case TIME_SERIES_ANALYSIS_PARAM_ID:
-			m.timeSeriesAnalysis = v.(bool)
+			timeSeriesAnalysis = v.(bool)
 		}
 	}
 
-	m.metadata = make(map[string]string)
-	m.metadata[DPM_PIPELINE_COMMIT_ID] = m.pipelineCommitId
-	m.metadata[DPM_JOB_ID] = m.jobId
-	m.metadata[TIME_SERIES_ANALYSIS_METADATA_ID] = strconv.FormatBool(m.timeSeriesAnalysis)
-	for k, v := range m.pipelineConfig.Metadata {
+	metadata := make(map[string]string)
+	metadata[DPM_PIPELINE_COMMIT_ID] = pipelineCommitId
+	metadata[DPM_JOB_ID] = jobId
+	metadata[TIME_SERIES_ANALYSIS_METADATA_ID] = strconv.FormatBool(timeSeriesAnalysis)
+	for k, v := range pipelineConfig.Metadata {
 		switch v.(type) {
 		case string:
-			m.metadata[k] = v.(string)
+			metadata[k] = v.(string)
 		}
 	}
+	return metadata
+}
+
+func newSDCMetrics(metadata map[string]string, sdcId string, metricRegistry metrics.Registry) SDCMetrics {
+	return SDCMetrics{
+		Timestamp:   util.ConvertTimeToLong(time.Now()),
+		Metadata:    metadata,
+		SdcId:       sdcId,
+		Aggregated:  false,
+		MasterSdcId: "",
+		Metrics:     util.FormatMetricsRegistry(metricRegistry),
+	}
+}
+
+// OpenMetricsOutbox queues the pipeline metrics for Control Hub in a persistent outbox in the directory, which
+// sends them in the background. Without outbox the metrics are sent directly and dropped if sending fails.
+func OpenMetricsOutbox(
+	dir string,
+	maxMessages int,
+	runtimeInfo *common.RuntimeInfo,
+	metricRegistry metrics.Registry,
+) error {
+	metricsOutbox, err := outbox.NewOutbox(MetricsOutboxName, dir, maxMessages, metricRegistry)
+	if err != nil {
+		return err
+	}
+	httpClient := &http.Client{}
+	go metricsOutbox.Run(func(remoteTimeSeriesUrl string, metricsList []json.RawMessage) error {
+		return postMetrics(httpClient, runtimeInfo, remoteTimeSeriesUrl, metricsList)
+	}, nil)
+
+	metricsOutboxMutex.Lock()
+	defer metricsOutboxMutex.Unlock()
+	metricsOutboxInstance = metricsOutbox
+	return nil
+}
+
+func getMetricsOutbox() *outbox.Outbox {
+	metricsOutboxMutex.RLock()
+	defer metricsOutboxMutex.RUnlock()
+	return metricsOutboxInstance
 }
 
 func NewMetricsEventRunnable(
@@ -121,6 +121,23 @@ func (s *StagePipe) Process(pipeBatch PipeBatch) error {
 	}
 	pipeBatch.CompleteStage(batchMaker)
 
+	s.updateMetrics(pipeBatch, batchMaker, int64(len(batchImpl.records)), start)
+	return nil
+}
+
+// CompletePushedBatch completes the origin stage for a batch pushed by a PushOrigin
+// and updates the stage metrics
+func (s *StagePipe) CompletePushedBatch(pipeBatch PipeBatch, batchMaker *BatchMakerImpl, start time.Time) {
+	pipeBatch.CompleteStage(batchMaker)
+	s.updateMetrics(pipeBatch, batchMaker, 0, start)
+}
+
+func (s *StagePipe) updateMetrics(
+	pipeBatch PipeBatch,
+	batchMaker *BatchMakerImpl,
+	inputRecordsCount int64,
+	start time.Time,
+) {
 	// Update metric registry
 	s.processingTimer.UpdateSince(start)
 
@@ -128,10 +145,11 @@ func (s *StagePipe) Process(pipeBatch PipeBatch) error {
 	errorSink := pipeBatch.GetErrorSink()
 	eventSink := pipeBatch.GetEventSink()
 
-	stageErrorRecordsCount := int64(len(errorSink.GetStageErrorRecords(instanceName)))
+	// Discarded records are reported as error records so input = output + error still holds
+	stageErrorRecordsCount := int64(len(errorSink.GetStageErrorRecords(instanceName))) +
+		errorSink.GetStageDiscardedRecords(instanceName)
 	stageErrorMessagesCount := int64(len(errorSink.GetStageErrorMessages(instanceName)))
 
-	inputRecordsCount := int64(len(batchImpl.records))
 	outputRecordsCount := batchMaker.GetSize()
 
 	if s.IsTarget() {
@@ -169,8 +187,6 @@ func (s *StagePipe) Process(pipeBatch PipeBatch) error {
 		s.outputRecordsPerLaneCounter[eventLane].Inc(laneCount)
 		s.outputRecordsPerLaneMeter[eventLane].Mark(laneCount)
 	}
-
-	return nil
 }
 
 func (s *StagePipe) Destroy() {
@@ -84,7 +84,8 @@ func (b *FullPipeBatch) CompleteStage(batchMaker *BatchMakerImpl) {
 	stageInstanceName := batchMaker.stagePipe.Stage.config.InstanceName
 	if batchMaker.stagePipe.IsSource() {
 		b.inputRecords += batchMaker.GetSize() +
-			int64(len(b.errorSink.GetStageErrorRecords(stageInstanceName)))
+			int64(len(b.errorSink.GetStageErrorRecords(stageInstanceName))) +
+			b.errorSink.GetStageDiscardedRecords(stageInstanceName)
 	}
 	if !batchMaker.stagePipe.IsTarget() {
 		outputLanes := batchMaker.stagePipe.Stage.config.OutputLanes
@@ -109,7 +110,8 @@ func (b *FullPipeBatch) CompleteStage(batchMaker *BatchMakerImpl) {
 	}
 
 	if batchMaker.stagePipe.IsTarget() {
-		b.outputRecords -= int64(len(b.errorSink.GetStageErrorRecords(stageInstanceName)))
+		b.outputRecords -= int64(len(b.errorSink.GetStageErrorRecords(stageInstanceName))) +
+			b.errorSink.GetStageDiscardedRecords(stageInstanceName)
 	}
 
 	b.eventRecords += int64(len(b.eventSink.GetStageEvents(stageInstanceName)))
@@ -136,7 +138,7 @@ func (b *FullPipeBatch) GetEventRecords() int64 {
 }
 
 func (b *FullPipeBatch) GetErrorRecords() int64 {
-	return b.errorSink.GetTotalErrorRecords()
+	return b.errorSink.GetTotalErrorRecords() + b.errorSink.GetTotalDiscardedRecords()
 }
 
 func (b *FullPipeBatch) GetErrorMessages() int64 {
@@ -20,7 +20,12 @@ import (
 	"github.com/streamsets/datacollector-edge/container/common"
 	"github.com/streamsets/datacollector-edge/container/creation"
 	"github.com/streamsets/datacollector-edge/container/execution"
+	"github.com/streamsets/datacollector-edge/container/execution/store"
+	"github.com/streamsets/datacollector-edge/container/notification"
+	"github.com/streamsets/datacollector-edge/container/recordio/sdcrecord"
 	"github.com/streamsets/datacollector-edge/container/util"
+	"math"
+	"sync"
 	"time"
 )
 
@@ -32,12 +37,55 @@ type Pipeline struct {
 	pipes             []Pipe
 	errorStageRuntime StageRuntime
 	offsetTracker     execution.SourceOffsetTracker
-	stop              bool
+	stopChan          chan struct{}
+	stopOnce          sync.Once
+	runDone           chan struct{}
+	forceStopped      bool
+	forceStopMutex    sync.Mutex
 	errorSink         *common.ErrorSink
 	eventSink         *common.EventSink
+	onBatchSuccess    func()
+	batchSize         int
+	rateLimiter       *TokenBucket
+	memoryWatchdog    *MemoryWatchdog
+	statsAggregator   *StatsAggregator
+	rulesEvaluator    *RulesEvaluator
+	startEventStages  []*LifecycleEventStage
+	stopEventStages   []*LifecycleEventStage
+	startParameters   map[string]interface{}
+	stopError         error
+	stopErrorMutex    sync.Mutex
+
+	// Store and forward, processors and destinations run in the drain loop with their own sinks
+	spoolQueue     *SpoolQueue
+	drainErrorSink *common.ErrorSink
+	drainEventSink *common.EventSink
+	produceDone    chan struct{}
+	drainWaitGroup sync.WaitGroup
+	drainError     error
+	errorMutex     sync.Mutex
+
+	// Serializes the batches processed by the pipeline stages with replayed error records
+	batchMutex sync.Mutex
+
+	// Snapshot being captured, push origin runners and the drain loop capture batches concurrently
+	snapshotCapture *snapshotCapture
+	snapshotMutex   sync.Mutex
+
+	// Live data taps of lanes, offered the records of every processed batch
+	laneTaps       []*laneTap
+	laneTapsClosed bool
+	laneTapsMutex  sync.RWMutex
+
+	// Push origins, every runner processes pushed batches with its own processor and destination instances
+	runners     []*pipeRunner
+	idleRunners chan *pipeRunner
+	pushMutex   sync.Mutex
 
 	MetricRegistry              metrics.Registry
 	batchProcessingTimer        metrics.Timer
+	rateLimitThrottleTimer      metrics.Timer
+	replayedRecordsCounter      metrics.Counter
 	batchCountCounter           metrics.Counter
 	batchInputRecordsCounter    metrics.Counter
 	batchOutputRecordsCounter   metrics.Counter
@@ -53,8 +101,7 @@ type Pipeline struct {
 	batchErrorRecordsHistogram  metrics.Histogram
 	batchErrorMessagesHistogram metrics.Histogram
 
-	stageToErrorRecordsMap  map[string][]api.Record
-	stageToErrorMessagesMap map[string][]api.ErrorMessage
+	errorStore *store.ErrorStore
 }
 
 const (
@@ -70,12 +117,12 @@ const (
 	PipelineOutputRecordsPerBatch = "pipeline.outputRecordsPerBatch"
 	PipelineErrorRecordsPerBatch  = "pipeline.errorRecordsPerBatch"
 	PipelineErrorsPerBatch        = "pipeline.errorsPerBatch"
-	MaxCountInCache               = 10
+	PipelineRateLimitThrottle     = "pipeline.rateLimitThrottle"
 )
 
 func (p *Pipeline) Init() []validation.Issue {
 	var issues []validation.Issue
-	for _, stagePipe := range p.pipes {
+	for _, stagePipe := range p.getAllPipes() {
 		stageIssues := stagePipe.Init()
 		issues = append(issues, stageIssues...)
 	}
@@ -83,30 +130,123 @@ func (p *Pipeline) Init() []validation.Issue {
 	errorStageIssues := p.errorStageRuntime.Init()
 	issues = append(issues, errorStageIssues...)
 
+	if p.statsAggregator != nil {
+		issues = append(issues, p.statsAggregator.Init()...)
+	}
+
+	for _, lifecycleEventStage := range append(p.startEventStages, p.stopEventStages...) {
+		issues = append(issues, lifecycleEventStage.Init()...)
+	}
+
 	return issues
 }
 
-func (p *Pipeline) Run() {
+// Run processes batches until the origin is finished or the pipeline is stopped.
+// The returned error is the one which stopped the pipeline, if any.
+func (p *Pipeline) Run() error {
 	log.Debug("Pipeline Run()")
 
+	defer close(p.runDone)
 	defer func() {
-		for _, stagePipe := range p.pipes {
+		for _, stagePipe := range p.getAllPipes() {
 			stagePipe.Destroy()
 		}
 		p.errorStageRuntime.Destroy()
+		if p.statsAggregator != nil {
+			p.statsAggregator.Stop()
+		}
+		for _, lifecycleEventStage := range append(p.startEventStages, p.stopEventStages...) {
+			lifecycleEventStage.Destroy()
+		}
+		p.finishSnapshot()
+		p.closeLaneTaps()
 	}()
 
-	for !p.offsetTracker.IsFinished() && !p.stop {
-		err := p.runBatch()
-		if err != nil {
-			log.WithError(err).Error("Error while processing batch")
+	if p.statsAggregator != nil {
+		go p.statsAggregator.Run()
+	}
+
+	startEvent := newPipelineStartEvent(p.pipelineConf, p.startParameters)
+	for _, startEventStage := range p.startEventStages {
+		if err := startEventStage.handleEvent(startEvent); err != nil {
+			log.WithError(err).Error("Pipeline start event failed")
+			return err
+		}
+	}
+
+	if p.spoolQueue != nil {
+		p.drainWaitGroup.Add(1)
+		go p.drain()
+	}
+
+	if p.memoryWatchdog != nil {
+		go p.memoryWatchdog.Run(p.stopChan)
+	}
+
+	go p.rulesEvaluator.Run(p.stopChan)
+
+	var runError error
+	if pushOrigin := p.getPushOrigin(); pushOrigin != nil {
+		if runError = p.runPushed(pushOrigin); runError != nil {
+			log.WithError(runError).Error("Push origin failed")
 			log.Info("Stopping Pipeline")
 			p.Stop()
 		}
+	} else {
+		for !p.offsetTracker.IsFinished() && !p.isStopped() && !p.isMaxBatchesReached() {
+			err := p.runBatch()
+			if err != nil {
+				log.WithError(err).Error("Error while processing batch")
+				log.Info("Stopping Pipeline")
+				p.Stop()
+				runError = err
+			}
+		}
 	}
+
+	if p.spoolQueue != nil {
+		// Unless the pipeline was stopped, the drain loop delivers the remaining spooled batches first
+		close(p.produceDone)
+		p.drainWaitGroup.Wait()
+		if runError == nil {
+			runError = p.drainError
+		}
+	}
+
+	if runError == nil {
+		p.stopErrorMutex.Lock()
+		runError = p.stopError
+		p.stopErrorMutex.Unlock()
+	}
+
+	stopReason := StopReasonFinished
+	if runError != nil {
+		stopReason = StopReasonFailure
+	} else if p.isStopped() && !p.isMaxBatchesReached() {
+		stopReason = StopReasonUserAction
+	}
+	stopEvent := newPipelineStopEvent(p.pipelineConf, stopReason)
+	for _, stopEventStage := range p.stopEventStages {
+		if err := stopEventStage.handleEvent(stopEvent); err != nil {
+			log.WithError(err).Error("Pipeline stop event failed")
+		}
+	}
+	return runError
 }
 
 func (p *Pipeline) runBatch() error {
+	if p.rateLimiter != nil {
+		if throttleTime := p.rateLimiter.Wait(p.stopChan); throttleTime > 0 {
+			p.rateLimitThrottleTimer.Update(throttleTime)
+		}
+		if p.isStopped() {
+			return nil
+		}
+	}
+
+	p.batchMutex.Lock()
+	defer p.batchMutex.Unlock()
+
 	committed := false
 	start := time.Now()
 
@@ -115,115 +255,338 @@ func (p *Pipeline) runBatch() error {
 
 	previousOffset := p.offsetTracker.GetOffset()
 
-	pipeBatch := NewFullPipeBatch(p.offsetTracker, p.config.MaxBatchSize, p.errorSink, p.eventSink, false)
+	var capture *snapshotCapture
+	batchSize := p.batchSize
+	if p.spoolQueue == nil {
+		// Spooled batches are captured when they are delivered by the drain loop
+		if capture = p.startSnapshotBatch(); capture != nil && capture.batchSize > 0 {
+			batchSize = capture.batchSize
+		}
+	}
+
+	pipeBatch := NewFullPipeBatch(p.offsetTracker, batchSize, p.errorSink, p.eventSink, capture != nil)
+
+	pipes := p.pipes
+	if p.spoolQueue != nil {
+		// Only the origin runs here, the spooled batch is delivered by the drain loop
+		pipes = p.pipes[:1]
+	}
 
-	for _, pipe := range p.pipes {
+	for _, pipe := range pipes {
 		if p.pipelineBean.Config.DeliveryGuarantee == AtMostOnce &&
 			pipe.IsTarget() && // if destination
 			!committed {
-			if err := p.offsetTracker.CommitOffset(); err != nil {
+			if err := p.commitOffset(); err != nil {
 				return err
 			}
 			committed = true
 		}
 
-		err := pipe.Process(pipeBatch)
-		if err != nil {
-			log.WithError(err).Error()
+		if err := pipe.Process(pipeBatch); err != nil {
+			return err
 		}
 	}
 
-	errorRecords := make([]api.Record, 0)
-	for _, stageBean := range p.pipelineBean.Stages {
-		errorRecordsForThisStage := p.errorSink.GetStageErrorRecords(stageBean.Config.InstanceName)
-		if errorRecordsForThisStage != nil && len(errorRecordsForThisStage) > 0 {
-			errorRecords = append(errorRecords, errorRecordsForThisStage...)
-		}
+	if err := p.processErrorRecords(p.errorSink, previousOffset); err != nil {
+		return err
 	}
-	if len(errorRecords) > 0 {
-		batch := NewBatchImpl(p.errorStageRuntime.config.InstanceName, errorRecords, previousOffset)
-		_, err := p.errorStageRuntime.Execute(previousOffset, -1, batch, nil)
-		if err != nil {
+
+	if p.spoolQueue == nil {
+		p.rulesEvaluator.evaluateDataRules(pipeBatch)
+	}
+
+	if p.spoolQueue != nil {
+		// Offset is committed as soon as the batch is durably spooled
+		if err := p.spoolQueue.Add(p.offsetTracker.GetOffset(), pipeBatch.(*FullPipeBatch).fullPayload); err != nil {
 			return err
 		}
+		if err := p.commitOffset(); err != nil {
+			return err
+		}
+	} else if p.pipelineBean.Config.DeliveryGuarantee == AtLeastOnce {
+		p.commitOffset()
 	}
 
-	if p.pipelineBean.Config.DeliveryGuarantee == AtLeastOnce {
-		p.offsetTracker.CommitOffset()
+	if p.rateLimiter != nil {
+		p.rateLimiter.Take(pipeBatch.GetInputRecords())
 	}
 
 	p.batchProcessingTimer.UpdateSince(start)
 	p.batchCountCounter.Inc(1)
 	p.batchCountMeter.Mark(1)
 
-	p.batchInputRecordsCounter.Inc(pipeBatch.GetInputRecords())
-	p.batchOutputRecordsCounter.Inc(pipeBatch.GetOutputRecords())
-	p.batchErrorMessagesCounter.Inc(pipeBatch.GetErrorMessages())
-	p.batchErrorRecordsCounter.Inc(pipeBatch.GetErrorRecords())
+	p.updateInputRecordsMetrics(pipeBatch.GetInputRecords())
+	if p.spoolQueue == nil {
+		p.updateOutputRecordsMetrics(pipeBatch.GetOutputRecords())
+	}
+	p.updateErrorMetrics(pipeBatch.GetErrorRecords(), pipeBatch.GetErrorMessages())
 
-	p.batchInputRecordsMeter.Mark(pipeBatch.GetInputRecords())
-	p.batchOutputRecordsMeter.Mark(pipeBatch.GetOutputRecords())
-	p.batchErrorMessagesMeter.Mark(pipeBatch.GetErrorMessages())
-	p.batchErrorRecordsMeter.Mark(pipeBatch.GetErrorRecords())
+	if capture != nil {
+		p.completeSnapshotBatch(capture, pipeBatch.GetSnapshotsOfAllStagesOutput())
+	}
+	if p.spoolQueue == nil {
+		p.tapLanes(pipeBatch)
+	}
 
-	p.batchInputRecordsHistogram.Update(pipeBatch.GetInputRecords())
-	p.batchOutputRecordsHistogram.Update(pipeBatch.GetOutputRecords())
-	p.batchErrorMessagesHistogram.Update(pipeBatch.GetErrorMessages())
-	p.batchErrorRecordsHistogram.Update(pipeBatch.GetErrorRecords())
+	p.retainErrors(pipeBatch.GetErrorSink())
 
-	// Retain X number of error records and error messages per stage
-	p.retainErrorRecordsInMemory(pipeBatch.GetErrorSink().GetErrorRecords())
-	p.retainErrorMessagesInMemory(pipeBatch.GetErrorSink().GetErrorMessages())
+	if p.onBatchSuccess != nil {
+		p.onBatchSuccess()
+	}
 
 	return nil
 }
 
-func (p *Pipeline) retainErrorRecordsInMemory(stageErrorRecords map[string][]api.Record) {
-	for stageInstanceName, errorRecords := range stageErrorRecords {
-		if _, keyExists := p.stageToErrorRecordsMap[stageInstanceName]; !keyExists {
-			p.stageToErrorRecordsMap[stageInstanceName] = make([]api.Record, 0, MaxCountInCache)
+// drain delivers spooled batches to the processors and destinations, a failed delivery is retried
+// after SpoolDrainRetryInterval
+func (p *Pipeline) drain() {
+	defer p.drainWaitGroup.Done()
+
+	originStageContext := p.pipes[0].GetStageContext()
+	for !p.isStopped() {
+		spooledBatch := p.spoolQueue.Peek(originStageContext)
+		if spooledBatch == nil {
+			select {
+			case <-p.spoolQueue.notify:
+			case <-p.produceDone:
+				// Origin is done and everything spooled was delivered
+				return
+			case <-p.stopChan:
+			}
+			continue
 		}
 
-		for _, record := range errorRecords {
-			if len(p.stageToErrorRecordsMap[stageInstanceName]) >= MaxCountInCache {
-				p.stageToErrorRecordsMap[stageInstanceName] = append(p.stageToErrorRecordsMap[stageInstanceName][1:], record)
-			} else {
-				p.stageToErrorRecordsMap[stageInstanceName] = append(p.stageToErrorRecordsMap[stageInstanceName], record)
+		if err := p.deliverSpooledBatch(spooledBatch); err != nil {
+			if _, ok := err.(*common.StopPipelineError); ok {
+				p.drainError = err
+				p.Stop()
+				return
 			}
+			log.WithError(err).Warn("Failed to deliver spooled batch, retrying later")
+			select {
+			case <-time.After(SpoolDrainRetryInterval):
+			case <-p.stopChan:
+			}
+			continue
 		}
+		p.spoolQueue.Remove(spooledBatch.Sequence)
 	}
 }
 
-func (p *Pipeline) retainErrorMessagesInMemory(stageErrorMessages map[string][]api.ErrorMessage) {
-	for stageInstanceName, errorMessages := range stageErrorMessages {
-		if _, keyExists := p.stageToErrorMessagesMap[stageInstanceName]; !keyExists {
-			p.stageToErrorMessagesMap[stageInstanceName] = make([]api.ErrorMessage, 0, MaxCountInCache)
-		}
+func (p *Pipeline) deliverSpooledBatch(spooledBatch *SpooledBatch) error {
+	p.batchMutex.Lock()
+	defer p.batchMutex.Unlock()
+
+	p.drainErrorSink.ClearErrorRecordsAndMessages()
+	p.drainEventSink.ClearEventRecords()
 
-		for _, errorMessage := range errorMessages {
-			if len(p.stageToErrorMessagesMap[stageInstanceName]) >= MaxCountInCache {
-				p.stageToErrorMessagesMap[stageInstanceName] = append(p.stageToErrorMessagesMap[stageInstanceName][1:], errorMessage)
-			} else {
-				p.stageToErrorMessagesMap[stageInstanceName] = append(p.stageToErrorMessagesMap[stageInstanceName], errorMessage)
+	capture := p.startSnapshotBatch()
+	pipeBatch := NewFullPipeBatch(
+		&fixedOffsetTracker{offset: spooledBatch.SourceOffset},
+		p.config.MaxBatchSize,
+		p.drainErrorSink,
+		p.drainEventSink,
+		capture != nil,
+	)
+	pipeBatch.(*FullPipeBatch).fullPayload = spooledBatch.records
+	if capture != nil {
+		// The origin output is the spooled batch, origin errors were reported when the batch was spooled
+		originPipe := p.pipes[0].(*StagePipe)
+		originOutput := execution.StageOutput{
+			InstanceName: originPipe.GetInstanceName(),
+			Output:       make(map[string][]api.Record),
+		}
+		for _, outputLane := range originPipe.OutputLanes {
+			// Copies are captured as the processors may modify the spooled records
+			for _, record := range spooledBatch.records[outputLane] {
+				originOutput.Output[outputLane] = append(originOutput.Output[outputLane], record.Clone())
 			}
 		}
+		pipeBatch.(*FullPipeBatch).StageOutputSnapshot = append(
+			pipeBatch.(*FullPipeBatch).StageOutputSnapshot,
+			originOutput,
+		)
+	}
+
+	for _, pipe := range p.pipes[1:] {
+		if err := pipe.Process(pipeBatch); err != nil {
+			return err
+		}
+	}
+
+	if err := p.processErrorRecords(p.drainErrorSink, spooledBatch.SourceOffset); err != nil {
+		return err
+	}
+	p.rulesEvaluator.evaluateDataRules(pipeBatch)
+	if capture != nil {
+		p.completeSnapshotBatch(capture, pipeBatch.GetSnapshotsOfAllStagesOutput())
+	}
+	p.tapLanes(pipeBatch)
+
+	p.updateOutputRecordsMetrics(pipeBatch.GetOutputRecords())
+	p.updateErrorMetrics(pipeBatch.GetErrorRecords(), pipeBatch.GetErrorMessages())
+	p.retainErrors(pipeBatch.GetErrorSink())
+	return nil
+}
+
+func (p *Pipeline) processErrorRecords(errorSink *common.ErrorSink, offset *string) error {
+	errorRecords := make([]api.Record, 0)
+	for _, stageBean := range p.pipelineBean.Stages {
+		errorRecordsForThisStage := errorSink.GetStageErrorRecords(stageBean.Config.InstanceName)
+		if errorRecordsForThisStage != nil && len(errorRecordsForThisStage) > 0 {
+			errorRecords = append(errorRecords, errorRecordsForThisStage...)
+		}
+	}
+	if len(errorRecords) > 0 {
+		// Error stage is shared by the batch and drain loops
+		p.errorMutex.Lock()
+		defer p.errorMutex.Unlock()
+		batch := NewBatchImpl(p.errorStageRuntime.config.InstanceName, errorRecords, offset)
+		_, err := p.errorStageRuntime.Execute(offset, -1, batch, nil)
+		return err
+	}
+	return nil
+}
+
+func (p *Pipeline) updateInputRecordsMetrics(inputRecords int64) {
+	p.batchInputRecordsCounter.Inc(inputRecords)
+	p.batchInputRecordsMeter.Mark(inputRecords)
+	p.batchInputRecordsHistogram.Update(inputRecords)
+}
+
+func (p *Pipeline) updateOutputRecordsMetrics(outputRecords int64) {
+	p.batchOutputRecordsCounter.Inc(outputRecords)
+	p.batchOutputRecordsMeter.Mark(outputRecords)
+	p.batchOutputRecordsHistogram.Update(outputRecords)
+}
+
+func (p *Pipeline) updateErrorMetrics(errorRecords int64, errorMessages int64) {
+	p.batchErrorRecordsCounter.Inc(errorRecords)
+	p.batchErrorRecordsMeter.Mark(errorRecords)
+	p.batchErrorRecordsHistogram.Update(errorRecords)
+
+	p.batchErrorMessagesCounter.Inc(errorMessages)
+	p.batchErrorMessagesMeter.Mark(errorMessages)
+	p.batchErrorMessagesHistogram.Update(errorMessages)
+}
+
+// Retain the error records and error messages of the batch per stage in the bounded error store
+func (p *Pipeline) retainErrors(errorSink *common.ErrorSink) {
+	for stageInstanceName, errorRecords := range errorSink.GetErrorRecords() {
+		if err := p.errorStore.SaveErrorRecords(stageInstanceName, errorRecords); err != nil {
+			log.WithError(err).WithField("stage", stageInstanceName).Warn("Failed to retain error records")
+		}
+	}
+	for stageInstanceName, errorMessages := range errorSink.GetErrorMessages() {
+		if err := p.errorStore.SaveErrorMessages(stageInstanceName, errorMessages); err != nil {
+			log.WithError(err).WithField("stage", stageInstanceName).Warn("Failed to retain error messages")
+		}
 	}
 }
 
-func (p *Pipeline) GetErrorRecords(stageInstanceName string, size int) ([]api.Record, error) {
-	return p.stageToErrorRecordsMap[stageInstanceName], nil
+func (p *Pipeline) GetErrorRecords(stageInstanceName string, query store.ErrorQuery) ([]sdcrecord.SDCRecord, error) {
+	return p.errorStore.GetErrorRecords(stageInstanceName, query)
 }
 
-func (p *Pipeline) GetErrorMessages(stageInstanceName string, size int) ([]api.ErrorMessage, error) {
-	return p.stageToErrorMessagesMap[stageInstanceName], nil
+func (p *Pipeline) GetErrorMessages(stageInstanceName string, query store.ErrorQuery) ([]api.ErrorMessage, error) {
+	return p.errorStore.GetErrorMessages(stageInstanceName, query)
+}
+
+// GetAlerts returns the alerts raised by the data rules and metric rules of the pipeline
+func (p *Pipeline) GetAlerts() []*common.Alert {
+	return p.rulesEvaluator.GetAlerts()
+}
+
+func (p *Pipeline) DeleteAlert(ruleId string) bool {
+	return p.rulesEvaluator.DeleteAlert(ruleId)
+}
+
+func (p *Pipeline) getPushOrigin() api.PushOrigin {
+	if p.runners == nil {
+		return nil
+	}
+	return p.pipes[0].(*StagePipe).Stage.stageBean.Stage.(api.PushOrigin)
+}
+
+// getAllPipes returns the pipes of the pipeline together with the pipes of additional push origin runners
+func (p *Pipeline) getAllPipes() []Pipe {
+	pipes := p.pipes
+	for _, runner := range p.runners {
+		if runner.runnerId > 0 {
+			pipes = append(pipes[:len(pipes):len(pipes)], runner.pipes...)
+		}
+	}
+	return pipes
 }
 
 func (p *Pipeline) Stop() {
 	log.Debug("Pipeline Stop()")
-	p.stop = true
-	for _, pipe := range p.pipes {
+	for _, pipe := range p.getAllPipes() {
 		pipe.GetStageContext().SetStop()
 	}
+	p.stopOnce.Do(func() {
+		close(p.stopChan)
+	})
+}
+
+func (p *Pipeline) isStopped() bool {
+	select {
+	case <-p.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// StopAndWait stops the pipeline and waits up to drainTimeout for the in-flight batch to finish and all
+// stages to be destroyed. If the timeout expires the pipeline is forced to stop, the batch still running
+// does not commit its offset unless the delivery guarantee is at most once, and false is returned.
+func (p *Pipeline) StopAndWait(drainTimeout time.Duration) bool {
+	p.Stop()
+
+	timer := time.NewTimer(drainTimeout)
+	defer timer.Stop()
+	select {
+	case <-p.runDone:
+		return true
+	case <-timer.C:
+		p.forceStopMutex.Lock()
+		p.forceStopped = true
+		p.forceStopMutex.Unlock()
+		return false
+	}
+}
+
+// commitOffset commits the origin offset, after a forced stop only at most once pipelines commit so the
+// interrupted batch is processed again after a restart
+func (p *Pipeline) commitOffset() error {
+	if p.isForceStopped() && p.pipelineBean.Config.DeliveryGuarantee != AtMostOnce {
+		log.Warn("Pipeline was forced to stop, skipping offset commit")
+		return nil
+	}
+	return p.offsetTracker.CommitOffset()
+}
+
+// isMaxBatchesReached returns true once the pipeline processed the maximum number of batches of the
+// offline run mode, the pipeline is finished then
+func (p *Pipeline) isMaxBatchesReached() bool {
+	return p.config.MaxBatches > 0 && p.batchCountCounter.Count() >= p.config.MaxBatches
+}
+
+func (p *Pipeline) isForceStopped() bool {
+	p.forceStopMutex.Lock()
+	defer p.forceStopMutex.Unlock()
+	return p.forceStopped
+}
+
+// stopWithError stops the pipeline from outside the batch loop, Run returns the given error
+func (p *Pipeline) stopWithError(err error) {
+	p.stopErrorMutex.Lock()
+	if p.stopError == nil {
+		p.stopError = err
+	}
+	p.stopErrorMutex.Unlock()
+	p.Stop()
 }
 
 func NewPipeline(
@@ -235,7 +598,6 @@ func NewPipeline(
 ) (*Pipeline, []validation.Issue) {
 	issues := make([]validation.Issue, 0)
 	pipelineConfigForParam := creation.NewPipelineConfigBean(pipelineConfig)
-	stageRuntimeList := make([]StageRuntime, len(pipelineConfig.Stages))
 	pipes := make([]Pipe, len(pipelineConfig.Stages))
 	errorSink := common.NewErrorSink()
 	eventSink := common.NewEventSink()
@@ -256,38 +618,40 @@ func NewPipeline(
 		return nil, issues
 	}
 
+	var pushOrigin api.PushOrigin
+	if len(pipelineBean.Stages) > 0 {
+		pushOrigin, _ = pipelineBean.Stages[0].Stage.(api.PushOrigin)
+	}
+
+	// Processors and destinations get their own sinks when they do not run in the origin batch loop
+	drainErrorSink := errorSink
+	drainEventSink := eventSink
+	if pipelineConfigForParam.StoreAndForward || pushOrigin != nil {
+		drainErrorSink = common.NewErrorSink()
+		drainEventSink = common.NewEventSink()
+	}
+
 	for i, stageBean := range pipelineBean.Stages {
-		var services map[string]api.Service
-		if stageBean.Services != nil && len(stageBean.Services) > 0 {
-			services = make(map[string]api.Service)
-			for _, serviceBean := range stageBean.Services {
-				services[serviceBean.Config.Service] = serviceBean.Service
-			}
+		stageErrorSink := errorSink
+		stageEventSink := eventSink
+		if !stageBean.IsSource() {
+			stageErrorSink = drainErrorSink
+			stageEventSink = drainEventSink
 		}
 
-		stageContext, err := common.NewStageContext(
-			stageBean.Config,
+		var stageIssue *validation.Issue
+		pipes[i], stageIssue = newStagePipe(
+			config,
+			pipelineBean,
+			stageBean,
 			resolvedParameters,
 			metricRegistry,
-			errorSink,
-			false,
-			pipelineConfigForParam.ErrorRecordPolicy,
-			services,
-			pipelineBean.ElContext,
-			eventSink,
-			false,
+			stageErrorSink,
+			stageEventSink,
 		)
-		if err != nil {
-			issues = append(issues, validation.Issue{
-				InstanceName: stageBean.Config.InstanceName,
-				Level:        common.StageConfig,
-				Count:        1,
-				Message:      err.Error(),
-			})
-			return nil, issues
+		if stageIssue != nil {
+			return nil, append(issues, *stageIssue)
 		}
-		stageRuntimeList[i] = NewStageRuntime(pipelineBean, stageBean, stageContext)
-		pipes[i] = NewStagePipe(stageRuntimeList[i], config)
 	}
 
 	log.Debug("Error Stage:", pipelineBean.ErrorStage.Config.InstanceName)
@@ -298,6 +662,7 @@ func NewPipeline(
 		errorSink,
 		true,
 		pipelineConfigForParam.ErrorRecordPolicy,
+		"",
 		nil,
 		pipelineBean.ElContext,
 		eventSink,
@@ -321,18 +686,102 @@ func NewPipeline(
 		errorStageRuntime: errorStageRuntime,
 		errorSink:         errorSink,
 		eventSink:         eventSink,
+		drainErrorSink:    drainErrorSink,
+		drainEventSink:    drainEventSink,
+		stopChan:          make(chan struct{}),
+		runDone:           make(chan struct{}),
+		produceDone:       make(chan struct{}),
 		offsetTracker:     sourceOffsetTracker,
 		MetricRegistry:    metricRegistry,
 		config:            config,
+		batchSize:         config.MaxBatchSize,
+	}
+
+	if pushOrigin != nil {
+		if issues = p.createRunners(pushOrigin, resolvedParameters); len(issues) > 0 {
+			return nil, issues
+		}
+	}
+
+	if isStatsAggregatorEnabled(pipelineConfig) {
+		var stageIssue *validation.Issue
+		if p.statsAggregator, stageIssue = NewStatsAggregator(
+			pipelineConfig,
+			pipelineBean,
+			resolvedParameters,
+			metricRegistry,
+		); stageIssue != nil {
+			return nil, append(issues, *stageIssue)
+		}
+	}
+
+	var stageIssue *validation.Issue
+	p.startParameters = resolvedParameters
+	if p.startEventStages, stageIssue = NewLifecycleEventStages(
+		pipelineBean,
+		pipelineBean.StartEventStages,
+		PipelineStartEventType,
+		resolvedParameters,
+		metricRegistry,
+	); stageIssue != nil {
+		return nil, append(issues, *stageIssue)
+	}
+	if p.stopEventStages, stageIssue = NewLifecycleEventStages(
+		pipelineBean,
+		pipelineBean.StopEventStages,
+		PipelineStopEventType,
+		resolvedParameters,
+		metricRegistry,
+	); stageIssue != nil {
+		return nil, append(issues, *stageIssue)
+	}
+
+	p.rulesEvaluator = NewRulesEvaluator(pipelineConfig, pipes[0].GetStageContext(), p.statsAggregator, metricRegistry)
+
+	memoryLimit, err := ParseMemoryLimit(pipelineConfigForParam.MemoryLimit, pipelineBean.ElContext)
+	if err != nil {
+		issues = append(issues, validation.Issue{
+			ConfigName: creation.MemoryLimit,
+			Count:      1,
+			Message:    err.Error(),
+		})
+		return nil, issues
+	}
+	if err := notification.ValidateWebhookConfigs(pipelineConfigForParam.WebhookConfigs); err != nil {
+		issues = append(issues, validation.Issue{
+			ConfigName: creation.WebHookConfigs,
+			Count:      1,
+			Message:    err.Error(),
+		})
+		return nil, issues
+	}
+
+	if memoryLimit > 0 {
+		p.memoryWatchdog = NewMemoryWatchdog(
+			memoryLimit,
+			pipelineConfigForParam.MemoryLimitExceeded,
+			p.stopWithError,
+			metricRegistry,
+		)
+	}
+
+	if pipelineConfigForParam.RateLimit > 0 {
+		// Batches larger than a second worth of records would exceed the limit within the batch
+		p.rateLimiter = NewTokenBucket(pipelineConfigForParam.RateLimit)
+		if rateLimit := int(math.Ceil(pipelineConfigForParam.RateLimit)); rateLimit < p.batchSize {
+			p.batchSize = rateLimit
+		}
 	}
 
 	p.batchProcessingTimer = util.CreateTimer(metricRegistry, PipelineBatchProcessing)
+	p.rateLimitThrottleTimer = util.CreateTimer(metricRegistry, PipelineRateLimitThrottle)
 
 	p.batchCountCounter = util.CreateCounter(metricRegistry, PipelineBatchCount)
 	p.batchInputRecordsCounter = util.CreateCounter(metricRegistry, PipelineBatchInputRecords)
 	p.batchOutputRecordsCounter = util.CreateCounter(metricRegistry, PipelineBatchOutputRecords)
 	p.batchErrorRecordsCounter = util.CreateCounter(metricRegistry, PipelineBatchErrorRecords)
 	p.batchErrorMessagesCounter = util.CreateCounter(metricRegistry, PipelineBatchErrorMessages)
+	p.replayedRecordsCounter = util.CreateCounter(metricRegistry, PipelineReplayedRecords)
 
 	p.batchCountMeter = util.CreateMeter(metricRegistry, PipelineBatchCount)
 	p.batchInputRecordsMeter = util.CreateMeter(metricRegistry, PipelineBatchInputRecords)
@@ -345,8 +794,116 @@ func NewPipeline(
 	p.batchErrorRecordsHistogram = util.CreateHistogram5Min(metricRegistry, PipelineErrorRecordsPerBatch)
 	p.batchErrorMessagesHistogram = util.CreateHistogram5Min(metricRegistry, PipelineErrorsPerBatch)
 
-	p.stageToErrorRecordsMap = make(map[string][]api.Record)
-	p.stageToErrorMessagesMap = make(map[string][]api.ErrorMessage)
+	p.errorStore = store.GetErrorStore(pipelineConfig.PipelineId, config.Storage.ErrorRecordsRetention)
 
 	return p, issues
 }
+
+// createRunners creates the pipeline runners of a push origin, the number of runners is the number of origin
+// threads limited by maxRunners. The first runner uses the pipeline stages, the other runners get their own
+// instances of the processors and destinations.
+func (p *Pipeline) createRunners(pushOrigin api.PushOrigin, resolvedParameters map[string]interface{}) []validation.Issue {
+	numberOfRunners := pushOrigin.GetNumberOfThreads()
+	if maxRunners := int(p.pipelineBean.Config.MaxRunners); maxRunners > 0 && maxRunners < numberOfRunners {
+		numberOfRunners = maxRunners
+	}
+	if numberOfRunners < 1 {
+		numberOfRunners = 1
+	}
+	log.WithField("runners", numberOfRunners).Debug("Creating pipeline runners")
+
+	p.runners = make([]*pipeRunner, numberOfRunners)
+	p.idleRunners = make(chan *pipeRunner, numberOfRunners)
+	for runnerId := 0; runnerId < numberOfRunners; runnerId++ {
+		runner := &pipeRunner{
+			runnerId:  runnerId,
+			errorSink: common.NewErrorSink(),
+			eventSink: common.NewEventSink(),
+		}
+
+		switch {
+		case p.pipelineBean.Config.StoreAndForward:
+			// Runners only spool the origin output, the drain loop runs the pipeline stages
+		case runnerId == 0:
+			runner.pipes = p.pipes[1:]
+			runner.errorSink = p.drainErrorSink
+			runner.eventSink = p.drainEventSink
+		default:
+			runner.pipes = make([]Pipe, 0, len(p.pipes)-1)
+			for _, stageBean := range p.pipelineBean.Stages[1:] {
+				runnerStageBean, err := creation.NewStageBean(
+					stageBean.Config,
+					resolvedParameters,
+					p.pipelineBean.ElContext,
+				)
+				if err != nil {
+					return []validation.Issue{{
+						InstanceName: stageBean.Config.InstanceName,
+						Level:        common.StageConfig,
+						Count:        1,
+						Message:      err.Error(),
+					}}
+				}
+
+				pipe, stageIssue := newStagePipe(
+					p.config,
+					p.pipelineBean,
+					runnerStageBean,
+					resolvedParameters,
+					p.MetricRegistry,
+					runner.errorSink,
+					runner.eventSink,
+				)
+				if stageIssue != nil {
+					return []validation.Issue{*stageIssue}
+				}
+				runner.pipes = append(runner.pipes, pipe)
+			}
+		}
+
+		p.runners[runnerId] = runner
+		p.idleRunners <- runner
+	}
+	return nil
+}
+
+func newStagePipe(
+	config execution.Config,
+	pipelineBean creation.PipelineBean,
+	stageBean creation.StageBean,
+	resolvedParameters map[string]interface{},
+	metricRegistry metrics.Registry,
+	errorSink *common.ErrorSink,
+	eventSink *common.EventSink,
+) (Pipe, *validation.Issue) {
+	var services map[string]api.Service
+	if stageBean.Services != nil && len(stageBean.Services) > 0 {
+		services = make(map[string]api.Service)
+		for _, serviceBean := range stageBean.Services {
+			services[serviceBean.Config.Service] = serviceBean.Service
+		}
+	}
+
+	stageContext, err := common.NewStageContext(
+		stageBean.Config,
+		resolvedParameters,
+		metricRegistry,
+		errorSink,
+		false,
+		pipelineBean.Config.ErrorRecordPolicy,
+		stageBean.SystemConfigs.StageOnRecordError,
+		services,
+		pipelineBean.ElContext,
+		eventSink,
+		false,
+	)
+	if err != nil {
+		return nil, &validation.Issue{
+			InstanceName: stageBean.Config.InstanceName,
+			Level:        common.StageConfig,
+			Count:        1,
+			Message:      err.Error(),
+		}
+	}
+	return NewStagePipe(NewStageRuntime(pipelineBean, stageBean, stageContext), config), nil
+}
@@ -0,0 +1,176 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package runner
+
+import (
+	"github.com/rcrowley/go-metrics"
+	"github.com/streamsets/datacollector-edge/api"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"github.com/streamsets/datacollector-edge/container/creation"
+	"github.com/streamsets/datacollector-edge/container/execution"
+	"github.com/streamsets/datacollector-edge/container/execution/store"
+	"github.com/streamsets/datacollector-edge/stages/stagelibrary"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+const (
+	stopTestLibrary    = "stop-test-lib"
+	stopTestOriginName = "slowOrigin"
+	stopTestOffset     = "offset1"
+)
+
+var stopTestOriginInstance *stopTestOrigin
+
+// stopTestOrigin blocks in Produce until the release channel is closed
+type stopTestOrigin struct {
+	*common.BaseStage
+	producing chan struct{}
+	release   chan struct{}
+}
+
+func (o *stopTestOrigin) Produce(lastSourceOffset *string, maxBatchSize int, batchMaker api.BatchMaker) (*string, error) {
+	select {
+	case o.producing <- struct{}{}:
+	default:
+	}
+	<-o.release
+	record, _ := o.GetStageContext().CreateRecord("record1", map[string]interface{}{"a": "b"})
+	batchMaker.AddRecord(record)
+	offset := stopTestOffset
+	return &offset, nil
+}
+
+func init() {
+	stagelibrary.SetCreator(stopTestLibrary, stopTestOriginName, func() api.Stage {
+		stopTestOriginInstance = &stopTestOrigin{
+			BaseStage: &common.BaseStage{},
+			producing: make(chan struct{}, 1),
+			release:   make(chan struct{}),
+		}
+		return stopTestOriginInstance
+	})
+}
+
+func getStopTestPipeline(t *testing.T) (*Pipeline, *ProductionSourceOffsetTracker) {
+	originConfig := getPushTestStageConfig("origin1", stopTestOriginName, creation.SOURCE)
+	originConfig.Library = stopTestLibrary
+	originConfig.OutputLanes = []string{"lane1"}
+	destinationConfig := getPushTestStageConfig("destination1", pushTestDestinationName, creation.TARGET)
+	destinationConfig.InputLanes = []string{"lane1"}
+	pipelineConfig := common.PipelineConfiguration{
+		PipelineId:    "stopPipeline",
+		Configuration: []common.Config{{Name: creation.DeliveryGuarantee, Value: AtLeastOnce}},
+		Stages:        []*common.StageConfiguration{originConfig, destinationConfig},
+		ErrorStage:    getPushTestStageConfig("errorStage", pushTestDestinationName, creation.TARGET),
+	}
+
+	// Creates the pipeline run info directory
+	if _, err := store.GetState(pipelineConfig.PipelineId); err != nil {
+		t.Fatal(err)
+	}
+	offsetTracker, err := NewProductionSourceOffsetTracker(pipelineConfig.PipelineId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline, issues := NewPipeline(execution.NewConfig(), pipelineConfig, offsetTracker, nil, metrics.NewRegistry())
+	if len(issues) > 0 {
+		t.Fatal(issues[0].Message)
+	}
+	if issues := pipeline.Init(); len(issues) > 0 {
+		t.Fatal(issues[0].Message)
+	}
+	return pipeline, offsetTracker
+}
+
+func getCommittedOffset(t *testing.T, pipelineId string) *string {
+	sourceOffset, err := store.GetOffset(pipelineId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sourceOffset.Offset[common.PollSourceOffsetKey]
+}
+
+func TestPipeline_StopAndWait(t *testing.T) {
+	var err error
+	store.BaseDir, err = ioutil.TempDir("", "pipeline_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store.BaseDir)
+
+	pipeline, _ := getStopTestPipeline(t)
+	go pipeline.Run()
+	<-stopTestOriginInstance.producing
+
+	// The in-flight batch finishes and commits its offset before the pipeline reports it stopped
+	time.AfterFunc(20*time.Millisecond, func() {
+		close(stopTestOriginInstance.release)
+	})
+	if !pipeline.StopAndWait(5 * time.Second) {
+		t.Fatal("Expected pipeline to stop within the drain timeout")
+	}
+	if offset := getCommittedOffset(t, "stopPipeline"); offset == nil || *offset != stopTestOffset {
+		t.Errorf("Expected committed offset %s, but got: %v", stopTestOffset, offset)
+	}
+}
+
+func TestPipeline_StopAndWaitTimeout(t *testing.T) {
+	var err error
+	store.BaseDir, err = ioutil.TempDir("", "pipeline_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store.BaseDir)
+
+	pipeline, _ := getStopTestPipeline(t)
+	go pipeline.Run()
+	<-stopTestOriginInstance.producing
+
+	if pipeline.StopAndWait(20 * time.Millisecond) {
+		t.Fatal("Expected pipeline to be forced to stop")
+	}
+
+	// The batch finishing after the forced stop must not commit its offset with at least once delivery
+	close(stopTestOriginInstance.release)
+	<-pipeline.runDone
+	if offset := getCommittedOffset(t, "stopPipeline"); offset != nil && *offset == stopTestOffset {
+		t.Errorf("Expected offset not to be committed after a forced stop, but got: %s", *offset)
+	}
+}
+
+func TestPipeline_MaxBatches(t *testing.T) {
+	var err error
+	store.BaseDir, err = ioutil.TempDir("", "pipeline_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store.BaseDir)
+
+	pipeline, _ := getStopTestPipeline(t)
+	pipeline.config.MaxBatches = 3
+	close(stopTestOriginInstance.release)
+
+	// The origin never finishes, the pipeline finishes after the maximum number of batches
+	if err := pipeline.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if batchCount := pipeline.batchCountCounter.Count(); batchCount != 3 {
+		t.Errorf("Expected 3 batches, but got: %d", batchCount)
+	}
+	if !pipeline.isMaxBatchesReached() {
+		t.Error("Expected the maximum number of batches to be reached")
+	}
+}
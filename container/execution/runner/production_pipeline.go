@@ -18,6 +18,8 @@ import (
 	"github.com/streamsets/datacollector-edge/api/validation"
 	"github.com/streamsets/datacollector-edge/container/common"
 	"github.com/streamsets/datacollector-edge/container/execution"
+	"github.com/streamsets/datacollector-edge/container/execution/store"
+	"time"
 )
 
 const (
@@ -40,9 +42,9 @@ func (p *ProductionPipeline) Init() []validation.Issue {
 	return issues
 }
 
-func (p *ProductionPipeline) Run() {
+func (p *ProductionPipeline) Run() error {
 	log.Debug("Production Pipeline Run")
-	p.Pipeline.Run()
+	return p.Pipeline.Run()
 }
 
 func (p *ProductionPipeline) Stop() {
@@ -50,6 +52,12 @@ func (p *ProductionPipeline) Stop() {
 	p.Pipeline.Stop()
 }
 
+// StopAndWait stops the pipeline and waits for the in-flight batch to drain, see Pipeline.StopAndWait
+func (p *ProductionPipeline) StopAndWait(drainTimeout time.Duration) bool {
+	log.Debug("Production Pipeline Stop and Wait")
+	return p.Pipeline.StopAndWait(drainTimeout)
+}
+
 func NewProductionPipeline(
 	pipelineId string,
 	config execution.Config,
@@ -61,11 +69,24 @@ func NewProductionPipeline(
 		metricRegistry := metrics.NewRegistry()
 		pipeline, issues := NewPipeline(
 			config,
-			runner.GetPipelineConfig(),
+			pipelineConfiguration,
 			sourceOffsetTracker,
 			runtimeParameters,
 			metricRegistry,
 		)
+		if pipeline != nil && pipeline.pipelineBean.Config.StoreAndForward {
+			maxSizeBytes := int64(pipeline.pipelineBean.Config.StoreAndForwardMaxMB * 1024 * 1024)
+			if pipeline.spoolQueue, err = NewSpoolQueue(
+				store.GetSpoolDir(pipelineId),
+				maxSizeBytes,
+				metricRegistry,
+			); err != nil {
+				issues = append(issues, validation.Issue{
+					Count:   1,
+					Message: err.Error(),
+				})
+			}
+		}
 		return &ProductionPipeline{
 			PipelineConfig: pipelineConfiguration,
 			Pipeline:       pipeline,
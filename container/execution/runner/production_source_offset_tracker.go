@@ -15,6 +15,7 @@ package runner
 import (
 	"github.com/streamsets/datacollector-edge/container/common"
 	"github.com/streamsets/datacollector-edge/container/execution/store"
+	"sync"
 	"time"
 )
 
@@ -24,6 +25,7 @@ type ProductionSourceOffsetTracker struct {
 	newOffset     *string
 	finished      bool
 	lastBatchTime time.Time
+	mutex         sync.Mutex
 }
 
 var emptyOffset = ""
@@ -37,6 +39,8 @@ func (o *ProductionSourceOffsetTracker) SetOffset(newOffset *string) {
 }
 
 func (o *ProductionSourceOffsetTracker) CommitOffset() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
 	o.currentOffset.Offset[common.PollSourceOffsetKey] = o.newOffset
 	o.finished = o.currentOffset.Offset[common.PollSourceOffsetKey] == nil
 	o.newOffset = &emptyOffset
@@ -51,6 +55,32 @@ func (o *ProductionSourceOffsetTracker) GetLastBatchTime() time.Time {
 	return o.lastBatchTime
 }
 
+// CommitEntityOffset commits the offset of a single entity read by a push origin, a nil offset removes the entity
+func (o *ProductionSourceOffsetTracker) CommitEntityOffset(entity string, offset *string) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	if offset == nil {
+		delete(o.currentOffset.Offset, entity)
+	} else {
+		o.currentOffset.Offset[entity] = offset
+	}
+	o.lastBatchTime = time.Now()
+	return store.SaveOffset(o.pipelineId, o.currentOffset)
+}
+
+// GetEntityOffsets returns the committed offsets of all entities read by a push origin
+func (o *ProductionSourceOffsetTracker) GetEntityOffsets() map[string]string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	entityOffsets := make(map[string]string)
+	for entity, offset := range o.currentOffset.Offset {
+		if entity != common.PollSourceOffsetKey && offset != nil {
+			entityOffsets[entity] = *offset
+		}
+	}
+	return entityOffsets
+}
+
 func NewProductionSourceOffsetTracker(pipelineId string) (*ProductionSourceOffsetTracker, error) {
 	if sourceOffset, err := store.GetOffset(pipelineId); err == nil {
 		return &ProductionSourceOffsetTracker{
@@ -0,0 +1,228 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package runner
+
+import (
+	"errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/streamsets/datacollector-edge/api"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"time"
+)
+
+// entityOffsetTracker is implemented by offset trackers which can commit offsets per entity for push origins
+type entityOffsetTracker interface {
+	CommitEntityOffset(entity string, offset *string) error
+	GetEntityOffsets() map[string]string
+}
+
+// pipeRunner processes the batches pushed by a PushOrigin. Every runner has its own instances of the
+// processor and destination stages and its own sinks, so runners process batches in parallel.
+type pipeRunner struct {
+	runnerId  int
+	pipes     []Pipe
+	errorSink *common.ErrorSink
+	eventSink *common.EventSink
+}
+
+type batchContextImpl struct {
+	runner     *pipeRunner
+	batchMaker *BatchMakerImpl
+	start      time.Time
+	capture    *snapshotCapture
+}
+
+func (b *batchContextImpl) GetBatchMaker() api.BatchMaker {
+	return b.batchMaker
+}
+
+type pushContextImpl struct {
+	pipeline      *Pipeline
+	offsetTracker entityOffsetTracker
+}
+
+func (c *pushContextImpl) StartBatch() api.BatchContext {
+	p := c.pipeline
+	batchContext := &batchContextImpl{
+		batchMaker: NewBatchMakerImpl(*p.pipes[0].(*StagePipe), false),
+		start:      time.Now(),
+	}
+
+	select {
+	case batchContext.runner = <-p.idleRunners:
+	case <-p.stopChan:
+		// Pipeline is stopping, ProcessBatch reports the batch as failed
+		return batchContext
+	}
+
+	if p.rateLimiter != nil {
+		if throttleTime := p.rateLimiter.Wait(p.stopChan); throttleTime > 0 {
+			p.rateLimitThrottleTimer.Update(throttleTime)
+		}
+	}
+
+	if p.spoolQueue == nil {
+		// Spooled batches are captured when they are delivered by the drain loop
+		batchContext.capture = p.startSnapshotBatch()
+	}
+	if batchContext.capture != nil {
+		batchContext.batchMaker = NewBatchMakerImpl(*p.pipes[0].(*StagePipe), true)
+	}
+
+	batchContext.runner.errorSink.ClearErrorRecordsAndMessages()
+	batchContext.runner.eventSink.ClearEventRecords()
+	batchContext.start = time.Now()
+	return batchContext
+}
+
+func (c *pushContextImpl) ProcessBatch(batchContext api.BatchContext, entityName string, offset *string) bool {
+	batchContextImpl := batchContext.(*batchContextImpl)
+	if batchContextImpl.runner == nil {
+		return false
+	}
+	defer func() {
+		c.pipeline.idleRunners <- batchContextImpl.runner
+	}()
+
+	if err := c.pipeline.runPushedBatch(batchContextImpl, c.offsetTracker, entityName, offset); err != nil {
+		log.WithError(err).WithField("runner", batchContextImpl.runner.runnerId).Error("Error while processing batch")
+		log.Info("Stopping Pipeline")
+		c.pipeline.stopWithError(err)
+		return false
+	}
+	return true
+}
+
+// runPushed runs the push origin until it returns, and waits for the batches still being processed
+func (p *Pipeline) runPushed(pushOrigin api.PushOrigin) error {
+	offsetTracker, ok := p.offsetTracker.(entityOffsetTracker)
+	if !ok {
+		return errors.New("offset tracker does not support push origins")
+	}
+
+	pushContext := &pushContextImpl{pipeline: p, offsetTracker: offsetTracker}
+	err := pushOrigin.Run(offsetTracker.GetEntityOffsets(), p.batchSize, pushContext)
+
+	for range p.runners {
+		<-p.idleRunners
+	}
+	return err
+}
+
+func (p *Pipeline) runPushedBatch(
+	batchContext *batchContextImpl,
+	offsetTracker entityOffsetTracker,
+	entityName string,
+	offset *string,
+) error {
+	runner := batchContext.runner
+	originPipe := p.pipes[0].(*StagePipe)
+	originInstanceName := originPipe.GetInstanceName()
+
+	// The origin reports errors and events of all its goroutines to the shared origin sinks
+	p.errorSink.TransferStageErrors(originInstanceName, runner.errorSink)
+	p.eventSink.TransferStageEvents(originInstanceName, runner.eventSink)
+	if stageContextImpl, ok := originPipe.GetStageContext().(*common.StageContextImpl); ok {
+		if err := stageContextImpl.GetStopPipelineError(); err != nil {
+			return err
+		}
+	}
+
+	pipeBatch := NewFullPipeBatch(
+		&fixedOffsetTracker{offset: offset},
+		p.batchSize,
+		runner.errorSink,
+		runner.eventSink,
+		batchContext.capture != nil,
+	)
+	originPipe.CompletePushedBatch(pipeBatch, batchContext.batchMaker, batchContext.start)
+
+	committed := false
+	if p.spoolQueue != nil {
+		// The spooled batch is delivered by the drain loop
+		if err := p.spoolQueue.Add(offset, pipeBatch.(*FullPipeBatch).fullPayload); err != nil {
+			return err
+		}
+	} else {
+		for _, pipe := range runner.pipes {
+			if p.pipelineBean.Config.DeliveryGuarantee == AtMostOnce && pipe.IsTarget() && !committed {
+				if err := p.commitEntityOffset(offsetTracker, entityName, offset); err != nil {
+					return err
+				}
+				committed = true
+			}
+
+			if err := pipe.Process(pipeBatch); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := p.processErrorRecords(runner.errorSink, offset); err != nil {
+		return err
+	}
+
+	if p.spoolQueue == nil {
+		p.rulesEvaluator.evaluateDataRules(pipeBatch)
+	}
+
+	if !committed {
+		if err := p.commitEntityOffset(offsetTracker, entityName, offset); err != nil {
+			return err
+		}
+	}
+
+	if p.rateLimiter != nil {
+		p.rateLimiter.Take(pipeBatch.GetInputRecords())
+	}
+
+	p.batchProcessingTimer.UpdateSince(batchContext.start)
+	p.batchCountCounter.Inc(1)
+	p.batchCountMeter.Mark(1)
+	if p.isMaxBatchesReached() {
+		// The push origin is stopped, batches pushed concurrently are still completed
+		p.Stop()
+	}
+
+	p.updateInputRecordsMetrics(pipeBatch.GetInputRecords())
+	if p.spoolQueue == nil {
+		p.updateOutputRecordsMetrics(pipeBatch.GetOutputRecords())
+	}
+	p.updateErrorMetrics(pipeBatch.GetErrorRecords(), pipeBatch.GetErrorMessages())
+
+	if batchContext.capture != nil {
+		p.completeSnapshotBatch(batchContext.capture, pipeBatch.GetSnapshotsOfAllStagesOutput())
+	}
+	if p.spoolQueue == nil {
+		p.tapLanes(pipeBatch)
+	}
+
+	p.retainErrors(runner.errorSink)
+
+	if p.onBatchSuccess != nil {
+		p.pushMutex.Lock()
+		p.onBatchSuccess()
+		p.pushMutex.Unlock()
+	}
+
+	return nil
+}
+
+// commitEntityOffset commits the offset of a pushed batch, following the same forced stop rules as commitOffset
+func (p *Pipeline) commitEntityOffset(offsetTracker entityOffsetTracker, entityName string, offset *string) error {
+	if p.isForceStopped() && p.pipelineBean.Config.DeliveryGuarantee != AtMostOnce {
+		log.WithField("entity", entityName).Warn("Pipeline was forced to stop, skipping offset commit")
+		return nil
+	}
+	return offsetTracker.CommitEntityOffset(entityName, offset)
+}
@@ -0,0 +1,184 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package runner
+
+import (
+	"github.com/rcrowley/go-metrics"
+	"github.com/streamsets/datacollector-edge/api"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"github.com/streamsets/datacollector-edge/container/creation"
+	"github.com/streamsets/datacollector-edge/container/execution"
+	"github.com/streamsets/datacollector-edge/container/execution/store"
+	"github.com/streamsets/datacollector-edge/stages/stagelibrary"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+const (
+	pushTestLibrary          = "push-test-lib"
+	pushTestOriginName       = "pushOrigin"
+	pushTestDestinationName  = "pushDestination"
+	pushTestThreads          = 4
+	pushTestBatchesPerThread = 5
+)
+
+var (
+	pushTestDestinations      []*pushTestDestination
+	pushTestDestinationsMutex sync.Mutex
+)
+
+type pushTestOrigin struct {
+	*common.BaseStage
+}
+
+func (o *pushTestOrigin) GetNumberOfThreads() int {
+	return pushTestThreads
+}
+
+func (o *pushTestOrigin) Run(lastOffsets map[string]string, maxBatchSize int, pushContext api.PushContext) error {
+	var waitGroup sync.WaitGroup
+	for thread := 0; thread < pushTestThreads; thread++ {
+		waitGroup.Add(1)
+		go func(entityName string) {
+			defer waitGroup.Done()
+			for i := 1; i <= pushTestBatchesPerThread; i++ {
+				batchContext := pushContext.StartBatch()
+				for j := 0; j < 2; j++ {
+					record, _ := o.GetStageContext().CreateRecord(entityName, map[string]interface{}{"batch": i})
+					batchContext.GetBatchMaker().AddRecord(record)
+				}
+				offset := strconv.Itoa(i)
+				pushContext.ProcessBatch(batchContext, entityName, &offset)
+			}
+		}("entity" + strconv.Itoa(thread))
+	}
+	waitGroup.Wait()
+	return nil
+}
+
+type pushTestDestination struct {
+	*common.BaseStage
+	records int
+}
+
+func (d *pushTestDestination) Write(batch api.Batch) error {
+	d.records += len(batch.GetRecords())
+	return nil
+}
+
+func init() {
+	stagelibrary.SetCreator(pushTestLibrary, pushTestOriginName, func() api.Stage {
+		return &pushTestOrigin{BaseStage: &common.BaseStage{}}
+	})
+	stagelibrary.SetCreator(pushTestLibrary, pushTestDestinationName, func() api.Stage {
+		destination := &pushTestDestination{BaseStage: &common.BaseStage{}}
+		pushTestDestinationsMutex.Lock()
+		pushTestDestinations = append(pushTestDestinations, destination)
+		pushTestDestinationsMutex.Unlock()
+		return destination
+	})
+}
+
+func getPushTestStageConfig(instanceName string, stageName string, stageType string) *common.StageConfiguration {
+	return &common.StageConfiguration{
+		InstanceName:  instanceName,
+		Library:       pushTestLibrary,
+		StageName:     stageName,
+		Configuration: []common.Config{},
+		UiInfo:        map[string]interface{}{creation.STAGE_TYPE: stageType},
+		InputLanes:    []string{},
+		OutputLanes:   []string{},
+		EventLanes:    []string{},
+	}
+}
+
+func TestPipeline_PushOriginRunners(t *testing.T) {
+	var err error
+	store.BaseDir, err = ioutil.TempDir("", "push_context_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store.BaseDir)
+	pushTestDestinations = nil
+
+	// Creates the pipeline run info directory
+	if _, err := store.GetState("pushPipeline"); err != nil {
+		t.Fatal(err)
+	}
+
+	originConfig := getPushTestStageConfig("origin1", pushTestOriginName, creation.SOURCE)
+	originConfig.OutputLanes = []string{"lane1"}
+	destinationConfig := getPushTestStageConfig("destination1", pushTestDestinationName, creation.TARGET)
+	destinationConfig.InputLanes = []string{"lane1"}
+	pipelineConfig := common.PipelineConfiguration{
+		PipelineId: "pushPipeline",
+		Configuration: []common.Config{
+			{Name: creation.DeliveryGuarantee, Value: AtLeastOnce},
+			{Name: creation.MaxRunners, Value: float64(2)},
+		},
+		Stages:     []*common.StageConfiguration{originConfig, destinationConfig},
+		ErrorStage: getPushTestStageConfig("errorStage", pushTestDestinationName, creation.TARGET),
+	}
+
+	offsetTracker, err := NewProductionSourceOffsetTracker(pipelineConfig.PipelineId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pipeline, issues := NewPipeline(execution.NewConfig(), pipelineConfig, offsetTracker, nil, metrics.NewRegistry())
+	if len(issues) > 0 {
+		t.Fatal(issues[0].Message)
+	}
+	if len(pipeline.runners) != 2 {
+		t.Fatalf("Expected 2 runners limited by maxRunners, but got: %d", len(pipeline.runners))
+	}
+	if issues := pipeline.Init(); len(issues) > 0 {
+		t.Fatal(issues[0].Message)
+	}
+	if err := pipeline.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Error stage plus one destination instance per runner
+	if len(pushTestDestinations) != 3 {
+		t.Fatalf("Expected 3 destination instances, but got: %d", len(pushTestDestinations))
+	}
+	totalRecords := 0
+	for _, destination := range pushTestDestinations {
+		totalRecords += destination.records
+	}
+	expectedRecords := pushTestThreads * pushTestBatchesPerThread * 2
+	if totalRecords != expectedRecords {
+		t.Errorf("Expected %d records written, but got: %d", expectedRecords, totalRecords)
+	}
+
+	if batchCount := pipeline.batchCountCounter.Count(); batchCount != pushTestThreads*pushTestBatchesPerThread {
+		t.Errorf("Expected %d batches, but got: %d", pushTestThreads*pushTestBatchesPerThread, batchCount)
+	}
+	stageInputRecords := pipeline.runners[1].pipes[0].(*StagePipe).inputRecordsCounter.Count()
+	if stageInputRecords != int64(expectedRecords) {
+		t.Errorf("Expected destination metrics to aggregate %d records, but got: %d", expectedRecords, stageInputRecords)
+	}
+
+	entityOffsets := offsetTracker.GetEntityOffsets()
+	if len(entityOffsets) != pushTestThreads {
+		t.Fatalf("Expected %d entity offsets, but got: %v", pushTestThreads, entityOffsets)
+	}
+	for entity, offset := range entityOffsets {
+		if offset != strconv.Itoa(pushTestBatchesPerThread) {
+			t.Errorf("Expected offset %d for entity %s, but got: %s", pushTestBatchesPerThread, entity, offset)
+		}
+	}
+}
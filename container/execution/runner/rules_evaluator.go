@@ -0,0 +1,304 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package runner
+
+import (
+	"context"
+	"fmt"
+	"github.com/madhukard/govaluate"
+	"github.com/rcrowley/go-metrics"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+	"github.com/streamsets/datacollector-edge/api"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"github.com/streamsets/datacollector-edge/container/el"
+	"github.com/streamsets/datacollector-edge/container/util"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	MetricRulesInterval         = 5 * time.Second
+	PipelineAlerts              = "pipeline.alerts"
+	AlertEventType              = "alert"
+	AlertEventVersion           = 1
+	dataRuleMetricsPrefix       = "user."
+	dataRuleEvaluatedSuffix     = ".evaluated"
+	dataRuleMatchedSuffix       = ".matched"
+	ruleConditionConfigName     = "condition"
+	alertEventRecordSourceId    = "alert"
+	ruleConditionEvaluationLog  = "Failed to evaluate rule condition"
+	unknownMetricElementMessage = "Unsupported metric element"
+)
+
+// RulesEvaluator evaluates the data rules on the records of every batch and the metric rules every interval.
+// An alert is raised once per rule, until it is deleted, and emitted as an alert event record to the stats
+// aggregator stage of the pipeline.
+type RulesEvaluator struct {
+	pipelineId      string
+	dataRules       []*common.DataRuleDefinition
+	metricRules     []*common.MetricsRuleDefinition
+	metricRegistry  metrics.Registry
+	stageContext    api.StageContext
+	statsAggregator *StatsAggregator
+	interval        time.Duration
+	alerts          map[string]*common.Alert
+	alertsMutex     sync.RWMutex
+	dataRulesMutex  sync.Mutex
+	alertsCounter   metrics.Counter
+}
+
+// Run evaluates the metric rules every interval until the stop channel is closed
+func (r *RulesEvaluator) Run(stop <-chan struct{}) {
+	if len(r.metricRules) == 0 {
+		return
+	}
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			r.evaluateMetricRules()
+		case <-stop:
+			return
+		}
+	}
+}
+
+// evaluateDataRules samples the records of the rule lanes in the batch, the pipe batch must be fully processed
+func (r *RulesEvaluator) evaluateDataRules(pipeBatch PipeBatch) {
+	if len(r.dataRules) == 0 {
+		return
+	}
+	fullPayload := pipeBatch.(*FullPipeBatch).fullPayload
+
+	r.dataRulesMutex.Lock()
+	defer r.dataRulesMutex.Unlock()
+	for _, dataRule := range r.dataRules {
+		records := fullPayload[dataRule.Lane]
+		if len(records) == 0 {
+			continue
+		}
+
+		evaluatedCounter := util.CreateCounter(r.metricRegistry, dataRuleMetricsPrefix+dataRule.Id+dataRuleEvaluatedSuffix)
+		matchedCounter := util.CreateCounter(r.metricRegistry, dataRuleMetricsPrefix+dataRule.Id+dataRuleMatchedSuffix)
+		for _, record := range records {
+			if rand.Float64()*100 >= dataRule.SamplingPercentage {
+				continue
+			}
+			evaluatedCounter.Inc(1)
+			if r.matchesRecord(dataRule.Condition, record) {
+				matchedCounter.Inc(1)
+				if dataRule.MeterEnabled {
+					util.CreateMeter(r.metricRegistry, dataRuleMetricsPrefix+dataRule.Id+dataRuleMatchedSuffix).Mark(1)
+				}
+			}
+		}
+
+		if dataRule.AlertEnabled {
+			if value, exceeded := exceedsThreshold(dataRule, evaluatedCounter.Count(), matchedCounter.Count()); exceeded {
+				r.raiseAlert(dataRule.Id, dataRule, value, dataRule.AlertText)
+			}
+		}
+	}
+}
+
+func (r *RulesEvaluator) matchesRecord(condition string, record api.Record) bool {
+	recordContext := context.WithValue(context.Background(), el.RecordContextVar, record)
+	result, err := r.stageContext.Evaluate(condition, ruleConditionConfigName, recordContext)
+	if err != nil {
+		log.WithError(err).WithField("condition", condition).Debug(ruleConditionEvaluationLog)
+		return false
+	}
+	return cast.ToBool(result)
+}
+
+// exceedsThreshold returns the count or percentage of matching records and whether it exceeds the threshold
+func exceedsThreshold(dataRule *common.DataRuleDefinition, evaluated int64, matched int64) (interface{}, bool) {
+	threshold := cast.ToFloat64(dataRule.ThresholdValue)
+	if dataRule.ThresholdType == common.ThresholdTypePercentage {
+		if evaluated == 0 || evaluated < dataRule.MinVolume {
+			return 0, false
+		}
+		percentage := float64(matched) * 100 / float64(evaluated)
+		return percentage, percentage > threshold
+	}
+	return matched, float64(matched) > threshold
+}
+
+func (r *RulesEvaluator) evaluateMetricRules() {
+	for _, metricRule := range r.metricRules {
+		value, err := getMetricElementValue(r.metricRegistry, metricRule)
+		if err != nil {
+			log.WithError(err).WithField("rule", metricRule.Id).Debug(ruleConditionEvaluationLog)
+			continue
+		}
+
+		evaluator, _ := el.NewEvaluator(
+			ruleConditionConfigName,
+			nil,
+			[]el.Definitions{&el.StringEL{}, &el.MathEL{}, &metricValueEL{value: value}},
+		)
+		result, err := evaluator.Evaluate(metricRule.Condition)
+		if err != nil {
+			log.WithError(err).WithField("condition", metricRule.Condition).Debug(ruleConditionEvaluationLog)
+			continue
+		}
+		if cast.ToBool(result) {
+			r.raiseAlert(metricRule.Id, metricRule, value, metricRule.AlertText)
+		}
+	}
+}
+
+// getMetricElementValue returns the value of the metric element, the metric id may omit the metric type suffix
+func getMetricElementValue(metricRegistry metrics.Registry, metricRule *common.MetricsRuleDefinition) (interface{}, error) {
+	metric := metricRegistry.Get(metricRule.MetricId)
+	if metric == nil {
+		metric = metricRegistry.Get(metricRule.MetricId + "." + strings.ToLower(metricRule.MetricType))
+	}
+	if metric == nil {
+		return nil, fmt.Errorf("metric '%s' not found", metricRule.MetricId)
+	}
+
+	// COUNTER_COUNT is count, METER_M1_RATE is m1_rate and TIMER_P99 is p99 in the formatted metric
+	element := metricRule.MetricElement
+	if i := strings.Index(element, "_"); i >= 0 {
+		element = element[i+1:]
+	}
+	switch element {
+	case "STD_DEV":
+		element = "stddev"
+	case "MEDIAN":
+		element = "p50"
+	}
+	value, ok := util.FormatMetric(metric)[strings.ToLower(element)]
+	if !ok {
+		return nil, fmt.Errorf("%s '%s'", unknownMetricElementMessage, metricRule.MetricElement)
+	}
+	return value, nil
+}
+
+func (r *RulesEvaluator) raiseAlert(ruleId string, ruleDefinition interface{}, value interface{}, alertText string) {
+	r.alertsMutex.Lock()
+	if _, ok := r.alerts[ruleId]; ok {
+		r.alertsMutex.Unlock()
+		return
+	}
+	alert := &common.Alert{
+		PipelineName:   r.pipelineId,
+		RuleDefinition: ruleDefinition,
+		Gauge: common.AlertGauge{
+			Value: common.AlertGaugeValue{
+				CurrentValue: value,
+				Timestamp:    util.ConvertTimeToLong(time.Now()),
+				AlertTexts:   []string{alertText},
+			},
+		},
+	}
+	r.alerts[ruleId] = alert
+	r.alertsMutex.Unlock()
+
+	r.alertsCounter.Inc(1)
+	log.WithField("rule", ruleId).WithField("value", value).Warnf("Alert: %s", alertText)
+	r.emitAlertEvent(ruleId, alert)
+}
+
+func (r *RulesEvaluator) emitAlertEvent(ruleId string, alert *common.Alert) {
+	if r.statsAggregator == nil {
+		return
+	}
+	record, err := r.stageContext.CreateEventRecord(
+		alertEventRecordSourceId,
+		map[string]interface{}{
+			"pipelineId":   alert.PipelineName,
+			"ruleId":       ruleId,
+			"alertText":    alert.Gauge.Value.AlertTexts[0],
+			"currentValue": cast.ToString(alert.Gauge.Value.CurrentValue),
+			"timestamp":    alert.Gauge.Value.Timestamp,
+		},
+		AlertEventType,
+		AlertEventVersion,
+	)
+	if err != nil {
+		log.WithError(err).Error("Failed to create alert event record")
+		return
+	}
+	r.statsAggregator.writeRecord(record)
+}
+
+// GetAlerts returns the triggered alerts
+func (r *RulesEvaluator) GetAlerts() []*common.Alert {
+	r.alertsMutex.RLock()
+	defer r.alertsMutex.RUnlock()
+	alerts := make([]*common.Alert, 0, len(r.alerts))
+	for _, alert := range r.alerts {
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+// DeleteAlert removes the alert of the rule, the rule raises a new alert when it matches again
+func (r *RulesEvaluator) DeleteAlert(ruleId string) bool {
+	r.alertsMutex.Lock()
+	defer r.alertsMutex.Unlock()
+	if _, ok := r.alerts[ruleId]; !ok {
+		return false
+	}
+	delete(r.alerts, ruleId)
+	return true
+}
+
+// metricValueEL provides the value() function to metric rule conditions
+type metricValueEL struct {
+	value interface{}
+}
+
+func (m *metricValueEL) GetELFunctionDefinitions() map[string]govaluate.ExpressionFunction {
+	return map[string]govaluate.ExpressionFunction{
+		"value": func(args ...interface{}) (interface{}, error) {
+			return cast.ToFloat64(m.value), nil
+		},
+	}
+}
+
+func NewRulesEvaluator(
+	pipelineConfig common.PipelineConfiguration,
+	stageContext api.StageContext,
+	statsAggregator *StatsAggregator,
+	metricRegistry metrics.Registry,
+) *RulesEvaluator {
+	rulesEvaluator := &RulesEvaluator{
+		pipelineId:      pipelineConfig.PipelineId,
+		metricRegistry:  metricRegistry,
+		stageContext:    stageContext,
+		statsAggregator: statsAggregator,
+		interval:        MetricRulesInterval,
+		alerts:          make(map[string]*common.Alert),
+		alertsCounter:   util.CreateCounter(metricRegistry, PipelineAlerts),
+	}
+	if pipelineConfig.RuleDefinitions != nil {
+		for _, dataRule := range pipelineConfig.RuleDefinitions.DataRuleDefinitions {
+			if dataRule.Enabled {
+				rulesEvaluator.dataRules = append(rulesEvaluator.dataRules, dataRule)
+			}
+		}
+		for _, metricRule := range pipelineConfig.RuleDefinitions.MetricsRuleDefinitions {
+			if metricRule.Enabled {
+				rulesEvaluator.metricRules = append(rulesEvaluator.metricRules, metricRule)
+			}
+		}
+	}
+	return rulesEvaluator
+}
@@ -0,0 +1,133 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package runner
+
+import (
+	"github.com/rcrowley/go-metrics"
+	"github.com/streamsets/datacollector-edge/api"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"github.com/streamsets/datacollector-edge/container/util"
+	"testing"
+)
+
+func TestRulesEvaluator(t *testing.T) {
+	stageContext := &common.StageContextImpl{StageConfig: &common.StageConfiguration{InstanceName: "origin1"}}
+	pipelineConfig := common.PipelineConfiguration{
+		PipelineId: "rulesPipeline",
+		RuleDefinitions: &common.RuleDefinitions{
+			DataRuleDefinitions: []*common.DataRuleDefinition{
+				{
+					Id:                 "countRule",
+					Lane:               "lane1",
+					SamplingPercentage: 100,
+					Condition:          "${1 < 2}",
+					AlertEnabled:       true,
+					AlertText:          "More than 2 records",
+					ThresholdType:      common.ThresholdTypeCount,
+					ThresholdValue:     "2",
+					MeterEnabled:       true,
+					Enabled:            true,
+				},
+				{
+					Id:                 "percentageRule",
+					Lane:               "lane1",
+					SamplingPercentage: 100,
+					Condition:          "${1 < 2}",
+					AlertEnabled:       true,
+					ThresholdType:      common.ThresholdTypePercentage,
+					ThresholdValue:     "50",
+					MinVolume:          10,
+					Enabled:            true,
+				},
+				{
+					Id:                 "disabledRule",
+					Lane:               "lane1",
+					SamplingPercentage: 100,
+					Condition:          "${1 < 2}",
+					AlertEnabled:       true,
+					ThresholdValue:     "0",
+				},
+			},
+			MetricsRuleDefinitions: []*common.MetricsRuleDefinition{
+				{
+					Id:            "batchCountRule",
+					AlertText:     "More than 1 batch",
+					MetricId:      PipelineBatchCount,
+					MetricType:    common.MetricTypeCounter,
+					MetricElement: "COUNTER_COUNT",
+					Condition:     "${value() > 1}",
+					Enabled:       true,
+				},
+			},
+		},
+	}
+	metricRegistry := metrics.NewRegistry()
+	rulesEvaluator := NewRulesEvaluator(pipelineConfig, stageContext, nil, metricRegistry)
+
+	evaluateBatch := func() {
+		pipeBatch := NewFullPipeBatch(&fixedOffsetTracker{}, 10, common.NewErrorSink(), common.NewEventSink(), false)
+		records := make([]api.Record, 0)
+		for i := 0; i < 2; i++ {
+			record, _ := stageContext.CreateRecord("record", map[string]interface{}{"a": i})
+			records = append(records, record)
+		}
+		pipeBatch.(*FullPipeBatch).fullPayload["lane1"] = records
+		rulesEvaluator.evaluateDataRules(pipeBatch)
+	}
+
+	evaluateBatch()
+	if len(rulesEvaluator.GetAlerts()) != 0 {
+		t.Fatalf("Expected no alerts after 2 matching records, but got: %d", len(rulesEvaluator.GetAlerts()))
+	}
+	evaluateBatch()
+	alerts := rulesEvaluator.GetAlerts()
+	if len(alerts) != 1 {
+		t.Fatalf("Expected 1 alert after 4 matching records, but got: %d", len(alerts))
+	}
+	if alerts[0].RuleDefinition.(*common.DataRuleDefinition).Id != "countRule" ||
+		alerts[0].Gauge.Value.CurrentValue != int64(4) {
+		t.Errorf("Expected count rule alert with value 4, but got: %v", alerts[0])
+	}
+	if matched := util.CreateCounter(metricRegistry, "user.countRule.matched").Count(); matched != 4 {
+		t.Errorf("Expected 4 matched records, but got: %d", matched)
+	}
+	if metricRegistry.Get("user.countRule.matched.meter") == nil {
+		t.Error("Expected the matched records meter to be registered")
+	}
+
+	// Percentage rules are evaluated once the minimum volume is reached
+	for i := 0; i < 3; i++ {
+		evaluateBatch()
+	}
+	if len(rulesEvaluator.GetAlerts()) != 2 {
+		t.Fatalf("Expected 2 alerts, but got: %d", len(rulesEvaluator.GetAlerts()))
+	}
+
+	util.CreateCounter(metricRegistry, PipelineBatchCount).Inc(1)
+	rulesEvaluator.evaluateMetricRules()
+	if len(rulesEvaluator.GetAlerts()) != 2 {
+		t.Fatalf("Expected no metric alert for 1 batch, but got: %d alerts", len(rulesEvaluator.GetAlerts()))
+	}
+	util.CreateCounter(metricRegistry, PipelineBatchCount).Inc(1)
+	rulesEvaluator.evaluateMetricRules()
+	if len(rulesEvaluator.GetAlerts()) != 3 {
+		t.Fatalf("Expected metric alert for 2 batches, but got: %d alerts", len(rulesEvaluator.GetAlerts()))
+	}
+
+	if !rulesEvaluator.DeleteAlert("batchCountRule") || rulesEvaluator.DeleteAlert("batchCountRule") {
+		t.Error("Expected the metric alert to be deleted once")
+	}
+	if count := util.CreateCounter(metricRegistry, PipelineAlerts).Count(); count != 3 {
+		t.Errorf("Expected 3 raised alerts, but got: %d", count)
+	}
+}
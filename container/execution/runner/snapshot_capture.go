@@ -0,0 +1,135 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package runner
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/streamsets/datacollector-edge/container/execution"
+	"github.com/streamsets/datacollector-edge/container/execution/store"
+)
+
+const snapshotInProgressError = "CONTAINER_0060 - Snapshot '%s' is still being captured for pipeline '%s'"
+
+// snapshotCapture collects the output of every stage for the next batches processed by the pipeline
+type snapshotCapture struct {
+	snapshotId      string
+	batches         int
+	batchSize       int
+	startedBatches  int
+	snapshotBatches [][]interface{}
+}
+
+// CaptureSnapshot captures the stage outputs of the next batches and stores them as the named snapshot.
+// The snapshot is in progress until the batches are captured or the pipeline stops. A batch size greater
+// than 0 overrides the batch size of the origin while capturing.
+func (p *Pipeline) CaptureSnapshot(
+	snapshotId string,
+	label string,
+	user string,
+	batches int,
+	batchSize int,
+) (*store.SnapshotInfo, error) {
+	p.snapshotMutex.Lock()
+	defer p.snapshotMutex.Unlock()
+	if capture := p.snapshotCapture; capture != nil {
+		return nil, fmt.Errorf(snapshotInProgressError, capture.snapshotId, p.pipelineConf.PipelineId)
+	}
+
+	snapshotInfo, err := store.CreateSnapshot(p.pipelineConf.PipelineId, snapshotId, label, user)
+	if err != nil {
+		return nil, err
+	}
+	if batches <= 0 {
+		batches = 1
+	}
+	p.snapshotCapture = &snapshotCapture{
+		snapshotId:      snapshotId,
+		batches:         batches,
+		batchSize:       batchSize,
+		snapshotBatches: make([][]interface{}, 0, batches),
+	}
+	log.WithField("snapshot", snapshotId).WithField("batches", batches).Info("Capturing snapshot")
+	return snapshotInfo, nil
+}
+
+// startSnapshotBatch returns the snapshot capture if the batch starting now is captured
+func (p *Pipeline) startSnapshotBatch() *snapshotCapture {
+	p.snapshotMutex.Lock()
+	defer p.snapshotMutex.Unlock()
+	capture := p.snapshotCapture
+	if capture == nil || capture.startedBatches >= capture.batches {
+		return nil
+	}
+	capture.startedBatches++
+	return capture
+}
+
+// completeSnapshotBatch adds the stage outputs of a captured batch, the snapshot is saved once all its
+// batches are captured
+func (p *Pipeline) completeSnapshotBatch(capture *snapshotCapture, stageOutputs []execution.StageOutput) {
+	snapshotBatch := make([]interface{}, 0, len(stageOutputs))
+	for _, stageOutput := range stageOutputs {
+		stageOutputJson, err := execution.NewStageOutputJson(stageOutput)
+		if err != nil {
+			log.WithError(err).WithField("stage", stageOutput.InstanceName).Error("Failed to capture stage output")
+			continue
+		}
+		snapshotBatch = append(snapshotBatch, stageOutputJson)
+	}
+
+	p.snapshotMutex.Lock()
+	defer p.snapshotMutex.Unlock()
+	if p.snapshotCapture != capture {
+		return
+	}
+	capture.snapshotBatches = append(capture.snapshotBatches, snapshotBatch)
+	if len(capture.snapshotBatches) >= capture.batches {
+		p.saveSnapshot()
+	}
+}
+
+// finishSnapshot saves the batches captured so far when the pipeline stops before the snapshot is complete
+func (p *Pipeline) finishSnapshot() {
+	p.snapshotMutex.Lock()
+	defer p.snapshotMutex.Unlock()
+	if p.snapshotCapture != nil {
+		p.saveSnapshot()
+	}
+}
+
+func (p *Pipeline) saveSnapshot() {
+	capture := p.snapshotCapture
+	p.snapshotCapture = nil
+	err := store.SaveSnapshotData(
+		p.pipelineConf.PipelineId,
+		capture.snapshotId,
+		store.SnapshotData{SnapshotBatches: capture.snapshotBatches},
+		p.batchCountCounter.Count(),
+	)
+	if err != nil {
+		log.WithError(err).WithField("snapshot", capture.snapshotId).Error("Failed to save snapshot")
+		return
+	}
+	log.WithField("snapshot", capture.snapshotId).Info("Captured snapshot")
+}
+
+// DeleteSnapshot stops capturing the snapshot if it is in progress and removes it
+func (p *Pipeline) DeleteSnapshot(snapshotId string) error {
+	p.snapshotMutex.Lock()
+	defer p.snapshotMutex.Unlock()
+	if capture := p.snapshotCapture; capture != nil && capture.snapshotId == snapshotId {
+		p.snapshotCapture = nil
+	}
+	return store.DeleteSnapshot(p.pipelineConf.PipelineId, snapshotId)
+}
@@ -0,0 +1,98 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package runner
+
+import (
+	"encoding/json"
+	"github.com/streamsets/datacollector-edge/container/execution"
+	"github.com/streamsets/datacollector-edge/container/execution/store"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestPipeline_CaptureSnapshot(t *testing.T) {
+	var err error
+	store.BaseDir, err = ioutil.TempDir("", "snapshot_capture_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(store.BaseDir)
+
+	pipeline, _ := getStopTestPipeline(t)
+	close(stopTestOriginInstance.release)
+
+	snapshotInfo, err := pipeline.CaptureSnapshot("snapshot1", "label1", "admin", 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !snapshotInfo.InProgress || snapshotInfo.Label != "label1" {
+		t.Errorf("Expected snapshot label1 to be in progress, but got: %+v", snapshotInfo)
+	}
+	if _, err := pipeline.CaptureSnapshot("snapshot2", "", "admin", 1, 0); err == nil {
+		t.Error("Expected an error capturing a second snapshot while the first one is in progress")
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := pipeline.runBatch(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snapshotInfo, err = store.GetSnapshotInfo("stopPipeline", "snapshot1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshotInfo.InProgress || snapshotInfo.BatchNumber != 2 {
+		t.Errorf("Expected the snapshot to be completed after batch 2, but got: %+v", snapshotInfo)
+	}
+
+	snapshotDataJson, err := store.GetSnapshotData("stopPipeline", "snapshot1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	snapshotData := struct {
+		SnapshotBatches [][]execution.StageOutputJson `json:"snapshotBatches"`
+	}{}
+	if err := json.Unmarshal(snapshotDataJson, &snapshotData); err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshotData.SnapshotBatches) != 2 {
+		t.Fatalf("Expected 2 snapshot batches, but got: %d", len(snapshotData.SnapshotBatches))
+	}
+	for _, snapshotBatch := range snapshotData.SnapshotBatches {
+		if len(snapshotBatch) != 2 || snapshotBatch[0].InstanceName != "origin1" ||
+			snapshotBatch[1].InstanceName != "destination1" {
+			t.Fatalf("Expected the output of origin1 and destination1, but got: %+v", snapshotBatch)
+		}
+		originOutput := snapshotBatch[0].Output["lane1"]
+		if len(originOutput) != 1 || originOutput[0].Header.SourceId != "record1" {
+			t.Errorf("Expected the origin record in lane1, but got: %+v", originOutput)
+		}
+	}
+
+	snapshotsInfo, err := store.GetSnapshotsInfo("stopPipeline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshotsInfo) != 1 || snapshotsInfo[0].Id != "snapshot1" {
+		t.Errorf("Expected snapshot1 to be listed, but got: %+v", snapshotsInfo)
+	}
+
+	if err := pipeline.DeleteSnapshot("snapshot1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetSnapshotInfo("stopPipeline", "snapshot1"); err == nil {
+		t.Error("Expected the deleted snapshot to be gone")
+	}
+}
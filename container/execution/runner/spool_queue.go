@@ -0,0 +1,317 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package runner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rcrowley/go-metrics"
+	log "github.com/sirupsen/logrus"
+	"github.com/streamsets/datacollector-edge/api"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"github.com/streamsets/datacollector-edge/container/recordio/sdcrecord"
+	"github.com/streamsets/datacollector-edge/container/util"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SpoolBacklogBytes       = "pipeline.spoolBacklogBytes"
+	SpoolBacklogRecords     = "pipeline.spoolBacklogRecords"
+	SpoolEvictedRecords     = "pipeline.spoolEvictedRecords"
+	SpoolDrainRetryInterval = 10 * time.Second
+	spoolBatchFileSuffix    = ".batch"
+	spoolBatchFileFormat    = "%020d-%d" + spoolBatchFileSuffix
+)
+
+// SpooledBatch is an origin batch persisted in the store and forward queue until it is delivered
+type SpooledBatch struct {
+	Sequence     int64                             `json:"-"`
+	SourceOffset *string                           `json:"sourceOffset"`
+	Lanes        map[string][]*sdcrecord.SDCRecord `json:"lanes"`
+	records      map[string][]api.Record
+}
+
+type spoolEntry struct {
+	sequence    int64
+	recordCount int64
+	size        int64
+}
+
+// SpoolQueue is a disk backed FIFO queue of origin batches. Every batch is stored in its own file, named
+// after its sequence number and record count so the queue can be rebuilt from the directory listing
+// after a restart. When the size cap is reached the oldest batches are evicted.
+type SpoolQueue struct {
+	dir                   string
+	maxSizeBytes          int64
+	mutex                 sync.Mutex
+	entries               []spoolEntry
+	nextSequence          int64
+	backlogBytes          int64
+	backlogRecords        int64
+	notify                chan struct{}
+	backlogBytesGauge     metrics.Gauge
+	backlogRecordsGauge   metrics.Gauge
+	evictedRecordsCounter metrics.Counter
+}
+
+// Add durably stores the given lanes, it returns once the batch is synced to disk. Empty batches are not spooled.
+func (q *SpoolQueue) Add(sourceOffset *string, lanes map[string][]api.Record) error {
+	spooledBatch := SpooledBatch{
+		SourceOffset: sourceOffset,
+		Lanes:        make(map[string][]*sdcrecord.SDCRecord),
+	}
+	recordCount := int64(0)
+	for lane, records := range lanes {
+		sdcRecords := make([]*sdcrecord.SDCRecord, len(records))
+		for i, record := range records {
+			sdcRecord, err := sdcrecord.NewSdcRecordFromRecord(record)
+			if err != nil {
+				return err
+			}
+			sdcRecords[i] = sdcRecord
+		}
+		spooledBatch.Lanes[lane] = sdcRecords
+		recordCount += int64(len(records))
+	}
+
+	if recordCount == 0 {
+		return nil
+	}
+
+	batchJson, err := json.Marshal(spooledBatch)
+	if err != nil {
+		return err
+	}
+
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	size := int64(len(batchJson))
+	for q.maxSizeBytes > 0 && len(q.entries) > 0 && q.backlogBytes+size > q.maxSizeBytes {
+		q.evictOldest()
+	}
+
+	entry := spoolEntry{sequence: q.nextSequence, recordCount: recordCount, size: size}
+	if err := util.WriteFileAtomic(q.getEntryFile(entry), batchJson, 0644); err != nil {
+		return err
+	}
+	q.nextSequence++
+	q.entries = append(q.entries, entry)
+	q.backlogBytes += size
+	q.backlogRecords += recordCount
+	q.updateGauges()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Peek returns the oldest spooled batch without removing it, or nil when the queue is empty.
+// Batches which can not be read back are dropped.
+func (q *SpoolQueue) Peek(stageContext api.StageContext) *SpooledBatch {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for len(q.entries) > 0 {
+		entry := q.entries[0]
+		spooledBatch, err := q.readEntry(entry, stageContext)
+		if err == nil {
+			return spooledBatch
+		}
+		log.WithError(err).WithField("file", q.getEntryFile(entry)).Error("Dropping unreadable spooled batch")
+		q.removeOldest()
+		q.evictedRecordsCounter.Inc(entry.recordCount)
+	}
+	return nil
+}
+
+// Remove deletes the spooled batch with the given sequence after it was delivered. The batch might
+// already be evicted while it was being delivered, in which case this is a no-op.
+func (q *SpoolQueue) Remove(sequence int64) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if len(q.entries) > 0 && q.entries[0].sequence == sequence {
+		q.removeOldest()
+	}
+}
+
+func (q *SpoolQueue) GetBacklogRecords() int64 {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.backlogRecords
+}
+
+func (q *SpoolQueue) GetBacklogBytes() int64 {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.backlogBytes
+}
+
+func (q *SpoolQueue) evictOldest() {
+	entry := q.removeOldest()
+	q.evictedRecordsCounter.Inc(entry.recordCount)
+	log.WithField("records", entry.recordCount).Warn("Spool queue is full, evicted the oldest batch")
+}
+
+func (q *SpoolQueue) removeOldest() spoolEntry {
+	entry := q.entries[0]
+	q.entries = q.entries[1:]
+	q.backlogBytes -= entry.size
+	q.backlogRecords -= entry.recordCount
+	q.updateGauges()
+	if err := os.Remove(q.getEntryFile(entry)); err != nil {
+		log.WithError(err).Error("Failed to remove spooled batch")
+	}
+	return entry
+}
+
+func (q *SpoolQueue) readEntry(entry spoolEntry, stageContext api.StageContext) (*SpooledBatch, error) {
+	batchJson, err := ioutil.ReadFile(q.getEntryFile(entry))
+	if err != nil {
+		return nil, err
+	}
+
+	var spooledBatch SpooledBatch
+	if err := json.Unmarshal(batchJson, &spooledBatch); err != nil {
+		return nil, err
+	}
+	spooledBatch.Sequence = entry.sequence
+	spooledBatch.records = make(map[string][]api.Record)
+	for lane, sdcRecords := range spooledBatch.Lanes {
+		records := make([]api.Record, len(sdcRecords))
+		for i, sdcRecord := range sdcRecords {
+			record, err := sdcrecord.NewRecordFromSDCRecord(stageContext, sdcRecord)
+			if err != nil {
+				return nil, err
+			}
+			// Spooled records are the origin output, so they are their own source record
+			record.GetHeader().(*common.HeaderImpl).SetSourceRecord(record.Clone())
+			records[i] = record
+		}
+		spooledBatch.records[lane] = records
+	}
+	return &spooledBatch, nil
+}
+
+// recover rebuilds the queue from the spooled batch files left by a previous run
+func (q *SpoolQueue) recover() error {
+	files, err := ioutil.ReadDir(q.dir)
+	if err != nil {
+		return err
+	}
+
+	// Files are sorted by name, and names start with the zero padded sequence number
+	for _, file := range files {
+		filePath := filepath.Join(q.dir, file.Name())
+		if strings.HasSuffix(file.Name(), util.TempFileSuffix) {
+			// Batch was not completely written before the crash, the offset for it was never committed
+			if err := os.Remove(filePath); err != nil {
+				return err
+			}
+			continue
+		}
+
+		entry, err := parseSpoolEntry(file.Name())
+		if err != nil {
+			log.WithError(err).WithField("file", filePath).Warn("Ignoring unknown file in spool directory")
+			continue
+		}
+		entry.size = file.Size()
+		q.entries = append(q.entries, entry)
+		q.backlogBytes += entry.size
+		q.backlogRecords += entry.recordCount
+		q.nextSequence = entry.sequence + 1
+	}
+
+	if len(q.entries) > 0 {
+		log.WithFields(log.Fields{
+			"batches": len(q.entries),
+			"records": q.backlogRecords,
+		}).Info("Recovered spooled batches")
+	}
+	q.updateGauges()
+	return nil
+}
+
+func parseSpoolEntry(fileName string) (spoolEntry, error) {
+	entry := spoolEntry{}
+	nameParts := strings.Split(strings.TrimSuffix(fileName, spoolBatchFileSuffix), "-")
+	if !strings.HasSuffix(fileName, spoolBatchFileSuffix) || len(nameParts) != 2 {
+		return entry, errors.New("not a spooled batch file")
+	}
+	var err error
+	if entry.sequence, err = strconv.ParseInt(nameParts[0], 10, 64); err == nil {
+		entry.recordCount, err = strconv.ParseInt(nameParts[1], 10, 64)
+	}
+	return entry, err
+}
+
+func (q *SpoolQueue) updateGauges() {
+	q.backlogBytesGauge.Update(q.backlogBytes)
+	q.backlogRecordsGauge.Update(q.backlogRecords)
+}
+
+func (q *SpoolQueue) getEntryFile(entry spoolEntry) string {
+	return filepath.Join(q.dir, fmt.Sprintf(spoolBatchFileFormat, entry.sequence, entry.recordCount))
+}
+
+func NewSpoolQueue(dir string, maxSizeBytes int64, metricRegistry metrics.Registry) (*SpoolQueue, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	spoolQueue := &SpoolQueue{
+		dir:                   dir,
+		maxSizeBytes:          maxSizeBytes,
+		entries:               make([]spoolEntry, 0),
+		notify:                make(chan struct{}, 1),
+		backlogBytesGauge:     util.CreateGauge(metricRegistry, SpoolBacklogBytes),
+		backlogRecordsGauge:   util.CreateGauge(metricRegistry, SpoolBacklogRecords),
+		evictedRecordsCounter: util.CreateCounter(metricRegistry, SpoolEvictedRecords),
+	}
+	return spoolQueue, spoolQueue.recover()
+}
+
+// fixedOffsetTracker exposes the offset of a spooled or pushed batch to the stages processing it,
+// the offset itself is committed by the pipeline
+type fixedOffsetTracker struct {
+	offset *string
+}
+
+func (t *fixedOffsetTracker) IsFinished() bool {
+	return false
+}
+
+func (t *fixedOffsetTracker) SetOffset(newOffset *string) {
+}
+
+func (t *fixedOffsetTracker) CommitOffset() error {
+	return nil
+}
+
+func (t *fixedOffsetTracker) GetOffset() *string {
+	return t.offset
+}
+
+func (t *fixedOffsetTracker) GetLastBatchTime() time.Time {
+	return time.Time{}
+}
@@ -0,0 +1,184 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package runner
+
+import (
+	"github.com/rcrowley/go-metrics"
+	"github.com/spf13/cast"
+	"github.com/streamsets/datacollector-edge/api"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"github.com/streamsets/datacollector-edge/container/util"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func getSpoolTestStageContext() *common.StageContextImpl {
+	return &common.StageContextImpl{
+		StageConfig:       &common.StageConfiguration{InstanceName: "origin1"},
+		ErrorRecordPolicy: common.ErrorRecordPolicyOriginal,
+	}
+}
+
+func createSpoolTestLanes(t *testing.T, stageContext *common.StageContextImpl, count int) map[string][]api.Record {
+	records := make([]api.Record, count)
+	for i := 0; i < count; i++ {
+		record, err := stageContext.CreateRecord("record", map[string]interface{}{"index": i})
+		if err != nil {
+			t.Fatal(err)
+		}
+		records[i] = record
+	}
+	return map[string][]api.Record{"lane1": records}
+}
+
+func TestSpoolQueue_AddPeekRemove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool_queue_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stageContext := getSpoolTestStageContext()
+	spoolQueue, err := NewSpoolQueue(dir, 0, metrics.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offset := "offset1"
+	if err := spoolQueue.Add(&offset, createSpoolTestLanes(t, stageContext, 3)); err != nil {
+		t.Fatal(err)
+	}
+	if err := spoolQueue.Add(nil, createSpoolTestLanes(t, stageContext, 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	if spoolQueue.GetBacklogRecords() != 3 {
+		t.Errorf("Expected 3 backlog records, but got: %d", spoolQueue.GetBacklogRecords())
+	}
+
+	spooledBatch := spoolQueue.Peek(stageContext)
+	if spooledBatch == nil {
+		t.Fatal("Expected a spooled batch")
+	}
+	if *spooledBatch.SourceOffset != offset {
+		t.Errorf("Expected offset %s, but got: %s", offset, *spooledBatch.SourceOffset)
+	}
+	records := spooledBatch.records["lane1"]
+	if len(records) != 3 {
+		t.Fatalf("Expected 3 records, but got: %d", len(records))
+	}
+	field, err := records[2].Get("/index")
+	if err != nil || cast.ToInt(field.Value) != 2 {
+		t.Errorf("Expected value 2 for field /index, but got: %v", field.Value)
+	}
+	if records[0].GetHeader().(*common.HeaderImpl).GetSourceRecord() == nil {
+		t.Error("Expected source record to be set")
+	}
+
+	spoolQueue.Remove(spooledBatch.Sequence)
+	if spoolQueue.Peek(stageContext) != nil {
+		t.Error("Expected spool queue to be empty")
+	}
+	if spoolQueue.GetBacklogBytes() != 0 {
+		t.Errorf("Expected 0 backlog bytes, but got: %d", spoolQueue.GetBacklogBytes())
+	}
+}
+
+func TestSpoolQueue_EvictOldest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool_queue_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stageContext := getSpoolTestStageContext()
+	spoolQueue, err := NewSpoolQueue(dir, 0, metrics.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := spoolQueue.Add(nil, createSpoolTestLanes(t, stageContext, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Cap the queue to a single batch
+	spoolQueue.maxSizeBytes = spoolQueue.GetBacklogBytes()
+	secondOffset := "offset2"
+	if err := spoolQueue.Add(&secondOffset, createSpoolTestLanes(t, stageContext, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if spoolQueue.GetBacklogRecords() != 1 {
+		t.Errorf("Expected 1 backlog record, but got: %d", spoolQueue.GetBacklogRecords())
+	}
+	if evicted := spoolQueue.evictedRecordsCounter.Count(); evicted != 1 {
+		t.Errorf("Expected 1 evicted record, but got: %d", evicted)
+	}
+	spooledBatch := spoolQueue.Peek(stageContext)
+	if spooledBatch == nil || *spooledBatch.SourceOffset != secondOffset {
+		t.Error("Expected the newest batch to be retained")
+	}
+}
+
+func TestSpoolQueue_Recover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool_queue_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stageContext := getSpoolTestStageContext()
+	spoolQueue, err := NewSpoolQueue(dir, 0, metrics.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 2; i++ {
+		if err := spoolQueue.Add(nil, createSpoolTestLanes(t, stageContext, i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Simulate a batch which was being written during a crash
+	partialFile := filepath.Join(dir, "00000000000000000002-5.batch"+util.TempFileSuffix)
+	if err := ioutil.WriteFile(partialFile, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	recoveredQueue, err := NewSpoolQueue(dir, 0, metrics.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recoveredQueue.GetBacklogRecords() != 3 {
+		t.Errorf("Expected 3 backlog records, but got: %d", recoveredQueue.GetBacklogRecords())
+	}
+	if recoveredQueue.GetBacklogBytes() != spoolQueue.GetBacklogBytes() {
+		t.Errorf("Expected %d backlog bytes, but got: %d", spoolQueue.GetBacklogBytes(), recoveredQueue.GetBacklogBytes())
+	}
+	if _, err := os.Stat(partialFile); !os.IsNotExist(err) {
+		t.Error("Expected partially written batch to be removed")
+	}
+
+	spooledBatch := recoveredQueue.Peek(stageContext)
+	if spooledBatch == nil || len(spooledBatch.records["lane1"]) != 1 {
+		t.Fatal("Expected the oldest batch first")
+	}
+	recoveredQueue.Remove(spooledBatch.Sequence)
+
+	if err := recoveredQueue.Add(nil, createSpoolTestLanes(t, stageContext, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if spooledBatch = recoveredQueue.Peek(stageContext); len(spooledBatch.records["lane1"]) != 2 {
+		t.Error("Expected new batches to be queued after the recovered ones")
+	}
+}
@@ -13,10 +13,21 @@
 package runner
 
 import (
+	"context"
+	"fmt"
+	"github.com/spf13/cast"
 	"github.com/streamsets/datacollector-edge/api"
 	"github.com/streamsets/datacollector-edge/api/validation"
 	"github.com/streamsets/datacollector-edge/container/common"
 	"github.com/streamsets/datacollector-edge/container/creation"
+	"github.com/streamsets/datacollector-edge/container/el"
+	"strings"
+)
+
+const (
+	requiredFieldsMissingError   = "CONTAINER_0050 - The stage requires records to include the following required fields: '%s'"
+	unsatisfiedPreconditionError = "CONTAINER_0051 - Unsatisfied precondition(s) '%s'"
+	preconditionEvaluationError  = "CONTAINER_0052 - Failed to evaluate precondition '%s': %s"
 )
 
 type StageRuntime struct {
@@ -49,13 +60,64 @@ func (s *StageRuntime) Execute(
 	if s.stageBean.IsSource() {
 		newOffset, err = s.stageBean.Stage.(api.Origin).Produce(previousOffset, batchSize, batchMaker)
 	} else if s.stageBean.IsProcessor() {
-		err = s.stageBean.Stage.(api.Processor).Process(batch, batchMaker)
+		err = s.stageBean.Stage.(api.Processor).Process(s.filterRecords(batch), batchMaker)
 	} else if s.stageBean.IsTarget() {
-		err = s.stageBean.Stage.(api.Destination).Write(batch)
+		err = s.stageBean.Stage.(api.Destination).Write(s.filterRecords(batch))
+	}
+	if err == nil {
+		if stageContextImpl, ok := s.stageContext.(*common.StageContextImpl); ok {
+			err = stageContextImpl.GetStopPipelineError()
+		}
 	}
 	return newOffset, err
 }
 
+// filterRecords sends records missing required fields or failing record preconditions to the stage error
+// policy and returns a batch with the remaining records
+func (s *StageRuntime) filterRecords(batch *BatchImpl) *BatchImpl {
+	systemConfigs := s.stageBean.SystemConfigs
+	if s.stageContext.IsErrorStage() ||
+		(len(systemConfigs.StageRequiredFields) == 0 && len(systemConfigs.StageRecordPreconditions) == 0) {
+		return batch
+	}
+
+	records := make([]api.Record, 0, len(batch.records))
+	for _, record := range batch.records {
+		if err := s.checkRequiredFieldsAndPreconditions(record); err != nil {
+			s.stageContext.ToError(err, record)
+		} else {
+			records = append(records, record)
+		}
+	}
+	return NewBatchImpl(batch.instanceName, records, batch.sourceOffset)
+}
+
+func (s *StageRuntime) checkRequiredFieldsAndPreconditions(record api.Record) error {
+	missingFields := make([]string, 0)
+	for _, requiredField := range s.stageBean.SystemConfigs.StageRequiredFields {
+		fieldPath := cast.ToString(requiredField)
+		if field, err := record.Get(fieldPath); err != nil || field == nil || len(field.Type) == 0 {
+			missingFields = append(missingFields, fieldPath)
+		}
+	}
+	if len(missingFields) > 0 {
+		return fmt.Errorf(requiredFieldsMissingError, strings.Join(missingFields, ", "))
+	}
+
+	recordContext := context.WithValue(context.Background(), el.RecordContextVar, record)
+	for _, recordPrecondition := range s.stageBean.SystemConfigs.StageRecordPreconditions {
+		precondition := cast.ToString(recordPrecondition)
+		result, err := s.stageContext.Evaluate(precondition, "stageRecordPreconditions", recordContext)
+		if err != nil {
+			return fmt.Errorf(preconditionEvaluationError, precondition, err.Error())
+		}
+		if satisfied, err := cast.ToBoolE(result); err != nil || !satisfied {
+			return fmt.Errorf(unsatisfiedPreconditionError, precondition)
+		}
+	}
+	return nil
+}
+
 func (s *StageRuntime) Destroy() {
 	if s.stageBean.Services != nil {
 		for _, serviceBean := range s.stageBean.Services {
@@ -0,0 +1,111 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package runner
+
+import (
+	"github.com/streamsets/datacollector-edge/api"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"github.com/streamsets/datacollector-edge/container/creation"
+	"strings"
+	"testing"
+)
+
+type recordingDestination struct {
+	*common.BaseStage
+	records []api.Record
+}
+
+func (d *recordingDestination) Write(batch api.Batch) error {
+	d.records = append(d.records, batch.GetRecords()...)
+	return nil
+}
+
+func getStageRuntimeForSystemConfigs(
+	destination *recordingDestination,
+	systemConfigs creation.StageConfigBean,
+) (StageRuntime, *common.StageContextImpl) {
+	stageConfig := &common.StageConfiguration{
+		InstanceName: "destination1",
+		UiInfo:       map[string]interface{}{creation.STAGE_TYPE: creation.TARGET},
+	}
+	stageContext := &common.StageContextImpl{
+		StageConfig:       stageConfig,
+		ErrorSink:         common.NewErrorSink(),
+		ErrorRecordPolicy: common.ErrorRecordPolicyStage,
+		OnRecordError:     systemConfigs.StageOnRecordError,
+	}
+	stageBean := creation.StageBean{
+		Config:        stageConfig,
+		Stage:         destination,
+		SystemConfigs: systemConfigs,
+	}
+	return NewStageRuntime(creation.PipelineBean{}, stageBean, stageContext), stageContext
+}
+
+func TestStageRuntime_RequiredFieldsAndPreconditions(t *testing.T) {
+	destination := &recordingDestination{BaseStage: &common.BaseStage{}}
+	stageRuntime, stageContext := getStageRuntimeForSystemConfigs(destination, creation.StageConfigBean{
+		StageOnRecordError:       common.OnRecordErrorToError,
+		StageRequiredFields:      []interface{}{"/a"},
+		StageRecordPreconditions: []interface{}{"${record:value('/a') > 1}"},
+	})
+
+	validRecord, _ := stageContext.CreateRecord("valid", map[string]interface{}{"a": 2})
+	missingFieldRecord, _ := stageContext.CreateRecord("missingField", map[string]interface{}{"b": 2})
+	failedPreconditionRecord, _ := stageContext.CreateRecord("failedPrecondition", map[string]interface{}{"a": 1})
+
+	batch := NewBatchImpl("destination1", []api.Record{validRecord, missingFieldRecord, failedPreconditionRecord}, nil)
+	if _, err := stageRuntime.Execute(nil, -1, batch, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(destination.records) != 1 || destination.records[0] != validRecord {
+		t.Errorf("Expected only the valid record to reach the destination, but got: %d records", len(destination.records))
+	}
+
+	errorRecords := stageContext.ErrorSink.GetStageErrorRecords("destination1")
+	if len(errorRecords) != 2 {
+		t.Fatalf("Expected 2 error records, but got: %d", len(errorRecords))
+	}
+
+	requiredFieldsErrorMessage := errorRecords[0].GetHeader().GetErrorMessage()
+	if !strings.HasPrefix(requiredFieldsErrorMessage, "CONTAINER_0050") {
+		t.Errorf("Expected CONTAINER_0050 error, but got: %s", requiredFieldsErrorMessage)
+	}
+
+	preconditionErrorMessage := errorRecords[1].GetHeader().GetErrorMessage()
+	if !strings.HasPrefix(preconditionErrorMessage, "CONTAINER_0051") {
+		t.Errorf("Expected CONTAINER_0051 error, but got: %s", preconditionErrorMessage)
+	}
+}
+
+func TestStageRuntime_RequiredFieldsDiscard(t *testing.T) {
+	destination := &recordingDestination{BaseStage: &common.BaseStage{}}
+	stageRuntime, stageContext := getStageRuntimeForSystemConfigs(destination, creation.StageConfigBean{
+		StageOnRecordError:  common.OnRecordErrorDiscard,
+		StageRequiredFields: []interface{}{"/a"},
+	})
+
+	record, _ := stageContext.CreateRecord("missingField", map[string]interface{}{"b": 2})
+	batch := NewBatchImpl("destination1", []api.Record{record}, nil)
+	if _, err := stageRuntime.Execute(nil, -1, batch, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(destination.records) != 0 {
+		t.Errorf("Expected no records to reach the destination, but got: %d", len(destination.records))
+	}
+	if stageContext.ErrorSink.GetStageDiscardedRecords("destination1") != 1 {
+		t.Error("Expected 1 discarded record")
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package runner
+
+import (
+	"encoding/json"
+	"github.com/rcrowley/go-metrics"
+	log "github.com/sirupsen/logrus"
+	"github.com/streamsets/datacollector-edge/api"
+	"github.com/streamsets/datacollector-edge/api/validation"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"github.com/streamsets/datacollector-edge/container/creation"
+	"sync"
+	"time"
+)
+
+const (
+	STATS_NULL_TARGET               = "com_streamsets_pipeline_stage_destination_devnull_StatsNullDTarget"
+	StatsRecordTypeHeader           = "sdc.stats.type"
+	StatsRecordTypeMetric           = "METRIC"
+	StatsRecordTypePipelineStart    = "PIPELINE_START"
+	StatsRecordTypePipelineStop     = "PIPELINE_STOP"
+	DefaultStatsAggregatorInterval  = 60 * time.Second
+	statsAggregatorRecordSourceId   = "statsAggregator"
+	statsAggregatorErrorsLogMessage = "Stats aggregator stage failed to write records"
+)
+
+// StatsAggregator feeds the pipeline statsAggregatorStage with metric records built from the pipeline
+// MetricRegistry, in the same format MetricsEventRunnable sends to Control Hub. A pipeline start record is
+// written when the pipeline starts, a metric record every interval, and a final metric record followed by a
+// pipeline stop record when the pipeline stops.
+type StatsAggregator struct {
+	stageRuntime   StageRuntime
+	errorSink      *common.ErrorSink
+	metricRegistry metrics.Registry
+	metadata       map[string]string
+	sdcId          string
+	interval       time.Duration
+	stopChan       chan struct{}
+	stopOnce       sync.Once
+	done           chan struct{}
+	writeMutex     sync.Mutex
+	destroyed      bool
+}
+
+func (s *StatsAggregator) Init() []validation.Issue {
+	return s.stageRuntime.Init()
+}
+
+// Run writes the pipeline start record and then a metric record every interval until Stop is called
+func (s *StatsAggregator) Run() {
+	defer close(s.done)
+	s.write(StatsRecordTypePipelineStart)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.write(StatsRecordTypeMetric)
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// Stop waits for Run to return, writes the latest metrics and the pipeline stop record and destroys the stage
+func (s *StatsAggregator) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopChan)
+		<-s.done
+		s.write(StatsRecordTypeMetric)
+		s.write(StatsRecordTypePipelineStop)
+		s.writeMutex.Lock()
+		s.destroyed = true
+		s.stageRuntime.Destroy()
+		s.writeMutex.Unlock()
+	})
+}
+
+func (s *StatsAggregator) write(recordType string) {
+	record, err := s.createRecord(recordType)
+	if err != nil {
+		log.WithError(err).Error("Failed to create stats aggregator record")
+		return
+	}
+	s.writeRecord(record)
+}
+
+// writeRecord passes the record to the stats aggregator stage, records written after Stop are dropped
+func (s *StatsAggregator) writeRecord(record api.Record) {
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	if s.destroyed {
+		return
+	}
+
+	s.errorSink.ClearErrorRecordsAndMessages()
+	instanceName := s.stageRuntime.config.InstanceName
+	batch := NewBatchImpl(instanceName, []api.Record{record}, nil)
+	if _, err := s.stageRuntime.Execute(nil, -1, batch, nil); err != nil {
+		log.WithError(err).WithField("stage", instanceName).Error(statsAggregatorErrorsLogMessage)
+		return
+	}
+	for _, errorRecord := range s.errorSink.GetStageErrorRecords(instanceName) {
+		log.WithField("stage", instanceName).
+			WithField("error", errorRecord.GetHeader().GetErrorMessage()).
+			Error(statsAggregatorErrorsLogMessage)
+	}
+}
+
+func (s *StatsAggregator) createRecord(recordType string) (api.Record, error) {
+	metricsJson, err := json.Marshal(newSDCMetrics(s.metadata, s.sdcId, s.metricRegistry))
+	if err != nil {
+		return nil, err
+	}
+	var value map[string]interface{}
+	if err := json.Unmarshal(metricsJson, &value); err != nil {
+		return nil, err
+	}
+
+	record, err := s.stageRuntime.stageContext.CreateRecord(statsAggregatorRecordSourceId, value)
+	if err != nil {
+		return nil, err
+	}
+	record.GetHeader().SetAttribute(StatsRecordTypeHeader, recordType)
+	return record, nil
+}
+
+// isStatsAggregatorEnabled returns false when no stats aggregator stage is configured, when the stage discards
+// the statistics or when MetricsEventRunnable sends them to Control Hub directly
+func isStatsAggregatorEnabled(pipelineConfig common.PipelineConfiguration) bool {
+	statsAggregatorStage := pipelineConfig.StatsAggregatorStage
+	return statsAggregatorStage != nil &&
+		len(statsAggregatorStage.InstanceName) > 0 &&
+		statsAggregatorStage.StageName != STATS_NULL_TARGET &&
+		statsAggregatorStage.StageName != STATS_DPM_DIRECTLY_TARGET
+}
+
+func NewStatsAggregator(
+	pipelineConfig common.PipelineConfiguration,
+	pipelineBean creation.PipelineBean,
+	resolvedParameters map[string]interface{},
+	metricRegistry metrics.Registry,
+) (*StatsAggregator, *validation.Issue) {
+	stageBean := pipelineBean.StatsAggregatorStage
+	errorSink := common.NewErrorSink()
+	stageContext, err := common.NewStageContext(
+		stageBean.Config,
+		resolvedParameters,
+		metricRegistry,
+		errorSink,
+		false,
+		pipelineBean.Config.ErrorRecordPolicy,
+		"",
+		nil,
+		pipelineBean.ElContext,
+		common.NewEventSink(),
+		false,
+	)
+	if err != nil {
+		return nil, &validation.Issue{
+			InstanceName: stageBean.Config.InstanceName,
+			Level:        common.StageConfig,
+			Count:        1,
+			Message:      err.Error(),
+		}
+	}
+
+	interval := DefaultStatsAggregatorInterval
+	if waitTime, ok := pipelineBean.Config.Constants[UPDATE_WAIT_TIME_MS].(float64); ok && waitTime > 0 {
+		interval = time.Duration(waitTime) * time.Millisecond
+	}
+
+	return &StatsAggregator{
+		stageRuntime:   NewStageRuntime(pipelineBean, stageBean, stageContext),
+		errorSink:      errorSink,
+		metricRegistry: metricRegistry,
+		metadata:       newMetricsMetadata(pipelineConfig, pipelineBean.Config.Constants),
+		interval:       interval,
+		stopChan:       make(chan struct{}),
+		done:           make(chan struct{}),
+	}, nil
+}
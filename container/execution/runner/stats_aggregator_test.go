@@ -0,0 +1,119 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package runner
+
+import (
+	"github.com/rcrowley/go-metrics"
+	"github.com/streamsets/datacollector-edge/api"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"github.com/streamsets/datacollector-edge/container/creation"
+	"github.com/streamsets/datacollector-edge/container/util"
+	"github.com/streamsets/datacollector-edge/stages/stagelibrary"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	statsTestLibrary         = "stats-test-lib"
+	statsTestDestinationName = "statsDestination"
+)
+
+var statsTestDestinationInstance *statsTestDestination
+
+type statsTestDestination struct {
+	*common.BaseStage
+	records      []api.Record
+	recordsMutex sync.Mutex
+}
+
+func (d *statsTestDestination) Write(batch api.Batch) error {
+	d.recordsMutex.Lock()
+	defer d.recordsMutex.Unlock()
+	d.records = append(d.records, batch.GetRecords()...)
+	return nil
+}
+
+func init() {
+	stagelibrary.SetCreator(statsTestLibrary, statsTestDestinationName, func() api.Stage {
+		statsTestDestinationInstance = &statsTestDestination{BaseStage: &common.BaseStage{}}
+		return statsTestDestinationInstance
+	})
+}
+
+func TestStatsAggregator(t *testing.T) {
+	statsStageConfig := getPushTestStageConfig("statsAggregator", statsTestDestinationName, creation.TARGET)
+	statsStageConfig.Library = statsTestLibrary
+	pipelineConfig := common.PipelineConfiguration{
+		PipelineId: "statsPipeline",
+		Configuration: []common.Config{
+			{Name: creation.Constants, Value: []interface{}{
+				map[string]interface{}{"key": JOB_ID, "value": "job1"},
+				map[string]interface{}{"key": UPDATE_WAIT_TIME_MS, "value": float64(10)},
+			}},
+		},
+		Stages:               []*common.StageConfiguration{},
+		ErrorStage:           getPushTestStageConfig("errorStage", pushTestDestinationName, creation.TARGET),
+		StatsAggregatorStage: statsStageConfig,
+	}
+	if !isStatsAggregatorEnabled(pipelineConfig) {
+		t.Fatal("Expected stats aggregator to be enabled")
+	}
+
+	pipelineBean, issues := creation.NewPipelineBean(pipelineConfig, nil)
+	if len(issues) > 0 {
+		t.Fatal(issues[0].Message)
+	}
+	metricRegistry := metrics.NewRegistry()
+	util.CreateCounter(metricRegistry, PipelineBatchCount).Inc(5)
+
+	statsAggregator, issue := NewStatsAggregator(pipelineConfig, pipelineBean, nil, metricRegistry)
+	if issue != nil {
+		t.Fatal(issue.Message)
+	}
+	statsAggregator.sdcId = "sdc1"
+	if issues := statsAggregator.Init(); len(issues) > 0 {
+		t.Fatal(issues[0].Message)
+	}
+
+	go statsAggregator.Run()
+	time.Sleep(50 * time.Millisecond)
+	statsAggregator.Stop()
+
+	records := statsTestDestinationInstance.records
+	if len(records) < 4 {
+		t.Fatalf("Expected at least 4 stats records, but got: %d", len(records))
+	}
+	expectedTypes := map[int]string{
+		0:                StatsRecordTypePipelineStart,
+		1:                StatsRecordTypeMetric,
+		len(records) - 1: StatsRecordTypePipelineStop,
+	}
+	for i, expectedType := range expectedTypes {
+		if recordType := records[i].GetHeader().GetAttribute(StatsRecordTypeHeader); recordType != expectedType {
+			t.Errorf("Expected record %d of type %s, but got: %v", i, expectedType, recordType)
+		}
+	}
+
+	record := records[1]
+	if sdcId, err := record.Get("/sdcId"); err != nil || sdcId.Value != "sdc1" {
+		t.Errorf("Unexpected sdcId field: %v", sdcId)
+	}
+	if jobId, err := record.Get("/metadata/" + DPM_JOB_ID); err != nil || jobId.Value != "job1" {
+		t.Errorf("Unexpected job id metadata: %v", jobId)
+	}
+	batchCount, err := record.Get("/metrics/counters/" + PipelineBatchCount + ".counter/count")
+	if err != nil || batchCount == nil || batchCount.Value != float64(5) {
+		t.Errorf("Unexpected batch count metric: %v", batchCount)
+	}
+}
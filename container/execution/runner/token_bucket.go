@@ -0,0 +1,82 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package runner
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenBucket limits the average number of records per second. The number of records in a batch is only
+// known after the origin produced it, so tokens are taken after the fact and the bucket can go into debt.
+// Wait blocks until the debt is paid off, which keeps the average rate at or below the configured rate.
+// The bucket is shared by all pipeline runners of a multithreaded origin.
+type TokenBucket struct {
+	mutex      sync.Mutex
+	rate       float64
+	capacity   float64
+	tokens     float64
+	lastRefill time.Time
+	now        func() time.Time
+}
+
+// Wait blocks until the bucket is not in debt or the stop channel is closed,
+// and returns the time spent waiting
+func (b *TokenBucket) Wait(stop <-chan struct{}) time.Duration {
+	b.mutex.Lock()
+	b.refill()
+	tokens := b.tokens
+	b.mutex.Unlock()
+	if tokens >= 0 {
+		return 0
+	}
+
+	waitTime := time.Duration(-tokens / b.rate * float64(time.Second))
+	start := b.now()
+	select {
+	case <-time.After(waitTime):
+	case <-stop:
+	}
+	b.mutex.Lock()
+	b.refill()
+	b.mutex.Unlock()
+	return b.now().Sub(start)
+}
+
+// Take removes the given number of tokens from the bucket
+func (b *TokenBucket) Take(count int64) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.refill()
+	b.tokens -= float64(count)
+}
+
+func (b *TokenBucket) refill() {
+	now := b.now()
+	b.tokens += now.Sub(b.lastRefill).Seconds() * b.rate
+	if b.tokens > b.capacity {
+		b.tokens = b.capacity
+	}
+	b.lastRefill = now
+}
+
+// NewTokenBucket returns a full bucket allowing the given records per second, with a burst of one second
+func NewTokenBucket(rate float64) *TokenBucket {
+	return &TokenBucket{
+		rate:       rate,
+		capacity:   rate,
+		tokens:     rate,
+		lastRefill: time.Now(),
+		now:        time.Now,
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package runner
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucket_Refill(t *testing.T) {
+	now := time.Now()
+	tokenBucket := NewTokenBucket(100)
+	tokenBucket.lastRefill = now
+	tokenBucket.now = func() time.Time { return now }
+
+	tokenBucket.Take(250)
+	if tokenBucket.tokens != -150 {
+		t.Errorf("Expected -150 tokens, but got: %f", tokenBucket.tokens)
+	}
+
+	now = now.Add(time.Second)
+	tokenBucket.refill()
+	if tokenBucket.tokens != -50 {
+		t.Errorf("Expected -50 tokens, but got: %f", tokenBucket.tokens)
+	}
+
+	// Idle time never accumulates more than a second worth of tokens
+	now = now.Add(time.Minute)
+	tokenBucket.refill()
+	if tokenBucket.tokens != 100 {
+		t.Errorf("Expected 100 tokens, but got: %f", tokenBucket.tokens)
+	}
+}
+
+func TestTokenBucket_Wait(t *testing.T) {
+	tokenBucket := NewTokenBucket(1000)
+	if waitTime := tokenBucket.Wait(nil); waitTime != 0 {
+		t.Errorf("Expected no wait for a full bucket, but waited: %v", waitTime)
+	}
+
+	tokenBucket.Take(1100)
+	waitTime := tokenBucket.Wait(nil)
+	if waitTime < 90*time.Millisecond {
+		t.Errorf("Expected to wait for about 100ms, but waited: %v", waitTime)
+	}
+	if tokenBucket.tokens < 0 {
+		t.Errorf("Expected the debt to be paid off, but got: %f tokens", tokenBucket.tokens)
+	}
+
+	tokenBucket.Take(1000000)
+	stop := make(chan struct{})
+	close(stop)
+	if waitTime := tokenBucket.Wait(stop); waitTime > time.Second {
+		t.Errorf("Expected wait to be interrupted by stop, but waited: %v", waitTime)
+	}
+}
@@ -0,0 +1,334 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"github.com/streamsets/datacollector-edge/container/common"
+	bolt "go.etcd.io/bbolt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+const (
+	boltOpenTimeout = 5 * time.Second
+)
+
+var (
+	boltPipelinesBucket     = []byte("pipelines")
+	boltOffsetKey           = []byte("offset")
+	boltStateKey            = []byte("state")
+	boltOffsetHistoryBucket = []byte("offsetHistory")
+	boltStateHistoryBucket  = []byte("stateHistory")
+)
+
+// BoltStorage keeps offsets, states and their history in an embedded bolt database. Every pipeline has its
+// own bucket holding the current offset and state and the offset and state history buckets, which are keyed
+// by sequence number and trimmed to the configured retention.
+type BoltStorage struct {
+	db                     *bolt.DB
+	stateHistoryRetention  int
+	offsetHistoryRetention int
+}
+
+func (s *BoltStorage) ReadOffset(pipelineId string) (*common.SourceOffset, error) {
+	var sourceOffset *common.SourceOffset
+	err := s.db.View(func(tx *bolt.Tx) error {
+		pipelineBucket := getPipelineBucket(tx, pipelineId)
+		if pipelineBucket == nil {
+			return nil
+		}
+		if value := pipelineBucket.Get(boltOffsetKey); value != nil {
+			sourceOffset = &common.SourceOffset{}
+			return json.Unmarshal(value, sourceOffset)
+		}
+		return nil
+	})
+	return sourceOffset, err
+}
+
+func (s *BoltStorage) WriteOffset(pipelineId string, sourceOffset common.SourceOffset) error {
+	offsetJson, err := json.Marshal(sourceOffset)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		pipelineBucket, err := createPipelineBucket(tx, pipelineId)
+		if err != nil {
+			return err
+		}
+		if err := pipelineBucket.Put(boltOffsetKey, offsetJson); err != nil {
+			return err
+		}
+		return appendToHistory(pipelineBucket, boltOffsetHistoryBucket, offsetJson, s.offsetHistoryRetention)
+	})
+}
+
+func (s *BoltStorage) GetOffsetHistory(pipelineId string) ([]common.SourceOffset, error) {
+	offsetHistory := make([]common.SourceOffset, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return forEachInHistory(tx, pipelineId, boltOffsetHistoryBucket, func(value []byte) error {
+			var sourceOffset common.SourceOffset
+			if err := json.Unmarshal(value, &sourceOffset); err != nil {
+				return err
+			}
+			offsetHistory = append(offsetHistory, sourceOffset)
+			return nil
+		})
+	})
+	return offsetHistory, err
+}
+
+func (s *BoltStorage) ReadState(pipelineId string) (*common.PipelineState, error) {
+	var pipelineState *common.PipelineState
+	err := s.db.View(func(tx *bolt.Tx) error {
+		pipelineBucket := getPipelineBucket(tx, pipelineId)
+		if pipelineBucket == nil {
+			return nil
+		}
+		if value := pipelineBucket.Get(boltStateKey); value != nil {
+			pipelineState = &common.PipelineState{}
+			return json.Unmarshal(value, pipelineState)
+		}
+		return nil
+	})
+	return pipelineState, err
+}
+
+func (s *BoltStorage) WriteState(pipelineId string, pipelineState *common.PipelineState) error {
+	pipelineStateJson, err := json.Marshal(pipelineState)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		pipelineBucket, err := createPipelineBucket(tx, pipelineId)
+		if err != nil {
+			return err
+		}
+		if err := pipelineBucket.Put(boltStateKey, pipelineStateJson); err != nil {
+			return err
+		}
+		return appendToHistory(pipelineBucket, boltStateHistoryBucket, pipelineStateJson, s.stateHistoryRetention)
+	})
+}
+
+func (s *BoltStorage) GetHistory(pipelineId string) ([]*common.PipelineState, error) {
+	history := make([]*common.PipelineState, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return forEachInHistory(tx, pipelineId, boltStateHistoryBucket, func(value []byte) error {
+			var pipelineState common.PipelineState
+			if err := json.Unmarshal(value, &pipelineState); err != nil {
+				return err
+			}
+			history = append(history, &pipelineState)
+			return nil
+		})
+	})
+	return history, err
+}
+
+func (s *BoltStorage) DeleteHistory(pipelineId string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		pipelineBucket := getPipelineBucket(tx, pipelineId)
+		if pipelineBucket == nil || pipelineBucket.Bucket(boltStateHistoryBucket) == nil {
+			return nil
+		}
+		return pipelineBucket.DeleteBucket(boltStateHistoryBucket)
+	})
+}
+
+func (s *BoltStorage) Delete(pipelineId string) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if getPipelineBucket(tx, pipelineId) == nil {
+			return nil
+		}
+		return tx.Bucket(boltPipelinesBucket).DeleteBucket([]byte(getValidPipelineId(pipelineId)))
+	})
+	if err != nil {
+		return err
+	}
+	// The run info directory still holds the spool queue and the migrated files
+	return os.RemoveAll(getRunInfoDir(pipelineId))
+}
+
+func (s *BoltStorage) Close() error {
+	return s.db.Close()
+}
+
+// migrate imports the offsets, states and history of the pipelines which have no bucket yet from the given
+// storage. The migrated files are left in place, so switching back to the file storage is possible.
+func (s *BoltStorage) migrate(fromStorage Storage) error {
+	runInfoDirs, err := ioutil.ReadDir(BaseDir + PIPELINES_RUN_INFO_FOLDER)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, runInfoDir := range runInfoDirs {
+		if !runInfoDir.IsDir() {
+			continue
+		}
+		pipelineId := runInfoDir.Name()
+
+		migrated := false
+		if err := s.db.View(func(tx *bolt.Tx) error {
+			migrated = getPipelineBucket(tx, pipelineId) != nil
+			return nil
+		}); err != nil {
+			return err
+		}
+		if migrated {
+			continue
+		}
+
+		pipelineState, err := fromStorage.ReadState(pipelineId)
+		if err != nil {
+			return err
+		}
+		sourceOffset, err := fromStorage.ReadOffset(pipelineId)
+		if err != nil {
+			return err
+		}
+		history, err := fromStorage.GetHistory(pipelineId)
+		if err != nil {
+			return err
+		}
+		if pipelineState == nil && sourceOffset == nil && len(history) == 0 {
+			continue
+		}
+
+		if err := s.db.Update(func(tx *bolt.Tx) error {
+			pipelineBucket, err := createPipelineBucket(tx, pipelineId)
+			if err != nil {
+				return err
+			}
+			for _, historyState := range history {
+				historyStateJson, err := json.Marshal(historyState)
+				if err != nil {
+					return err
+				}
+				err = appendToHistory(pipelineBucket, boltStateHistoryBucket, historyStateJson, s.stateHistoryRetention)
+				if err != nil {
+					return err
+				}
+			}
+			if pipelineState != nil {
+				pipelineStateJson, err := json.Marshal(pipelineState)
+				if err != nil {
+					return err
+				}
+				if err := pipelineBucket.Put(boltStateKey, pipelineStateJson); err != nil {
+					return err
+				}
+			}
+			if sourceOffset != nil {
+				offsetJson, err := json.Marshal(sourceOffset)
+				if err != nil {
+					return err
+				}
+				if err := pipelineBucket.Put(boltOffsetKey, offsetJson); err != nil {
+					return err
+				}
+				return appendToHistory(pipelineBucket, boltOffsetHistoryBucket, offsetJson, s.offsetHistoryRetention)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		log.WithField("pipeline", pipelineId).WithField("states", len(history)).Info("Migrated pipeline to bolt storage")
+	}
+	return nil
+}
+
+func getPipelineBucket(tx *bolt.Tx, pipelineId string) *bolt.Bucket {
+	pipelinesBucket := tx.Bucket(boltPipelinesBucket)
+	if pipelinesBucket == nil {
+		return nil
+	}
+	return pipelinesBucket.Bucket([]byte(getValidPipelineId(pipelineId)))
+}
+
+func createPipelineBucket(tx *bolt.Tx, pipelineId string) (*bolt.Bucket, error) {
+	pipelinesBucket, err := tx.CreateBucketIfNotExists(boltPipelinesBucket)
+	if err != nil {
+		return nil, err
+	}
+	return pipelinesBucket.CreateBucketIfNotExists([]byte(getValidPipelineId(pipelineId)))
+}
+
+// appendToHistory adds the value to the history bucket and removes the entries exceeding the retention,
+// a negative retention keeps all entries and a retention of 0 disables the history
+func appendToHistory(pipelineBucket *bolt.Bucket, historyBucketName []byte, value []byte, retention int) error {
+	if retention == 0 {
+		return nil
+	}
+	historyBucket, err := pipelineBucket.CreateBucketIfNotExists(historyBucketName)
+	if err != nil {
+		return err
+	}
+	sequence, err := historyBucket.NextSequence()
+	if err != nil {
+		return err
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, sequence)
+	if err := historyBucket.Put(key, value); err != nil {
+		return err
+	}
+
+	if retention < 0 || sequence <= uint64(retention) {
+		return nil
+	}
+	lastExpired := sequence - uint64(retention)
+	var expiredKeys [][]byte
+	cursor := historyBucket.Cursor()
+	for k, _ := cursor.First(); k != nil && binary.BigEndian.Uint64(k) <= lastExpired; k, _ = cursor.Next() {
+		expiredKeys = append(expiredKeys, append([]byte(nil), k...))
+	}
+	for _, expiredKey := range expiredKeys {
+		if err := historyBucket.Delete(expiredKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func forEachInHistory(tx *bolt.Tx, pipelineId string, historyBucketName []byte, fn func(value []byte) error) error {
+	pipelineBucket := getPipelineBucket(tx, pipelineId)
+	if pipelineBucket == nil {
+		return nil
+	}
+	historyBucket := pipelineBucket.Bucket(historyBucketName)
+	if historyBucket == nil {
+		return nil
+	}
+	return historyBucket.ForEach(func(k, v []byte) error {
+		return fn(v)
+	})
+}
+
+func NewBoltStorage(dbFile string, config Config) (*BoltStorage, error) {
+	db, err := bolt.Open(dbFile, 0600, &bolt.Options{Timeout: boltOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltStorage{
+		db:                     db,
+		stateHistoryRetention:  config.StateHistoryRetention,
+		offsetHistoryRetention: config.OffsetHistoryRetention,
+	}, nil
+}
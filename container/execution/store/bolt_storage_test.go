@@ -0,0 +1,106 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"github.com/streamsets/datacollector-edge/container/common"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func saveTestOffset(t *testing.T, pipelineId string, offset string) {
+	sourceOffset := common.GetDefaultOffset()
+	sourceOffset.Offset[common.PollSourceOffsetKey] = &offset
+	if err := SaveOffset(pipelineId, sourceOffset); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBoltStorage(t *testing.T) {
+	var err error
+	BaseDir, err = ioutil.TempDir("", "bolt_storage_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(BaseDir)
+
+	// Pipeline run info written by the file storage
+	pipelineId := "boltPipeline"
+	pipelineState, err := GetState(pipelineId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range []string{common.STARTING, common.RUNNING} {
+		pipelineState.Status = status
+		if err := SaveState(pipelineId, pipelineState); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saveTestOffset(t, pipelineId, "offset1")
+
+	config := NewConfig()
+	config.Type = BoltStorageType
+	config.StateHistoryRetention = 2
+	config.OffsetHistoryRetention = 2
+	if err := OpenStorage(config); err != nil {
+		t.Fatal(err)
+	}
+	defer CloseStorage()
+
+	migratedState, err := GetState(pipelineId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if migratedState.Status != common.RUNNING {
+		t.Errorf("Expected migrated state %s, but got: %s", common.RUNNING, migratedState.Status)
+	}
+	history, err := GetHistory(pipelineId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Status != common.STARTING || history[1].Status != common.RUNNING {
+		t.Errorf("Expected the history to keep the last 2 states, but got: %d states", len(history))
+	}
+	sourceOffset, err := GetOffset(pipelineId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offset := sourceOffset.Offset[common.PollSourceOffsetKey]; offset == nil || *offset != "offset1" {
+		t.Errorf("Expected migrated offset offset1, but got: %v", offset)
+	}
+
+	saveTestOffset(t, pipelineId, "offset2")
+	saveTestOffset(t, pipelineId, "offset3")
+	offsetHistory, err := GetOffsetHistory(pipelineId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offsetHistory) != 2 || *offsetHistory[1].Offset[common.PollSourceOffsetKey] != "offset3" {
+		t.Errorf("Expected the offset history to keep the last 2 offsets, but got: %d offsets", len(offsetHistory))
+	}
+
+	if err := DeleteHistory(pipelineId); err != nil {
+		t.Fatal(err)
+	}
+	if history, err = GetHistory(pipelineId); err != nil || len(history) != 0 {
+		t.Errorf("Expected empty history, but got: %d states, %v", len(history), err)
+	}
+
+	if err := DeletePipeline(pipelineId); err != nil {
+		t.Fatal(err)
+	}
+	if pipelineState, err := getStorage().ReadState(pipelineId); err != nil || pipelineState != nil {
+		t.Errorf("Expected deleted pipeline state, but got: %v, %v", pipelineState, err)
+	}
+}
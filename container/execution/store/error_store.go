@@ -0,0 +1,290 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/streamsets/datacollector-edge/api"
+	"github.com/streamsets/datacollector-edge/container/recordio/sdcrecord"
+	"github.com/streamsets/datacollector-edge/container/util"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	ERROR_RECORDS_FOLDER          = "errors/"
+	ERROR_RECORDS_FILE            = "errorRecords.json"
+	ERROR_MESSAGES_FILE           = "errorMessages.json"
+	RotatedErrorFileSuffix        = ".1"
+	DefaultErrorRecordsRetention  = 1000
+	maxErrorRecordLineSizeInBytes = 64 * 1024 * 1024
+)
+
+// ErrorQuery selects a page of the retained error records or error messages, newest first
+type ErrorQuery struct {
+	// Size is the maximum number of results, all matching results are returned if it is not positive
+	Size int
+	// Offset is the number of newest matching results to skip
+	Offset int
+	// StartTime and EndTime limit the error timestamp in milliseconds since epoch (inclusive), 0 means no limit
+	StartTime int64
+	EndTime   int64
+}
+
+func (q ErrorQuery) matches(timestamp int64) bool {
+	return (q.StartTime <= 0 || timestamp >= q.StartTime) && (q.EndTime <= 0 || timestamp <= q.EndTime)
+}
+
+// ErrorStore retains the error records and error messages of a pipeline per stage in JSON files in the
+// pipeline run info directory. Every file is rotated once it holds retention entries, so at most the two
+// latest generations are kept on disk and queries return the latest retention entries.
+type ErrorStore struct {
+	pipelineId string
+	retention  int
+	mutex      sync.Mutex
+	// number of entries in the current generation of each file, counted on the first write after a restart
+	counts map[string]int
+}
+
+var (
+	errorStores      = make(map[string]*ErrorStore)
+	errorStoresMutex sync.Mutex
+)
+
+// GetErrorStore returns the error store of the pipeline, a retention of 0 disables persisting errors
+func GetErrorStore(pipelineId string, retention int) *ErrorStore {
+	errorStoresMutex.Lock()
+	defer errorStoresMutex.Unlock()
+	errorStore, ok := errorStores[pipelineId]
+	if !ok {
+		errorStore = &ErrorStore{pipelineId: pipelineId, counts: make(map[string]int)}
+		errorStores[pipelineId] = errorStore
+	}
+	errorStore.mutex.Lock()
+	errorStore.retention = retention
+	errorStore.mutex.Unlock()
+	return errorStore
+}
+
+func (s *ErrorStore) SaveErrorRecords(stageInstanceName string, records []api.Record) error {
+	entries := make([]interface{}, 0, len(records))
+	for _, record := range records {
+		sdcRecord, err := sdcrecord.NewSdcRecordFromRecord(record)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, sdcRecord)
+	}
+	return s.append(s.getErrorFile(stageInstanceName, ERROR_RECORDS_FILE), entries)
+}
+
+func (s *ErrorStore) SaveErrorMessages(stageInstanceName string, errorMessages []api.ErrorMessage) error {
+	entries := make([]interface{}, len(errorMessages))
+	for i, errorMessage := range errorMessages {
+		entries[i] = errorMessage
+	}
+	return s.append(s.getErrorFile(stageInstanceName, ERROR_MESSAGES_FILE), entries)
+}
+
+// GetErrorRecords returns the retained error records of the stage matching the query, newest first
+func (s *ErrorStore) GetErrorRecords(stageInstanceName string, query ErrorQuery) ([]sdcrecord.SDCRecord, error) {
+	entries, err := s.query(
+		s.getErrorFile(stageInstanceName, ERROR_RECORDS_FILE),
+		query,
+		func(line []byte) (interface{}, int64, error) {
+			errorRecord := sdcrecord.SDCRecord{}
+			if err := json.Unmarshal(line, &errorRecord); err != nil || errorRecord.Header == nil {
+				return errorRecord, 0, err
+			}
+			return errorRecord, errorRecord.Header.GetErrorTimestamp(), nil
+		},
+	)
+	errorRecords := make([]sdcrecord.SDCRecord, len(entries))
+	for i, entry := range entries {
+		errorRecords[i] = entry.(sdcrecord.SDCRecord)
+	}
+	return errorRecords, err
+}
+
+// GetErrorMessages returns the retained error messages of the stage matching the query, newest first
+func (s *ErrorStore) GetErrorMessages(stageInstanceName string, query ErrorQuery) ([]api.ErrorMessage, error) {
+	entries, err := s.query(
+		s.getErrorFile(stageInstanceName, ERROR_MESSAGES_FILE),
+		query,
+		func(line []byte) (interface{}, int64, error) {
+			errorMessage := api.ErrorMessage{}
+			err := json.Unmarshal(line, &errorMessage)
+			return errorMessage, errorMessage.Timestamp, err
+		},
+	)
+	errorMessages := make([]api.ErrorMessage, len(entries))
+	for i, entry := range entries {
+		errorMessages[i] = entry.(api.ErrorMessage)
+	}
+	return errorMessages, err
+}
+
+// Delete removes all retained error records and error messages of the pipeline
+func (s *ErrorStore) Delete() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.counts = make(map[string]int)
+	return os.RemoveAll(getErrorRecordsDir(s.pipelineId))
+}
+
+func (s *ErrorStore) append(errorFile string, entries []interface{}) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.retention <= 0 {
+		return nil
+	}
+
+	count, ok := s.counts[errorFile]
+	if !ok {
+		lines, err := readErrorFile(errorFile)
+		if err != nil {
+			return err
+		}
+		count = len(lines)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(errorFile), os.ModePerm); err != nil {
+		return err
+	}
+
+	var file *os.File
+	var err error
+	defer func() {
+		if file != nil {
+			util.CloseFile(file)
+		}
+		s.counts[errorFile] = count
+	}()
+	for _, entry := range entries {
+		if file == nil || count >= s.retention {
+			if count >= s.retention {
+				if file != nil {
+					util.CloseFile(file)
+					file = nil
+				}
+				if err = os.Rename(errorFile, errorFile+RotatedErrorFileSuffix); err != nil {
+					return err
+				}
+				count = 0
+			}
+			if file, err = os.OpenFile(errorFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err != nil {
+				return err
+			}
+		}
+
+		var entryJson []byte
+		if entryJson, err = json.Marshal(entry); err != nil {
+			return err
+		}
+		if _, err = file.Write(append(entryJson, '\n')); err != nil {
+			return err
+		}
+		count++
+	}
+	return nil
+}
+
+// query decodes the latest retention entries of both generations of the error file newest first and returns
+// the page of entries whose timestamp matches the query
+func (s *ErrorStore) query(
+	errorFile string,
+	query ErrorQuery,
+	decode func(line []byte) (interface{}, int64, error),
+) ([]interface{}, error) {
+	s.mutex.Lock()
+	rotatedLines, err := readErrorFile(errorFile + RotatedErrorFileSuffix)
+	var lines [][]byte
+	if err == nil {
+		lines, err = readErrorFile(errorFile)
+	}
+	retention := s.retention
+	s.mutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	lines = append(rotatedLines, lines...)
+	if retention > 0 && len(lines) > retention {
+		lines = lines[len(lines)-retention:]
+	}
+
+	entries := make([]interface{}, 0)
+	skipped := 0
+	for i := len(lines) - 1; i >= 0 && (query.Size <= 0 || len(entries) < query.Size); i-- {
+		entry, timestamp, err := decode(lines[i])
+		if err != nil {
+			return entries, err
+		}
+		if !query.matches(timestamp) {
+			continue
+		}
+		if skipped < query.Offset {
+			skipped++
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (s *ErrorStore) getErrorFile(stageInstanceName string, fileName string) string {
+	return getErrorRecordsDir(s.pipelineId) + url.PathEscape(stageInstanceName) + "/" + fileName
+}
+
+func getErrorRecordsDir(pipelineId string) string {
+	return getRunInfoDir(pipelineId) + ERROR_RECORDS_FOLDER
+}
+
+// readErrorFile returns the lines of the error file, an empty list if the file does not exist
+func readErrorFile(errorFile string) ([][]byte, error) {
+	file, err := os.Open(errorFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer util.CloseFile(file)
+
+	lines := make([][]byte, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxErrorRecordLineSizeInBytes)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			lines = append(lines, append([]byte(nil), scanner.Bytes()...))
+		}
+	}
+	return lines, scanner.Err()
+}
+
+func deleteErrorStore(pipelineId string) error {
+	errorStoresMutex.Lock()
+	errorStore, ok := errorStores[pipelineId]
+	delete(errorStores, pipelineId)
+	errorStoresMutex.Unlock()
+	if ok {
+		return errorStore.Delete()
+	}
+	return os.RemoveAll(getErrorRecordsDir(pipelineId))
+}
@@ -0,0 +1,149 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"github.com/streamsets/datacollector-edge/api"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func createTestErrorRecords(t *testing.T, stageInstanceName string, from int, to int) []api.Record {
+	stageContext := &common.StageContextImpl{
+		StageConfig: &common.StageConfiguration{InstanceName: stageInstanceName},
+	}
+	records := make([]api.Record, 0)
+	for i := from; i <= to; i++ {
+		record, err := stageContext.CreateRecord("record"+strconv.Itoa(i), map[string]interface{}{"index": i})
+		if err != nil {
+			t.Fatal(err)
+		}
+		record.GetHeader().(*common.HeaderImpl).SetErrorTimeStamp(int64(i) * 1000)
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestErrorStore_ErrorRecords(t *testing.T) {
+	var err error
+	BaseDir, err = ioutil.TempDir("", "error_store_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(BaseDir)
+
+	pipelineId := "errorPipeline"
+	stageInstanceName := "processor1"
+	errorStore := GetErrorStore(pipelineId, 5)
+	for i := 1; i <= 12; i += 3 {
+		if err := errorStore.SaveErrorRecords(stageInstanceName, createTestErrorRecords(t, stageInstanceName, i, i+2)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the latest 5 of the 12 records are retained
+	errorRecords, err := errorStore.GetErrorRecords(stageInstanceName, ErrorQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errorRecords) != 5 {
+		t.Fatalf("Expected 5 retained error records, but got: %d", len(errorRecords))
+	}
+	if errorRecords[0].Header.GetSourceId() != "record12" || errorRecords[4].Header.GetSourceId() != "record8" {
+		t.Errorf("Expected error records 12 to 8, but got: %s to %s",
+			errorRecords[0].Header.GetSourceId(), errorRecords[4].Header.GetSourceId())
+	}
+
+	// Errors are persisted across restarts
+	errorStoresMutex.Lock()
+	delete(errorStores, pipelineId)
+	errorStoresMutex.Unlock()
+	errorStore = GetErrorStore(pipelineId, 5)
+
+	errorRecords, err = errorStore.GetErrorRecords(stageInstanceName, ErrorQuery{Size: 2, Offset: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errorRecords) != 2 || errorRecords[0].Header.GetSourceId() != "record11" {
+		t.Errorf("Expected error records 11 and 10, but got: %v", errorRecords)
+	}
+
+	errorRecords, err = errorStore.GetErrorRecords(stageInstanceName, ErrorQuery{StartTime: 9000, EndTime: 10000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errorRecords) != 2 || errorRecords[1].Header.GetSourceId() != "record9" {
+		t.Errorf("Expected error records 10 and 9, but got: %v", errorRecords)
+	}
+	if errorRecords[1].Value == nil {
+		t.Error("Expected the error record value to be retained")
+	}
+
+	if err := DeletePipeline(pipelineId); err != nil {
+		t.Fatal(err)
+	}
+	errorRecords, err = GetErrorStore(pipelineId, 5).GetErrorRecords(stageInstanceName, ErrorQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errorRecords) != 0 {
+		t.Errorf("Expected no error records after deleting the pipeline, but got: %d", len(errorRecords))
+	}
+}
+
+func TestErrorStore_ErrorMessages(t *testing.T) {
+	var err error
+	BaseDir, err = ioutil.TempDir("", "error_store_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(BaseDir)
+
+	errorStore := GetErrorStore("errorMessagesPipeline", 10)
+	errorMessages := []api.ErrorMessage{
+		{ErrorCode: "ERROR_1", Timestamp: 1000},
+		{ErrorCode: "ERROR_2", Timestamp: 2000},
+		{ErrorCode: "ERROR_3", Timestamp: 3000},
+	}
+	if err := errorStore.SaveErrorMessages("origin1", errorMessages); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := errorStore.GetErrorMessages("origin1", ErrorQuery{Size: 10, StartTime: 2000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 2 || result[0].ErrorCode != "ERROR_3" || result[1].ErrorCode != "ERROR_2" {
+		t.Errorf("Expected error messages 3 and 2, but got: %v", result)
+	}
+
+	result, err = errorStore.GetErrorMessages("destination1", ErrorQuery{Size: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 0 {
+		t.Errorf("Expected no error messages for another stage, but got: %v", result)
+	}
+
+	// A retention of 0 disables persisting errors
+	errorStore = GetErrorStore("disabledPipeline", 0)
+	if err := errorStore.SaveErrorMessages("origin1", errorMessages); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(getErrorRecordsDir("disabledPipeline")); !os.IsNotExist(err) {
+		t.Error("Expected no error files to be written when the retention is 0")
+	}
+}
@@ -0,0 +1,238 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"github.com/streamsets/datacollector-edge/container/util"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// fileStorage keeps the offset and state as JSON files written with util.WriteFileAtomic and appends the
+// state history to a JSON lines file in the pipeline run info directory, which is trimmed to the state
+// history retention once it holds twice as many states
+type fileStorage struct {
+	stateHistoryRetention int
+	// historyLines counts the states in the history file of each pipeline, the file is only read to count
+	// them on the first append after a start
+	historyLines map[string]int
+	mutex        sync.Mutex
+}
+
+func (s *fileStorage) ReadOffset(pipelineId string) (*common.SourceOffset, error) {
+	var sourceOffset *common.SourceOffset
+	err := util.ReadFileWithBackup(getPipelineOffsetFile(pipelineId), func(data []byte) error {
+		sourceOffset = &common.SourceOffset{}
+		return json.Unmarshal(data, sourceOffset)
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return sourceOffset, err
+}
+
+func (s *fileStorage) WriteOffset(pipelineId string, sourceOffset common.SourceOffset) error {
+	offsetJson, err := json.Marshal(sourceOffset)
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(getPipelineOffsetFile(pipelineId), offsetJson, 0644)
+}
+
+// GetOffsetHistory returns only the committed offset, the file storage keeps no offset history
+func (s *fileStorage) GetOffsetHistory(pipelineId string) ([]common.SourceOffset, error) {
+	offsetHistory := make([]common.SourceOffset, 0)
+	sourceOffset, err := s.ReadOffset(pipelineId)
+	if sourceOffset != nil {
+		offsetHistory = append(offsetHistory, *sourceOffset)
+	}
+	return offsetHistory, err
+}
+
+func (s *fileStorage) ReadState(pipelineId string) (*common.PipelineState, error) {
+	var pipelineState *common.PipelineState
+	err := util.ReadFileWithBackup(getPipelineStateFile(pipelineId), func(data []byte) error {
+		pipelineState = &common.PipelineState{}
+		return json.Unmarshal(data, pipelineState)
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return pipelineState, err
+}
+
+func (s *fileStorage) WriteState(pipelineId string, pipelineState *common.PipelineState) error {
+	var err error
+	var pipelineStateJson []byte
+	if pipelineStateJson, err = json.Marshal(pipelineState); err == nil {
+		if err = util.WriteFileAtomic(getPipelineStateFile(pipelineId), pipelineStateJson, 0644); err == nil {
+			err = s.appendToHistory(pipelineId, pipelineStateJson)
+		}
+	}
+	return err
+}
+
+// appendToHistory appends the state to the history file, a negative retention keeps all states and a zero
+// retention keeps none. The oldest states are removed once the history holds twice the retention, so the file
+// is not rewritten on every state change.
+func (s *fileStorage) appendToHistory(pipelineId string, pipelineStateJson []byte) error {
+	if s.stateHistoryRetention == 0 {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	historyFilePath := getPipelineStateHistoryFile(pipelineId)
+	lines, ok := s.historyLines[pipelineId]
+	if !ok && s.stateHistoryRetention > 0 {
+		historyBytes, err := ioutil.ReadFile(historyFilePath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		lines = bytes.Count(historyBytes, []byte{'\n'})
+	}
+
+	//open for append or create and open for write if it does not exist
+	openFlag := os.O_APPEND | os.O_CREATE | os.O_WRONLY
+	historyFile, err := os.OpenFile(historyFilePath, openFlag, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = historyFile.Write(append(pipelineStateJson, '\n'))
+	if closeErr := historyFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || s.stateHistoryRetention < 0 {
+		return err
+	}
+
+	lines++
+	if lines > 2*s.stateHistoryRetention {
+		if err := trimHistoryFile(historyFilePath, s.stateHistoryRetention); err != nil {
+			delete(s.historyLines, pipelineId)
+			return err
+		}
+		lines = s.stateHistoryRetention
+	}
+	s.historyLines[pipelineId] = lines
+	return nil
+}
+
+// trimHistoryFile rewrites the JSON lines file with only its last retention lines, when it has more
+func trimHistoryFile(historyFilePath string, retention int) error {
+	historyBytes, err := ioutil.ReadFile(historyFilePath)
+	if err != nil {
+		return err
+	}
+	expiredLines := bytes.Count(historyBytes, []byte{'\n'}) - retention
+	if expiredLines <= 0 {
+		return nil
+	}
+	for ; expiredLines > 0; expiredLines-- {
+		historyBytes = historyBytes[bytes.IndexByte(historyBytes, '\n')+1:]
+	}
+	return util.WriteFileAtomic(historyFilePath, historyBytes, 0666)
+}
+
+func (s *fileStorage) GetHistory(pipelineId string) ([]*common.PipelineState, error) {
+	fileExists, err := checkFileExists(getPipelineStateHistoryFile(pipelineId))
+	if err != nil {
+		return nil, err
+	}
+
+	history_of_states := []*common.PipelineState{}
+
+	if fileExists {
+		fileBytes, readError := ioutil.ReadFile(getPipelineStateHistoryFile(pipelineId))
+
+		if readError != nil {
+			return nil, readError
+		}
+		var err error = nil
+		decoder := json.NewDecoder(bytes.NewReader(fileBytes))
+		for err == nil {
+			var pipelineState common.PipelineState
+			err = decoder.Decode(&pipelineState)
+			if err == nil {
+				history_of_states = append(history_of_states, &pipelineState)
+			}
+		}
+		if err != io.EOF {
+			return nil, err
+		}
+	}
+	if s.stateHistoryRetention > 0 && len(history_of_states) > s.stateHistoryRetention {
+		// The history file is only trimmed once it holds twice the retention
+		history_of_states = history_of_states[len(history_of_states)-s.stateHistoryRetention:]
+	}
+	return history_of_states, nil
+}
+
+func (s *fileStorage) DeleteHistory(pipelineId string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.historyLines, pipelineId)
+	historyFilePath := getPipelineStateHistoryFile(pipelineId)
+	for _, filePath := range []string{historyFilePath, historyFilePath + util.BackupFileSuffix} {
+		if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *fileStorage) Delete(pipelineId string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.historyLines, pipelineId)
+	return os.RemoveAll(getRunInfoDir(pipelineId))
+}
+
+func (s *fileStorage) Close() error {
+	return nil
+}
+
+func newFileStorage(config Config) *fileStorage {
+	return &fileStorage{
+		stateHistoryRetention: config.StateHistoryRetention,
+		historyLines:          make(map[string]int),
+	}
+}
+
+func checkFileExists(filePath string) (bool, error) {
+	_, err := os.Stat(filePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	} else {
+		return true, nil
+	}
+}
+
+func getPipelineOffsetFile(pipelineId string) string {
+	return getRunInfoDir(pipelineId) + OFFSET_FILE
+}
+
+func getPipelineStateFile(pipelineId string) string {
+	return getRunInfoDir(pipelineId) + PIPELINE_STATE_FILE
+}
+
+func getPipelineStateHistoryFile(pipelineId string) string {
+	return getRunInfoDir(pipelineId) + PIPELINE_STATE_HISTORY_FILE
+}
@@ -0,0 +1,95 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"bytes"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func countHistoryFileLines(t *testing.T, pipelineId string) int {
+	historyBytes, err := ioutil.ReadFile(getPipelineStateHistoryFile(pipelineId))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.Count(historyBytes, []byte{'\n'})
+}
+
+func TestFileStorage_StateHistoryRetention(t *testing.T) {
+	var err error
+	BaseDir, err = ioutil.TempDir("", "file_storage_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(BaseDir)
+
+	config := NewConfig()
+	config.StateHistoryRetention = 2
+	if err := OpenStorage(config); err != nil {
+		t.Fatal(err)
+	}
+	defer CloseStorage()
+
+	pipelineId := "filePipeline"
+	pipelineState, err := GetState(pipelineId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range []string{common.STARTING, common.RUNNING, common.STOPPING, common.STOPPED} {
+		pipelineState.Status = status
+		if err := SaveState(pipelineId, pipelineState); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	history, err := GetHistory(pipelineId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Status != common.STOPPING || history[1].Status != common.STOPPED {
+		t.Errorf("Expected the history to keep the last 2 states, but got: %d states", len(history))
+	}
+
+	// The initial state and the 4 saved states exceeded twice the retention, the history file was trimmed
+	if lines := countHistoryFileLines(t, pipelineId); lines != 2 {
+		t.Errorf("Expected 2 states in the trimmed history file, but got: %d", lines)
+	}
+	for _, status := range []string{common.STARTING, common.RUNNING} {
+		pipelineState.Status = status
+		if err := SaveState(pipelineId, pipelineState); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lines := countHistoryFileLines(t, pipelineId); lines != 4 {
+		t.Errorf("Expected 4 states in the history file before it is trimmed, but got: %d", lines)
+	}
+	if history, err = GetHistory(pipelineId); err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Status != common.STARTING || history[1].Status != common.RUNNING {
+		t.Errorf("Expected the history to keep the last 2 states, but got: %d states", len(history))
+	}
+
+	if err := DeleteHistory(pipelineId); err != nil {
+		t.Fatal(err)
+	}
+	if history, err = GetHistory(pipelineId); err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 0 {
+		t.Errorf("Expected the history to be deleted, but got: %d states", len(history))
+	}
+}
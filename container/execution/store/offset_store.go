@@ -13,10 +13,7 @@
 package store
 
 import (
-	"encoding/json"
 	"github.com/streamsets/datacollector-edge/container/common"
-	"io/ioutil"
-	"os"
 	"strings"
 )
 
@@ -25,43 +22,45 @@ var BaseDir = "."
 const (
 	OFFSET_FILE               = "offset.json"
 	PIPELINES_RUN_INFO_FOLDER = "/data/runInfo/"
+	PIPELINE_SPOOL_FOLDER     = "spool/"
+	BOLT_STORAGE_FILE         = "/data/pipelineStore.db"
 )
 
+// GetOffset returns the committed offset, or the default offset if the pipeline never committed one. With the
+// file storage a corrupted offset file falls back to the previous generation, an error is returned instead of
+// the default offset when both generations are unreadable, so the pipeline never silently restarts from the
+// beginning.
 func GetOffset(pipelineId string) (common.SourceOffset, error) {
-	defaultSourceOffset := common.GetDefaultOffset()
-	if _, err := os.Stat(getPipelineOffsetFile(pipelineId)); os.IsNotExist(err) {
-		return defaultSourceOffset, nil
-	} else {
-		file, readError := ioutil.ReadFile(getPipelineOffsetFile(pipelineId))
-
-		if readError != nil {
-			return defaultSourceOffset, readError
-		}
-
-		var sourceOffset common.SourceOffset
-		json.Unmarshal(file, &sourceOffset)
-		return sourceOffset, nil
+	sourceOffset, err := getStorage().ReadOffset(pipelineId)
+	if err != nil {
+		return common.GetDefaultOffset(), err
+	} else if sourceOffset == nil {
+		return common.GetDefaultOffset(), nil
 	}
+	return *sourceOffset, nil
 }
 
 func SaveOffset(pipelineId string, sourceOffset common.SourceOffset) error {
-	var err error
-	var offsetJson []byte
-	if offsetJson, err = json.Marshal(sourceOffset); err == nil {
-		err = ioutil.WriteFile(getPipelineOffsetFile(pipelineId), offsetJson, 0644)
-	}
-	return err
+	return getStorage().WriteOffset(pipelineId, sourceOffset)
 }
 
 func ResetOffset(pipelineId string) error {
 	return SaveOffset(pipelineId, common.GetDefaultOffset())
 }
 
-func getPipelineOffsetFile(pipelineId string) string {
-	return getRunInfoDir(pipelineId) + OFFSET_FILE
+// GetSpoolDir returns the directory holding the store and forward queue of the pipeline
+func GetSpoolDir(pipelineId string) string {
+	return getRunInfoDir(pipelineId) + PIPELINE_SPOOL_FOLDER
+}
+
+func getBoltStorageFile() string {
+	return BaseDir + BOLT_STORAGE_FILE
 }
 
 func getRunInfoDir(pipelineId string) string {
-	validPipelineId := strings.Replace(pipelineId, ":", "", -1)
-	return BaseDir + PIPELINES_RUN_INFO_FOLDER + validPipelineId + "/"
+	return BaseDir + PIPELINES_RUN_INFO_FOLDER + getValidPipelineId(pipelineId) + "/"
+}
+
+func getValidPipelineId(pipelineId string) string {
+	return strings.Replace(pipelineId, ":", "", -1)
 }
@@ -0,0 +1,65 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"github.com/streamsets/datacollector-edge/container/common"
+	"github.com/streamsets/datacollector-edge/container/util"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestOffsetStore_CorruptedOffset(t *testing.T) {
+	var err error
+	BaseDir, err = ioutil.TempDir("", "offset_store_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(BaseDir)
+
+	pipelineId := "offsetPipeline"
+	if err := os.MkdirAll(getRunInfoDir(pipelineId), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, offset := range []string{"offset1", "offset2"} {
+		sourceOffset := common.GetDefaultOffset()
+		value := offset
+		sourceOffset.Offset[common.PollSourceOffsetKey] = &value
+		if err := SaveOffset(pipelineId, sourceOffset); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Simulates a power loss while writing the offset file
+	if err := ioutil.WriteFile(getPipelineOffsetFile(pipelineId), []byte(`{"Version":2,"Off`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sourceOffset, err := GetOffset(pipelineId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := sourceOffset.Offset[common.PollSourceOffsetKey]
+	if offset == nil || *offset != "offset1" {
+		t.Errorf("Expected the previous offset offset1, but got: %v", offset)
+	}
+
+	if err := os.Remove(getPipelineOffsetFile(pipelineId) + util.BackupFileSuffix); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetOffset(pipelineId); err == nil {
+		t.Error("Expected an error for a corrupted offset without backup")
+	}
+}
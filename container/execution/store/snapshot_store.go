@@ -0,0 +1,204 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/streamsets/datacollector-edge/container/util"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	SNAPSHOTS_FOLDER           = "snapshots/"
+	SNAPSHOT_INFO_FILE         = "info.json"
+	SNAPSHOT_DATA_FILE         = "output.json"
+	snapshotAlreadyExistsError = "CONTAINER_0058 - Snapshot '%s' already exists for pipeline '%s'"
+	snapshotNotFoundError      = "CONTAINER_0059 - Snapshot '%s' does not exist for pipeline '%s'"
+	invalidSnapshotNameError   = "CONTAINER_0065 - Invalid snapshot name '%s'"
+)
+
+// SnapshotInfo describes a snapshot of a pipeline, the JSON shape is the one of Data Collector
+type SnapshotInfo struct {
+	PipelineId      string `json:"name"`
+	Rev             string `json:"rev"`
+	Id              string `json:"id"`
+	Label           string `json:"label"`
+	User            string `json:"user"`
+	TimeStamp       int64  `json:"timeStamp"`
+	InProgress      bool   `json:"inProgress"`
+	BatchNumber     int64  `json:"batchNumber"`
+	FailureSnapshot bool   `json:"failureSnapshot"`
+}
+
+// SnapshotData holds the captured batches, every batch is the list of the stage outputs in processing order
+type SnapshotData struct {
+	SnapshotBatches [][]interface{} `json:"snapshotBatches"`
+}
+
+// CreateSnapshot stores the info of a new snapshot which is in progress until SaveSnapshotData is called
+func CreateSnapshot(pipelineId string, snapshotId string, label string, user string) (*SnapshotInfo, error) {
+	if len(snapshotId) == 0 {
+		return nil, errors.New("snapshot name is required")
+	}
+	if err := validateSnapshotId(snapshotId); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(getSnapshotDir(pipelineId, snapshotId)); err == nil {
+		return nil, fmt.Errorf(snapshotAlreadyExistsError, snapshotId, pipelineId)
+	}
+	if err := os.MkdirAll(getSnapshotDir(pipelineId, snapshotId), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	snapshotInfo := &SnapshotInfo{
+		PipelineId: pipelineId,
+		Rev:        "0",
+		Id:         snapshotId,
+		Label:      label,
+		User:       user,
+		TimeStamp:  util.ConvertTimeToLong(time.Now()),
+		InProgress: true,
+	}
+	return snapshotInfo, writeSnapshotInfo(snapshotInfo)
+}
+
+// SaveSnapshotData stores the captured batches and completes the snapshot, batchNumber is the number of
+// batches processed by the pipeline when the capture completed
+func SaveSnapshotData(pipelineId string, snapshotId string, snapshotData SnapshotData, batchNumber int64) error {
+	snapshotInfo, err := GetSnapshotInfo(pipelineId, snapshotId)
+	if err != nil {
+		return err
+	}
+
+	if snapshotData.SnapshotBatches == nil {
+		snapshotData.SnapshotBatches = make([][]interface{}, 0)
+	}
+	snapshotDataJson, err := json.Marshal(snapshotData)
+	if err != nil {
+		return err
+	}
+	if err := util.WriteFileAtomic(getSnapshotDataFile(pipelineId, snapshotId), snapshotDataJson, 0644); err != nil {
+		return err
+	}
+
+	snapshotInfo.InProgress = false
+	snapshotInfo.BatchNumber = batchNumber
+	return writeSnapshotInfo(snapshotInfo)
+}
+
+func GetSnapshotInfo(pipelineId string, snapshotId string) (*SnapshotInfo, error) {
+	if err := validateSnapshotId(snapshotId); err != nil {
+		return nil, err
+	}
+	var snapshotInfo *SnapshotInfo
+	err := util.ReadFileWithBackup(getSnapshotInfoFile(pipelineId, snapshotId), func(data []byte) error {
+		snapshotInfo = &SnapshotInfo{}
+		return json.Unmarshal(data, snapshotInfo)
+	})
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf(snapshotNotFoundError, snapshotId, pipelineId)
+	}
+	return snapshotInfo, err
+}
+
+// GetSnapshotsInfo returns the info of all snapshots of the pipeline, oldest first
+func GetSnapshotsInfo(pipelineId string) ([]*SnapshotInfo, error) {
+	snapshotsInfo := make([]*SnapshotInfo, 0)
+	fileInfos, err := ioutil.ReadDir(getSnapshotsDir(pipelineId))
+	if os.IsNotExist(err) {
+		return snapshotsInfo, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, fileInfo := range fileInfos {
+		if !fileInfo.IsDir() {
+			continue
+		}
+		snapshotId, err := url.PathUnescape(fileInfo.Name())
+		if err != nil {
+			continue
+		}
+		snapshotInfo, err := GetSnapshotInfo(pipelineId, snapshotId)
+		if err != nil {
+			return nil, err
+		}
+		snapshotsInfo = append(snapshotsInfo, snapshotInfo)
+	}
+	sort.SliceStable(snapshotsInfo, func(i, j int) bool {
+		return snapshotsInfo[i].TimeStamp < snapshotsInfo[j].TimeStamp
+	})
+	return snapshotsInfo, nil
+}
+
+// GetSnapshotData returns the SnapshotData JSON of the snapshot, an empty list of batches while it is in progress
+func GetSnapshotData(pipelineId string, snapshotId string) ([]byte, error) {
+	snapshotInfo, err := GetSnapshotInfo(pipelineId, snapshotId)
+	if err != nil {
+		return nil, err
+	}
+	if snapshotInfo.InProgress {
+		return json.Marshal(SnapshotData{SnapshotBatches: make([][]interface{}, 0)})
+	}
+	return ioutil.ReadFile(getSnapshotDataFile(pipelineId, snapshotId))
+}
+
+func DeleteSnapshot(pipelineId string, snapshotId string) error {
+	if err := validateSnapshotId(snapshotId); err != nil {
+		return err
+	}
+	if _, err := os.Stat(getSnapshotDir(pipelineId, snapshotId)); os.IsNotExist(err) {
+		return fmt.Errorf(snapshotNotFoundError, snapshotId, pipelineId)
+	}
+	return os.RemoveAll(getSnapshotDir(pipelineId, snapshotId))
+}
+
+// validateSnapshotId rejects names which do not resolve to a directory of their own in the snapshots directory,
+// url.PathEscape keeps "." and ".." which would point to the snapshots or the pipeline run info directory
+func validateSnapshotId(snapshotId string) error {
+	if len(snapshotId) == 0 || snapshotId == "." || snapshotId == ".." || strings.ContainsAny(snapshotId, `/\`) {
+		return fmt.Errorf(invalidSnapshotNameError, snapshotId)
+	}
+	return nil
+}
+
+func writeSnapshotInfo(snapshotInfo *SnapshotInfo) error {
+	snapshotInfoJson, err := json.Marshal(snapshotInfo)
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(getSnapshotInfoFile(snapshotInfo.PipelineId, snapshotInfo.Id), snapshotInfoJson, 0644)
+}
+
+func getSnapshotsDir(pipelineId string) string {
+	return getRunInfoDir(pipelineId) + SNAPSHOTS_FOLDER
+}
+
+func getSnapshotDir(pipelineId string, snapshotId string) string {
+	return getSnapshotsDir(pipelineId) + url.PathEscape(snapshotId) + "/"
+}
+
+func getSnapshotInfoFile(pipelineId string, snapshotId string) string {
+	return getSnapshotDir(pipelineId, snapshotId) + SNAPSHOT_INFO_FILE
+}
+
+func getSnapshotDataFile(pipelineId string, snapshotId string) string {
+	return getSnapshotDir(pipelineId, snapshotId) + SNAPSHOT_DATA_FILE
+}
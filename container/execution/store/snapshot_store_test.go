@@ -0,0 +1,58 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSnapshotStore_InvalidSnapshotNames(t *testing.T) {
+	var err error
+	BaseDir, err = ioutil.TempDir("", "snapshot_store_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(BaseDir)
+
+	pipelineId := "snapshotPipeline"
+	// Creates the pipeline run info directory
+	if _, err := GetState(pipelineId); err != nil {
+		t.Fatal(err)
+	}
+	saveTestOffset(t, pipelineId, "offset1")
+	if _, err := CreateSnapshot(pipelineId, "snapshot1", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, snapshotId := range []string{".", "..", "../snapshot1", "a/b", `a\b`} {
+		if _, err := CreateSnapshot(pipelineId, snapshotId, "", ""); err == nil {
+			t.Errorf("Expected an error creating snapshot %q", snapshotId)
+		}
+		if _, err := GetSnapshotInfo(pipelineId, snapshotId); err == nil {
+			t.Errorf("Expected an error getting snapshot %q", snapshotId)
+		}
+		if err := DeleteSnapshot(pipelineId, snapshotId); err == nil {
+			t.Errorf("Expected an error deleting snapshot %q", snapshotId)
+		}
+	}
+
+	// Neither the offset nor the other snapshots were removed
+	if _, err := os.Stat(getPipelineOffsetFile(pipelineId)); err != nil {
+		t.Errorf("Expected the offset file to be kept, but got: %v", err)
+	}
+	if _, err := GetSnapshotInfo(pipelineId, "snapshot1"); err != nil {
+		t.Errorf("Expected snapshot1 to be kept, but got: %v", err)
+	}
+}
@@ -13,13 +13,10 @@
 package store
 
 import (
-	"bytes"
-	"encoding/json"
 	"github.com/streamsets/datacollector-edge/container/common"
 	"github.com/streamsets/datacollector-edge/container/util"
-	"io"
-	"io/ioutil"
 	"os"
+	"sync"
 	"time"
 )
 
@@ -28,26 +25,40 @@ const (
 	PIPELINE_STATE_HISTORY_FILE = "pipelineStateHistory.json"
 	IS_REMOTE_PIPELINE          = "IS_REMOTE_PIPELINE"
 	ISSUES                      = "issues"
+	RETRY_ATTEMPT               = "retryAttempt"
+	NEXT_RETRY_TIME_STAMP       = "nextRetryTimeStamp"
 )
 
-func checkFileExists(filePath string) (bool, error) {
-	_, err := os.Stat(filePath)
-	if os.IsNotExist(err) {
-		return false, nil
-	} else if err != nil {
-		return false, err
-	} else {
-		return true, nil
+// StateListener is called after a pipeline state was saved, it gets a copy of the saved state
+type StateListener func(pipelineId string, pipelineState common.PipelineState)
+
+var (
+	stateListeners      []StateListener
+	stateListenersMutex sync.RWMutex
+)
+
+// AddStateListener registers a listener which is called after every successful SaveState
+func AddStateListener(stateListener StateListener) {
+	stateListenersMutex.Lock()
+	defer stateListenersMutex.Unlock()
+	stateListeners = append(stateListeners, stateListener)
+}
+
+func notifyStateListeners(pipelineId string, pipelineState *common.PipelineState) {
+	stateListenersMutex.RLock()
+	defer stateListenersMutex.RUnlock()
+	for _, stateListener := range stateListeners {
+		stateListener(pipelineId, *pipelineState)
 	}
 }
 
 func GetState(pipelineId string) (*common.PipelineState, error) {
-	fileExists, err := checkFileExists(getPipelineStateFile(pipelineId))
+	pipelineState, err := getStorage().ReadState(pipelineId)
 	if err != nil {
 		return nil, err
 	}
-	if !fileExists {
-		pipelineState := &common.PipelineState{
+	if pipelineState == nil {
+		pipelineState = &common.PipelineState{
 			PipelineId: pipelineId,
 			Status:     common.EDITED,
 			Message:    "",
@@ -59,18 +70,8 @@ func GetState(pipelineId string) (*common.PipelineState, error) {
 		if err == nil {
 			err = SaveState(pipelineId, pipelineState)
 		}
-		return pipelineState, err
-	} else {
-		file, readError := ioutil.ReadFile(getPipelineStateFile(pipelineId))
-
-		if readError != nil {
-			return nil, readError
-		}
-
-		var pipelineState common.PipelineState
-		err := json.Unmarshal(file, &pipelineState)
-		return &pipelineState, err
 	}
+	return pipelineState, err
 }
 
 func Edited(pipelineId string, isRemote bool) error {
@@ -88,62 +89,13 @@ func Edited(pipelineId string, isRemote bool) error {
 }
 
 func SaveState(pipelineId string, pipelineState *common.PipelineState) error {
-	var err error
-	var pipelineStateJson []byte
-	if pipelineStateJson, err = json.Marshal(pipelineState); err == nil {
-		if err = ioutil.WriteFile(getPipelineStateFile(pipelineId), pipelineStateJson, 0644); err == nil {
-			//open for append or create and open for write if it does not exist
-			openFlag := os.O_APPEND | os.O_CREATE | os.O_WRONLY
-
-			var historyFile *os.File
-
-			//save in history file as well.
-			if historyFile, err = os.OpenFile(getPipelineStateHistoryFile(pipelineId), openFlag, 0666); err == nil {
-				defer util.CloseFile(historyFile)
-				_, err = historyFile.Write(pipelineStateJson)
-				if err == nil {
-					_, err = historyFile.WriteString("\n")
-				}
-			}
-		}
+	err := getStorage().WriteState(pipelineId, pipelineState)
+	if err == nil {
+		notifyStateListeners(pipelineId, pipelineState)
 	}
 	return err
 }
 
 func GetHistory(pipelineId string) ([]*common.PipelineState, error) {
-	fileExists, err := checkFileExists(getPipelineStateHistoryFile(pipelineId))
-	if err != nil {
-		return nil, err
-	}
-
-	history_of_states := []*common.PipelineState{}
-
-	if fileExists {
-		fileBytes, readError := ioutil.ReadFile(getPipelineStateHistoryFile(pipelineId))
-
-		if readError != nil {
-			return nil, readError
-		}
-		var err error = nil
-		decoder := json.NewDecoder(bytes.NewReader(fileBytes))
-		for err == nil {
-			var pipelineState common.PipelineState
-			err = decoder.Decode(&pipelineState)
-			if err == nil {
-				history_of_states = append(history_of_states, &pipelineState)
-			}
-		}
-		if err != io.EOF {
-			return nil, err
-		}
-	}
-	return history_of_states, nil
-}
-
-func getPipelineStateFile(pipelineId string) string {
-	return getRunInfoDir(pipelineId) + PIPELINE_STATE_FILE
-}
-
-func getPipelineStateHistoryFile(pipelineId string) string {
-	return getRunInfoDir(pipelineId) + PIPELINE_STATE_HISTORY_FILE
+	return getStorage().GetHistory(pipelineId)
 }
@@ -0,0 +1,141 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package store
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	FileStorageType               = "file"
+	BoltStorageType               = "bolt"
+	DefaultStateHistoryRetention  = 1000
+	DefaultOffsetHistoryRetention = 100
+	unsupportedStorageTypeError   = "CONTAINER_0054 - Unsupported storage type '%s', expected '%s' or '%s'"
+)
+
+// Storage persists the offsets, states and state history of pipelines. The file storage keeps JSON files in
+// the pipeline run info directory, the bolt storage keeps everything in an embedded transactional key value store.
+type Storage interface {
+	// ReadOffset returns the committed offset, nil if the pipeline never committed an offset
+	ReadOffset(pipelineId string) (*common.SourceOffset, error)
+	WriteOffset(pipelineId string, sourceOffset common.SourceOffset) error
+	// GetOffsetHistory returns the previously committed offsets, oldest first
+	GetOffsetHistory(pipelineId string) ([]common.SourceOffset, error)
+	// ReadState returns the current state, nil if the pipeline has no state yet
+	ReadState(pipelineId string) (*common.PipelineState, error)
+	// WriteState replaces the current state and appends it to the state history
+	WriteState(pipelineId string, pipelineState *common.PipelineState) error
+	// GetHistory returns the state history, oldest first
+	GetHistory(pipelineId string) ([]*common.PipelineState, error)
+	DeleteHistory(pipelineId string) error
+	Delete(pipelineId string) error
+	Close() error
+}
+
+type Config struct {
+	Type                   string `toml:"type"`
+	StateHistoryRetention  int    `toml:"state-history-retention"`
+	OffsetHistoryRetention int    `toml:"offset-history-retention"`
+	ErrorRecordsRetention  int    `toml:"error-records-retention"`
+}
+
+// NewConfig returns a new Config with default settings.
+func NewConfig() Config {
+	return Config{
+		Type:                   FileStorageType,
+		StateHistoryRetention:  DefaultStateHistoryRetention,
+		OffsetHistoryRetention: DefaultOffsetHistoryRetention,
+		ErrorRecordsRetention:  DefaultErrorRecordsRetention,
+	}
+}
+
+var (
+	storage      Storage = newFileStorage(NewConfig())
+	storageMutex sync.RWMutex
+)
+
+// OpenStorage replaces the default file storage with the configured storage, BaseDir must be set before.
+// Opening the bolt storage the first time migrates the offsets, states and history of the file storage.
+func OpenStorage(config Config) error {
+	var newStorage Storage
+	switch config.Type {
+	case "", FileStorageType:
+		newStorage = newFileStorage(config)
+	case BoltStorageType:
+		if err := os.MkdirAll(filepath.Dir(getBoltStorageFile()), os.ModePerm); err != nil {
+			return err
+		}
+		boltStorage, err := NewBoltStorage(getBoltStorageFile(), config)
+		if err != nil {
+			return err
+		}
+		if err := boltStorage.migrate(&fileStorage{}); err != nil {
+			_ = boltStorage.Close()
+			return err
+		}
+		newStorage = boltStorage
+	default:
+		return fmt.Errorf(unsupportedStorageTypeError, config.Type, FileStorageType, BoltStorageType)
+	}
+
+	storageMutex.Lock()
+	defer storageMutex.Unlock()
+	if err := storage.Close(); err != nil {
+		log.WithError(err).Warn("Failed to close pipeline storage")
+	}
+	storage = newStorage
+	log.WithField("type", config.Type).Info("Opened pipeline storage")
+	return nil
+}
+
+// CloseStorage closes the storage and switches back to the file storage
+func CloseStorage() error {
+	storageMutex.Lock()
+	defer storageMutex.Unlock()
+	err := storage.Close()
+	storage = newFileStorage(NewConfig())
+	return err
+}
+
+func getStorage() Storage {
+	storageMutex.RLock()
+	defer storageMutex.RUnlock()
+	return storage
+}
+
+// GetOffsetHistory returns the previously committed offsets of the pipeline, oldest first
+func GetOffsetHistory(pipelineId string) ([]common.SourceOffset, error) {
+	return getStorage().GetOffsetHistory(pipelineId)
+}
+
+// DeleteHistory removes the state history of the pipeline
+func DeleteHistory(pipelineId string) error {
+	return getStorage().DeleteHistory(pipelineId)
+}
+
+// DeletePipeline removes the offsets, state, history, retained errors and snapshots of the pipeline
+func DeletePipeline(pipelineId string) error {
+	if err := deleteErrorStore(pipelineId); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(getSnapshotsDir(pipelineId)); err != nil {
+		return err
+	}
+	return getStorage().Delete(pipelineId)
+}
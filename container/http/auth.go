@@ -0,0 +1,285 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package http
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+	"github.com/streamsets/datacollector-edge/container/util"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const (
+	RoleAdmin         = "admin"
+	RoleReadOnly      = "read-only"
+	Authorization     = "Authorization"
+	WwwAuthenticate   = "WWW-Authenticate"
+	BasicRealm        = `Basic realm="Data Collector Edge"`
+	BearerPrefix      = "Bearer "
+	Sha256Prefix      = "SHA256:"
+	BcryptPrefix      = "BCRYPT:"
+	userContextKey    = contextKey("user")
+	anonymousUserName = "admin"
+)
+
+type contextKey string
+
+// User is the authenticated user of a REST API request
+type User struct {
+	Name  string
+	Roles []string
+}
+
+// HasRole returns true if the user has the role, the admin role grants every role
+func (u *User) HasRole(role string) bool {
+	for _, userRole := range u.Roles {
+		if userRole == role || userRole == RoleAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator authenticates REST API requests, it returns no user and no error if the request does not
+// carry credentials of this authenticator
+type Authenticator interface {
+	Authenticate(r *http.Request) (*User, error)
+}
+
+// credential is an entry of a users or tokens file, the secret is stored as plain text or as a SHA256 or
+// bcrypt hash
+type credential struct {
+	name   string
+	secret string
+	roles  []string
+}
+
+func (c *credential) matches(secret string) bool {
+	switch {
+	case strings.HasPrefix(c.secret, Sha256Prefix):
+		hash := sha256.Sum256([]byte(secret))
+		expected := strings.ToLower(strings.TrimPrefix(c.secret, Sha256Prefix))
+		return subtle.ConstantTimeCompare([]byte(hex.EncodeToString(hash[:])), []byte(expected)) == 1
+	case strings.HasPrefix(c.secret, BcryptPrefix):
+		return bcrypt.CompareHashAndPassword([]byte(strings.TrimPrefix(c.secret, BcryptPrefix)), []byte(secret)) == nil
+	default:
+		return subtle.ConstantTimeCompare([]byte(c.secret), []byte(secret)) == 1
+	}
+}
+
+func (c *credential) user() *User {
+	return &User{Name: c.name, Roles: c.roles}
+}
+
+// basicAuthenticator authenticates users with basic authentication against a users file
+type basicAuthenticator struct {
+	users map[string]*credential
+}
+
+func (a *basicAuthenticator) Authenticate(r *http.Request) (*User, error) {
+	userName, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+	if user, ok := a.users[userName]; ok && user.matches(password) {
+		return user.user(), nil
+	}
+	return nil, fmt.Errorf("invalid user name or password for user '%s'", userName)
+}
+
+// tokenAuthenticator authenticates bearer tokens against a tokens file
+type tokenAuthenticator struct {
+	tokens []*credential
+}
+
+func (a *tokenAuthenticator) Authenticate(r *http.Request) (*User, error) {
+	authorization := r.Header.Get(Authorization)
+	if !strings.HasPrefix(authorization, BearerPrefix) {
+		return nil, nil
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(authorization, BearerPrefix))
+	for _, credential := range a.tokens {
+		if credential.matches(token) {
+			return credential.user(), nil
+		}
+	}
+	return nil, errors.New("invalid bearer token")
+}
+
+// clientCertAuthenticator authenticates verified client certificates by the common name of their subject
+type clientCertAuthenticator struct {
+	roles map[string]string
+}
+
+func (a *clientCertAuthenticator) Authenticate(r *http.Request) (*User, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+	commonName := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	if role, ok := a.roles[commonName]; ok {
+		return &User{Name: commonName, Roles: []string{role}}, nil
+	}
+	// Certificates without a role can still authenticate with basic authentication or a bearer token
+	return nil, nil
+}
+
+// newAuthenticators returns the authenticators of the config, no authenticators if authentication is disabled
+func newAuthenticators(config AuthConfig) ([]Authenticator, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+
+	authenticators := make([]Authenticator, 0)
+	if len(config.ClientCertRoles) > 0 {
+		for commonName, role := range config.ClientCertRoles {
+			if err := validateRole(role); err != nil {
+				return nil, fmt.Errorf("invalid role for client certificate '%s': %s", commonName, err)
+			}
+		}
+		authenticators = append(authenticators, &clientCertAuthenticator{roles: config.ClientCertRoles})
+	}
+	if len(config.UsersFile) > 0 {
+		users, err := readCredentialsFile(config.UsersFile)
+		if err != nil {
+			return nil, err
+		}
+		basicAuthenticator := &basicAuthenticator{users: make(map[string]*credential)}
+		for _, user := range users {
+			basicAuthenticator.users[user.name] = user
+		}
+		authenticators = append(authenticators, basicAuthenticator)
+	}
+	if len(config.TokensFile) > 0 {
+		tokens, err := readCredentialsFile(config.TokensFile)
+		if err != nil {
+			return nil, err
+		}
+		authenticators = append(authenticators, &tokenAuthenticator{tokens: tokens})
+	}
+
+	if len(authenticators) == 0 {
+		return nil, errors.New("authentication is enabled, but no users-file, tokens-file or client-cert-roles " +
+			"are configured")
+	}
+	return authenticators, nil
+}
+
+// readCredentialsFile reads a users or tokens file with one '<name>: <secret>, <role>[, <role>]' entry per line,
+// empty lines and lines starting with # are ignored
+func readCredentialsFile(filePath string) ([]*credential, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer util.CloseFile(file)
+
+	credentials := make([]*credential, 0)
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		separator := strings.Index(line, ":")
+		if separator <= 0 {
+			return nil, fmt.Errorf("invalid entry in '%s' line %d, expected '<name>: <secret>, <role>'",
+				filePath, lineNumber)
+		}
+		values := strings.Split(line[separator+1:], ",")
+		if len(values) < 2 {
+			return nil, fmt.Errorf("missing role in '%s' line %d", filePath, lineNumber)
+		}
+		credential := &credential{
+			name:   strings.TrimSpace(line[:separator]),
+			secret: strings.TrimSpace(values[0]),
+		}
+		for _, role := range values[1:] {
+			role = strings.TrimSpace(role)
+			if err := validateRole(role); err != nil {
+				return nil, fmt.Errorf("invalid role in '%s' line %d: %s", filePath, lineNumber, err)
+			}
+			credential.roles = append(credential.roles, role)
+		}
+		credentials = append(credentials, credential)
+	}
+	return credentials, scanner.Err()
+}
+
+func validateRole(role string) error {
+	if role != RoleAdmin && role != RoleReadOnly {
+		return fmt.Errorf("unknown role '%s', expected '%s' or '%s'", role, RoleAdmin, RoleReadOnly)
+	}
+	return nil
+}
+
+// authorize returns a handle which serves the request only if its user has the role. Without authentication
+// every request is served as the admin user.
+func (webServerTask *WebServerTask) authorize(role string, handle httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		user, err := webServerTask.authenticate(r)
+		if err != nil {
+			log.WithError(err).WithField("remoteAddr", r.RemoteAddr).Warn("REST API authentication failed")
+			if webServerTask.basicAuthEnabled {
+				w.Header().Set(WwwAuthenticate, BasicRealm)
+			}
+			errorReq(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if !user.HasRole(role) {
+			errorReq(w, http.StatusForbidden, fmt.Sprintf("User '%s' does not have the '%s' role", user.Name, role))
+			return
+		}
+		handle(w, r.WithContext(context.WithValue(r.Context(), userContextKey, user)), ps)
+	}
+}
+
+// authorizeHandler authorizes the requests of a standard http.Handler like the pprof handlers
+func (webServerTask *WebServerTask) authorizeHandler(role string, handler http.Handler) httprouter.Handle {
+	return webServerTask.authorize(role, func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		handler.ServeHTTP(w, r)
+	})
+}
+
+func (webServerTask *WebServerTask) authenticate(r *http.Request) (*User, error) {
+	if len(webServerTask.authenticators) == 0 {
+		return &User{Name: anonymousUserName, Roles: []string{RoleAdmin}}, nil
+	}
+	for _, authenticator := range webServerTask.authenticators {
+		user, err := authenticator.Authenticate(r)
+		if err != nil || user != nil {
+			return user, err
+		}
+	}
+	return nil, errors.New("authentication required")
+}
+
+// getUser returns the authenticated user of an authorized request
+func getUser(r *http.Request) *User {
+	if user, ok := r.Context().Value(userContextKey).(*User); ok {
+		return user
+	}
+	return &User{Name: anonymousUserName}
+}
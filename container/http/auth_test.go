@@ -0,0 +1,152 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func getAuthTestWebServerTask(t *testing.T, dir string) *WebServerTask {
+	tokenHash := sha256.Sum256([]byte("token2"))
+	files := map[string]string{
+		"users.txt": "# test users\nadmin: admin, admin\n\nguest: SHA256:" +
+			hex.EncodeToString(sha256Sum("guest")) + ", read-only\n",
+		"tokens.txt": "token1: token1, admin\ntoken2: SHA256:" + hex.EncodeToString(tokenHash[:]) + ", read-only\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config := NewConfig()
+	config.Auth.Enabled = true
+	config.Auth.UsersFile = "users.txt"
+	config.Auth.TokensFile = "tokens.txt"
+	config.ResolvePaths(dir)
+
+	webServerTask, err := NewWebServerTask(config, &common.BuildInfo{Version: "test"}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return webServerTask
+}
+
+func sha256Sum(value string) []byte {
+	hash := sha256.Sum256([]byte(value))
+	return hash[:]
+}
+
+func TestWebServerTask_Authorize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	webServerTask := getAuthTestWebServerTask(t, dir)
+
+	testCases := []struct {
+		name           string
+		path           string
+		user           string
+		password       string
+		token          string
+		expectedStatus int
+	}{
+		{"no credentials", "/", "", "", "", http.StatusUnauthorized},
+		{"invalid password", "/", "admin", "guest", "", http.StatusUnauthorized},
+		{"unknown user", "/", "unknown", "admin", "", http.StatusUnauthorized},
+		{"read-only user", "/", "guest", "guest", "", http.StatusOK},
+		{"admin user", "/", "admin", "admin", "", http.StatusOK},
+		{"read-only user pprof", "/debug/pprof/cmdline", "guest", "guest", "", http.StatusForbidden},
+		{"admin user pprof", "/debug/pprof/cmdline", "admin", "admin", "", http.StatusOK},
+		{"invalid token", "/", "", "", "token3", http.StatusUnauthorized},
+		{"read-only token", "/", "", "", "token2", http.StatusOK},
+		{"read-only token pprof", "/debug/pprof/cmdline", "", "", "token2", http.StatusForbidden},
+		{"admin token pprof", "/debug/pprof/cmdline", "", "", "token1", http.StatusOK},
+	}
+
+	for _, testCase := range testCases {
+		request := httptest.NewRequest("GET", testCase.path, nil)
+		if len(testCase.user) > 0 {
+			request.SetBasicAuth(testCase.user, testCase.password)
+		}
+		if len(testCase.token) > 0 {
+			request.Header.Set(Authorization, BearerPrefix+testCase.token)
+		}
+		recorder := httptest.NewRecorder()
+		webServerTask.httpServer.Handler.ServeHTTP(recorder, request)
+		if recorder.Code != testCase.expectedStatus {
+			t.Errorf("%s: expected status %d, but got: %d", testCase.name, testCase.expectedStatus, recorder.Code)
+		}
+		if recorder.Code == http.StatusUnauthorized && recorder.Header().Get(WwwAuthenticate) != BasicRealm {
+			t.Errorf("%s: expected basic authentication challenge", testCase.name)
+		}
+	}
+}
+
+func TestWebServerTask_PprofDisabled(t *testing.T) {
+	config := NewConfig()
+	config.EnablePprof = false
+	webServerTask, err := NewWebServerTask(config, &common.BuildInfo{Version: "test"}, nil, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := httptest.NewRecorder()
+	webServerTask.httpServer.Handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/debug/pprof/cmdline", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Errorf("Expected pprof to be disabled, but got status: %d", recorder.Code)
+	}
+
+	// Without authentication requests are served as admin
+	recorder = httptest.NewRecorder()
+	webServerTask.httpServer.Handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Expected status %d, but got: %d", http.StatusOK, recorder.Code)
+	}
+}
+
+func TestNewAuthenticators_InvalidConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auth_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := newAuthenticators(AuthConfig{Enabled: true}); err == nil {
+		t.Error("Expected an error without users, tokens or client certificate roles")
+	}
+
+	if _, err := newAuthenticators(AuthConfig{Enabled: true, ClientCertRoles: map[string]string{"cn": "owner"}}); err == nil {
+		t.Error("Expected an error for an unknown client certificate role")
+	}
+
+	usersFile := filepath.Join(dir, "users.txt")
+	for _, content := range []string{"admin admin, admin\n", "admin: admin\n", "admin: admin, owner\n"} {
+		if err := ioutil.WriteFile(usersFile, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := newAuthenticators(AuthConfig{Enabled: true, UsersFile: usersFile}); err == nil {
+			t.Errorf("Expected an error for users file entry: %s", content)
+		}
+	}
+}
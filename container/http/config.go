@@ -12,14 +12,43 @@
 // limitations under the License.
 package http
 
+import (
+	"path/filepath"
+)
+
 const (
 	DefaultBindAddress = ":18633"
 )
 
 type Config struct {
-	Enabled     bool   `toml:"enabled"`
-	BindAddress string `toml:"bind-address"`
-	BaseHttpUrl string `toml:"base-http-url"`
+	Enabled     bool       `toml:"enabled"`
+	BindAddress string     `toml:"bind-address"`
+	BaseHttpUrl string     `toml:"base-http-url"`
+	EnablePprof bool       `toml:"enable-pprof"`
+	TLS         TLSConfig  `toml:"tls"`
+	Auth        AuthConfig `toml:"auth"`
+}
+
+// TLSConfig configures HTTPS for the REST API. The server certificate is read either from PEM cert and key
+// files or from a PKCS12 keystore. Client certificates are verified with the client CA file (mutual TLS).
+type TLSConfig struct {
+	Enabled           bool   `toml:"enabled"`
+	CertFile          string `toml:"cert-file"`
+	KeyFile           string `toml:"key-file"`
+	KeyStoreFile      string `toml:"keystore-file"`
+	KeyStorePassword  string `toml:"keystore-password"`
+	ClientCAFile      string `toml:"client-ca-file"`
+	RequireClientCert bool   `toml:"require-client-cert"`
+}
+
+// AuthConfig configures the authentication of REST API requests. Users authenticate with basic authentication
+// against the users file, with bearer tokens of the tokens file, or with a verified client certificate whose
+// common name is mapped to a role.
+type AuthConfig struct {
+	Enabled         bool              `toml:"enabled"`
+	UsersFile       string            `toml:"users-file"`
+	TokensFile      string            `toml:"tokens-file"`
+	ClientCertRoles map[string]string `toml:"client-cert-roles"`
 }
 
 // NewConfig returns a new Config with default settings.
@@ -27,5 +56,22 @@ func NewConfig() Config {
 	return Config{
 		Enabled:     true,
 		BindAddress: DefaultBindAddress,
+		EnablePprof: true,
+	}
+}
+
+// ResolvePaths resolves the relative paths of the TLS and authentication files against the config directory
+func (c *Config) ResolvePaths(configDir string) {
+	for _, path := range []*string{
+		&c.TLS.CertFile,
+		&c.TLS.KeyFile,
+		&c.TLS.KeyStoreFile,
+		&c.TLS.ClientCAFile,
+		&c.Auth.UsersFile,
+		&c.Auth.TokensFile,
+	} {
+		if len(*path) > 0 && !filepath.IsAbs(*path) {
+			*path = filepath.Join(configDir, *path)
+		}
 	}
 }
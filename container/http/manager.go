@@ -18,7 +18,7 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/sirupsen/logrus"
 	"github.com/streamsets/datacollector-edge/container/common"
-	"github.com/streamsets/datacollector-edge/container/recordio/sdcrecord"
+	"github.com/streamsets/datacollector-edge/container/execution/store"
 	"github.com/streamsets/datacollector-edge/container/util"
 	"io"
 	"net/http"
@@ -135,6 +135,17 @@ func (webServerTask *WebServerTask) historyHandler(w http.ResponseWriter, r *htt
 	}
 }
 
+// Path - DELETE /rest/v1/pipeline/:pipelineId/history
+// Deleting the history of an active pipeline is refused
+func (webServerTask *WebServerTask) deleteHistoryHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	pipelineId := ps.ByName("pipelineId")
+	if err := webServerTask.manager.DeleteHistory(pipelineId); err != nil {
+		serverErrorReq(w, fmt.Sprintf("Failed to delete history:  %s! ", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (webServerTask *WebServerTask) metricsHandler(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	pipelineId := ps.ByName("pipelineId")
 	metricRegistry, err := webServerTask.manager.GetRunner(pipelineId).GetMetrics()
@@ -149,43 +160,52 @@ func (webServerTask *WebServerTask) metricsHandler(w http.ResponseWriter, r *htt
 }
 
 // Path - GET /rest/v1/pipeline/{pipelineId}/errorRecords
+// Query parameters stageInstanceName, size, offset, startTime and endTime (milliseconds since epoch) select a
+// page of the retained error records newest first, download=true returns them as a SDC_JSON file.
 func (webServerTask *WebServerTask) getErrorRecords(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	pipelineId := ps.ByName("pipelineId")
 	stageInstanceName := r.URL.Query().Get("stageInstanceName")
-	size := 10
-	if i, err := strconv.Atoi(r.URL.Query().Get("size")); err == nil {
-		size = i
+	errorRecords, err := webServerTask.manager.GetRunner(pipelineId).GetErrorRecords(
+		stageInstanceName,
+		getErrorQuery(r),
+	)
+	if err != nil {
+		serverErrorReq(w, fmt.Sprintf("Failed to get error records:  %s! ", err))
+		return
 	}
 
-	errorRecords, err := webServerTask.manager.GetRunner(pipelineId).GetErrorRecords(stageInstanceName, size)
-	w.Header().Set(ContentType, ApplicationJson)
-	if err == nil {
-		sdcRecords := make([]sdcrecord.SDCRecord, len(errorRecords))
-		for i, record := range errorRecords {
-			sdcRecord, err := sdcrecord.NewSdcRecordFromRecord(record)
-			if err != nil {
-				logrus.WithError(err).Error("failed to create sdc record")
-			} else {
-				sdcRecords[i] = *sdcRecord
+	if download, _ := strconv.ParseBool(r.URL.Query().Get("download")); download {
+		w.Header().Set(ContentType, ApplicationJson)
+		w.Header().Set(
+			ContentDisposition,
+			fmt.Sprintf("attachment; filename=\"%s-%s-errorRecords.json\"", pipelineId, stageInstanceName),
+		)
+		// SDC_JSON data format, one record per line
+		encoder := json.NewEncoder(w)
+		for _, errorRecord := range errorRecords {
+			if err := encoder.Encode(errorRecord); err != nil {
+				logrus.WithError(err).Error("failed to write error record")
+				return
 			}
 		}
-		encoder := json.NewEncoder(w)
-		encoder.SetIndent("", "\t")
-		encoder.Encode(sdcRecords)
-	} else {
-		serverErrorReq(w, fmt.Sprintf("Failed to get error records:  %s! ", err))
+		return
 	}
+
+	w.Header().Set(ContentType, ApplicationJson)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "\t")
+	encoder.Encode(errorRecords)
 }
 
 // Path - GET /rest/v1/pipeline/{pipelineId}/errorMessages
+// Supports the same stageInstanceName, size, offset, startTime and endTime query parameters as errorRecords
 func (webServerTask *WebServerTask) getErrorMessages(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	pipelineId := ps.ByName("pipelineId")
 	stageInstanceName := r.URL.Query().Get("stageInstanceName")
-	size := 10
-	if i, err := strconv.Atoi(r.URL.Query().Get("size")); err == nil {
-		size = i
-	}
-	errorMessages, err := webServerTask.manager.GetRunner(pipelineId).GetErrorMessages(stageInstanceName, size)
+	errorMessages, err := webServerTask.manager.GetRunner(pipelineId).GetErrorMessages(
+		stageInstanceName,
+		getErrorQuery(r),
+	)
 	w.Header().Set(ContentType, ApplicationJson)
 	if err == nil {
 		encoder := json.NewEncoder(w)
@@ -195,3 +215,67 @@ func (webServerTask *WebServerTask) getErrorMessages(w http.ResponseWriter, r *h
 		serverErrorReq(w, fmt.Sprintf("Failed to get error messages:  %s! ", err))
 	}
 }
+
+// Path - POST /rest/v1/pipeline/{pipelineId}/errorRecords/replay
+// Replays the retained error records of the stage selected by the errorRecords query parameters, the size
+// defaults to 10 records as well. Replayed records carry the sdc.replayed header attribute.
+func (webServerTask *WebServerTask) replayErrorRecords(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	pipelineId := ps.ByName("pipelineId")
+	stageInstanceName := r.URL.Query().Get("stageInstanceName")
+	replayedRecords, err := webServerTask.manager.GetRunner(pipelineId).ReplayErrorRecords(
+		stageInstanceName,
+		getErrorQuery(r),
+	)
+	w.Header().Set(ContentType, ApplicationJson)
+	if err == nil {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "\t")
+		encoder.Encode(map[string]interface{}{"replayedRecords": replayedRecords})
+	} else {
+		serverErrorReq(w, fmt.Sprintf("Failed to replay error records:  %s! ", err))
+	}
+}
+
+// Path - GET /rest/v1/pipeline/{pipelineId}/alerts
+func (webServerTask *WebServerTask) getAlerts(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	pipelineId := ps.ByName("pipelineId")
+	alerts, err := webServerTask.manager.GetRunner(pipelineId).GetAlerts()
+	w.Header().Set(ContentType, ApplicationJson)
+	if err == nil {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "\t")
+		encoder.Encode(alerts)
+	} else {
+		serverErrorReq(w, fmt.Sprintf("Failed to get alerts:  %s! ", err))
+	}
+}
+
+// Path - DELETE /rest/v1/pipeline/{pipelineId}/alerts?alertId={ruleId}
+func (webServerTask *WebServerTask) deleteAlert(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	pipelineId := ps.ByName("pipelineId")
+	deleted, err := webServerTask.manager.GetRunner(pipelineId).DeleteAlert(r.URL.Query().Get("alertId"))
+	w.Header().Set(ContentType, ApplicationJson)
+	if err == nil {
+		encoder := json.NewEncoder(w)
+		encoder.Encode(deleted)
+	} else {
+		serverErrorReq(w, fmt.Sprintf("Failed to delete alert:  %s! ", err))
+	}
+}
+
+func getErrorQuery(r *http.Request) store.ErrorQuery {
+	query := store.ErrorQuery{Size: 10}
+	if i, err := strconv.Atoi(r.URL.Query().Get("size")); err == nil {
+		query.Size = i
+	}
+	if i, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil {
+		query.Offset = i
+	}
+	if i, err := strconv.ParseInt(r.URL.Query().Get("startTime"), 10, 64); err == nil {
+		query.StartTime = i
+	}
+	if i, err := strconv.ParseInt(r.URL.Query().Get("endTime"), 10, 64); err == nil {
+		query.EndTime = i
+	}
+	return query
+}
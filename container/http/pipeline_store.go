@@ -51,7 +51,8 @@ func (webServerTask *WebServerTask) getPipeline(w http.ResponseWriter, r *http.R
 // Path - PUT /rest/v1/pipeline/:pipelineId?description=<desc>
 func (webServerTask *WebServerTask) createPipeline(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	w.Header().Set(ContentType, ApplicationJson)
-	pipelineTitle := ps.ByName("pipelineTitle")
+	// The segment holds the title, it is named like the pipeline id segment of the other PUT routes for httprouter
+	pipelineTitle := ps.ByName("pipelineId")
 	description := r.URL.Query().Get("description")
 	pipelineConfig, err := webServerTask.pipelineStoreTask.Create(pipelineTitle, pipelineTitle, description, false)
 	if err == nil {
@@ -92,3 +93,57 @@ func (webServerTask *WebServerTask) savePipeline(w http.ResponseWriter, r *http.
 		serverErrorReq(w, fmt.Sprintf("Failed to save pipeline:  %s! ", err))
 	}
 }
+
+// Path - DELETE /rest/v1/pipeline/:pipelineId
+// Deleting an active pipeline is refused, it must be stopped first
+func (webServerTask *WebServerTask) deletePipeline(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set(ContentType, ApplicationJson)
+	pipelineId := ps.ByName("pipelineId")
+	if err := webServerTask.manager.DeletePipeline(pipelineId); err != nil {
+		serverErrorReq(w, fmt.Sprintf("Failed to delete pipeline:  %s! ", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pipelineInfoUpdate is the body of the update pipeline info request, missing fields keep their value
+type pipelineInfoUpdate struct {
+	Title       *string `json:"title"`
+	Description *string `json:"description"`
+}
+
+// Path - POST /rest/v1/pipeline/:pipelineId/info
+// The body {"title": "<title>", "description": "<description>"} changes the title and description
+func (webServerTask *WebServerTask) updatePipelineInfo(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	w.Header().Set(ContentType, ApplicationJson)
+	pipelineId := ps.ByName("pipelineId")
+	defer r.Body.Close()
+
+	var update pipelineInfoUpdate
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		errorReq(w, http.StatusBadRequest, fmt.Sprintf("Failed to update pipeline info:  %s! ", err))
+		return
+	}
+
+	pipelineInfo, err := webServerTask.pipelineStoreTask.GetInfo(pipelineId)
+	if err == nil {
+		if update.Title != nil {
+			pipelineInfo.Title = *update.Title
+		}
+		if update.Description != nil {
+			pipelineInfo.Description = *update.Description
+		}
+		pipelineInfo, err = webServerTask.manager.UpdatePipelineInfo(
+			pipelineId,
+			pipelineInfo.Title,
+			pipelineInfo.Description,
+		)
+	}
+	if err == nil {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "\t")
+		encoder.Encode(pipelineInfo)
+	} else {
+		serverErrorReq(w, fmt.Sprintf("Failed to update pipeline info:  %s! ", err))
+	}
+}
@@ -27,6 +27,7 @@ type PreviewInfo struct {
 }
 
 // Path - POST /rest/v1/pipeline/{pipelineId}/preview
+// The preview runs in the background, the status is polled with the returned previewerId
 func (webServerTask *WebServerTask) preview(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	w.Header().Set(ContentType, ApplicationJson)
 
@@ -120,6 +121,7 @@ func (webServerTask *WebServerTask) getPreviewData(w http.ResponseWriter, r *htt
 	previewer, err := webServerTask.manager.GetPreviewer(previewerId)
 	if err != nil {
 		serverErrorReq(w, err.Error())
+		return
 	}
 
 	encoder := json.NewEncoder(w)
@@ -135,11 +137,13 @@ func (webServerTask *WebServerTask) stopPreview(w http.ResponseWriter, r *http.R
 	previewer, err := webServerTask.manager.GetPreviewer(previewerId)
 	if err != nil {
 		serverErrorReq(w, err.Error())
+		return
 	}
 
 	err = previewer.Stop()
 	if err != nil {
 		serverErrorReq(w, err.Error())
+		return
 	}
 
 	encoder := json.NewEncoder(w)
@@ -0,0 +1,107 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	"net/http"
+	"strconv"
+)
+
+// Path - PUT /rest/v1/pipeline/{pipelineId}/snapshot/{snapshotName}
+// Query parameters snapshotLabel, batches (default 1) and batchSize select what to capture, like in Data Collector
+func (webServerTask *WebServerTask) captureSnapshot(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	pipelineId := ps.ByName("pipelineId")
+	batches := 1
+	if i, err := strconv.Atoi(r.URL.Query().Get("batches")); err == nil {
+		batches = i
+	}
+	batchSize := 0
+	if i, err := strconv.Atoi(r.URL.Query().Get("batchSize")); err == nil {
+		batchSize = i
+	}
+	snapshotInfo, err := webServerTask.manager.GetRunner(pipelineId).CaptureSnapshot(
+		ps.ByName("snapshotName"),
+		r.URL.Query().Get("snapshotLabel"),
+		getUser(r).Name,
+		batches,
+		batchSize,
+	)
+	w.Header().Set(ContentType, ApplicationJson)
+	if err == nil {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "\t")
+		encoder.Encode(snapshotInfo)
+	} else {
+		serverErrorReq(w, fmt.Sprintf("Failed to capture snapshot:  %s! ", err))
+	}
+}
+
+// Path - GET /rest/v1/pipeline/{pipelineId}/snapshot/{snapshotName}
+// Returns the captured batches, download=true returns them as a file
+func (webServerTask *WebServerTask) getSnapshot(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	pipelineId := ps.ByName("pipelineId")
+	snapshotName := ps.ByName("snapshotName")
+	snapshotData, err := webServerTask.manager.GetRunner(pipelineId).GetSnapshot(snapshotName)
+	if err != nil {
+		serverErrorReq(w, fmt.Sprintf("Failed to get snapshot:  %s! ", err))
+		return
+	}
+
+	w.Header().Set(ContentType, ApplicationJson)
+	if download, _ := strconv.ParseBool(r.URL.Query().Get("download")); download {
+		w.Header().Set(
+			ContentDisposition,
+			fmt.Sprintf("attachment; filename=\"%s-%s-snapshot.json\"", pipelineId, snapshotName),
+		)
+	}
+	w.Write(snapshotData)
+}
+
+// Path - GET /rest/v1/pipeline/{pipelineId}/snapshot/{snapshotName}/status
+func (webServerTask *WebServerTask) getSnapshotStatus(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	pipelineId := ps.ByName("pipelineId")
+	snapshotInfo, err := webServerTask.manager.GetRunner(pipelineId).GetSnapshotInfo(ps.ByName("snapshotName"))
+	w.Header().Set(ContentType, ApplicationJson)
+	if err == nil {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "\t")
+		encoder.Encode(snapshotInfo)
+	} else {
+		serverErrorReq(w, fmt.Sprintf("Failed to get snapshot status:  %s! ", err))
+	}
+}
+
+// Path - GET /rest/v1/pipeline/{pipelineId}/snapshots
+func (webServerTask *WebServerTask) getSnapshotsInfo(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	pipelineId := ps.ByName("pipelineId")
+	snapshotsInfo, err := webServerTask.manager.GetRunner(pipelineId).GetSnapshotsInfo()
+	w.Header().Set(ContentType, ApplicationJson)
+	if err == nil {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "\t")
+		encoder.Encode(snapshotsInfo)
+	} else {
+		serverErrorReq(w, fmt.Sprintf("Failed to get snapshots:  %s! ", err))
+	}
+}
+
+// Path - DELETE /rest/v1/pipeline/{pipelineId}/snapshot/{snapshotName}
+func (webServerTask *WebServerTask) deleteSnapshot(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	pipelineId := ps.ByName("pipelineId")
+	if err := webServerTask.manager.GetRunner(pipelineId).DeleteSnapshot(ps.ByName("snapshotName")); err != nil {
+		serverErrorReq(w, fmt.Sprintf("Failed to delete snapshot:  %s! ", err))
+	}
+}
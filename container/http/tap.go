@@ -0,0 +1,96 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+	"github.com/streamsets/datacollector-edge/container/recordio/sdcrecord"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	TextEventStream      = "text/event-stream"
+	tapKeepAliveInterval = 15 * time.Second
+)
+
+// Path - GET /rest/v1/pipeline/{pipelineId}/tap?lane={lane}&sample={percentage}
+// Streams the records of the lane as Server-Sent Events, every record is sent as SDC_JSON in a "record" event.
+// The sample query parameter is the percentage of records streamed, 100 by default. Records are dropped when
+// the client is too slow, the total number of dropped records is sent in "dropped" events.
+func (webServerTask *WebServerTask) tapLane(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	pipelineId := ps.ByName("pipelineId")
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		serverErrorReq(w, "Streaming is not supported")
+		return
+	}
+
+	samplingPercentage := float64(100)
+	if sample, err := strconv.ParseFloat(r.URL.Query().Get("sample"), 64); err == nil {
+		samplingPercentage = sample
+	}
+	tap, err := webServerTask.manager.GetRunner(pipelineId).TapLane(r.URL.Query().Get("lane"), samplingPercentage)
+	if err != nil {
+		serverErrorReq(w, fmt.Sprintf("Failed to tap lane:  %s! ", err))
+		return
+	}
+	defer tap.Close()
+
+	w.Header().Set(ContentType, TextEventStream)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(tapKeepAliveInterval)
+	defer ticker.Stop()
+	var droppedRecords int64
+	for {
+		select {
+		case record, ok := <-tap.Records():
+			if !ok {
+				return
+			}
+			sdcRecord, err := sdcrecord.NewSdcRecordFromRecord(record)
+			if err != nil {
+				log.WithError(err).WithField("lane", tap.GetLane()).Warn("Failed to convert tapped record")
+				continue
+			}
+			recordJson, err := json.Marshal(sdcRecord)
+			if err != nil {
+				log.WithError(err).WithField("lane", tap.GetLane()).Warn("Failed to convert tapped record")
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: record\ndata: %s\n\n", recordJson); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if dropped := tap.GetDroppedRecords(); dropped != droppedRecords {
+				droppedRecords = dropped
+				_, err = fmt.Fprintf(w, "event: dropped\ndata: {\"droppedRecords\": %d}\n\n", droppedRecords)
+			} else {
+				_, err = fmt.Fprint(w, ": keep-alive\n\n")
+			}
+			if err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
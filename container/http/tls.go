@@ -0,0 +1,84 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/pkcs12"
+	"io/ioutil"
+)
+
+// newTLSConfig returns the TLS config of the web server with the configured server certificate and, if a
+// client CA file is configured, the verification of client certificates
+func newTLSConfig(config TLSConfig) (*tls.Config, error) {
+	var certificate tls.Certificate
+	var err error
+	switch {
+	case len(config.KeyStoreFile) > 0:
+		certificate, err = loadKeyStore(config.KeyStoreFile, config.KeyStorePassword)
+	case len(config.CertFile) > 0 && len(config.KeyFile) > 0:
+		certificate, err = tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	default:
+		err = errors.New("TLS requires either cert-file and key-file or keystore-file")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{certificate},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if len(config.ClientCAFile) > 0 {
+		caData, err := ioutil.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("no PEM certificates found in client CA file '%s'", config.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if config.RequireClientCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else if config.RequireClientCert {
+		return nil, errors.New("require-client-cert requires client-ca-file")
+	}
+
+	return tlsConfig, nil
+}
+
+// loadKeyStore returns the private key and certificate chain of a PKCS12 keystore, the server certificate
+// must be the first certificate of the keystore
+func loadKeyStore(keyStoreFile string, password string) (tls.Certificate, error) {
+	data, err := ioutil.ReadFile(keyStoreFile)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	pemBlocks, err := pkcs12.ToPEM(data, password)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to decode keystore '%s': %s", keyStoreFile, err)
+	}
+	var pemData []byte
+	for _, pemBlock := range pemBlocks {
+		pemData = append(pemData, pem.EncodeToMemory(pemBlock)...)
+	}
+	return tls.X509KeyPair(pemData, pemData)
+}
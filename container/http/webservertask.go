@@ -14,6 +14,7 @@ package http
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"github.com/julienschmidt/httprouter"
@@ -29,8 +30,9 @@ import (
 )
 
 const (
-	ContentType     = "Content-Type"
-	ApplicationJson = "application/json"
+	ContentType        = "Content-Type"
+	ApplicationJson    = "application/json"
+	ContentDisposition = "Content-Disposition"
 )
 
 type WebServerTask struct {
@@ -40,6 +42,8 @@ type WebServerTask struct {
 	pipelineStoreTask store.PipelineStoreTask
 	httpServer        *http.Server
 	processManager    *process.Manager
+	authenticators    []Authenticator
+	basicAuthEnabled  bool
 }
 
 func (webServerTask *WebServerTask) Init() error {
@@ -49,50 +53,89 @@ func (webServerTask *WebServerTask) Init() error {
 		return nil
 	}
 
-	fmt.Println("Running on URI : http://localhost" + webServerTask.config.BindAddress)
-	log.Info("Running on URI : http://localhost" + webServerTask.config.BindAddress)
+	var tlsConfig *tls.Config
+	scheme := "http"
+	if webServerTask.config.TLS.Enabled {
+		var err error
+		if tlsConfig, err = newTLSConfig(webServerTask.config.TLS); err != nil {
+			return err
+		}
+		scheme = "https"
+	}
+
+	authenticators, err := newAuthenticators(webServerTask.config.Auth)
+	if err != nil {
+		return err
+	}
+	webServerTask.authenticators = authenticators
+	webServerTask.basicAuthEnabled = webServerTask.config.Auth.Enabled && len(webServerTask.config.Auth.UsersFile) > 0
+	if len(authenticators) == 0 {
+		log.Warn("REST API authentication is disabled, every request is served with the admin role")
+	}
+
+	fmt.Println("Running on URI : " + scheme + "://localhost" + webServerTask.config.BindAddress)
+	log.Info("Running on URI : " + scheme + "://localhost" + webServerTask.config.BindAddress)
 
 	router := httprouter.New()
-	router.GET("/", webServerTask.homeHandler)
+	router.GET("/", webServerTask.authorize(RoleReadOnly, webServerTask.homeHandler))
 
 	// Manager APIs
-	router.POST("/rest/v1/pipeline/:pipelineId/start", webServerTask.startHandler)
-	router.POST("/rest/v1/pipeline/:pipelineId/stop", webServerTask.stopHandler)
-	router.POST("/rest/v1/pipeline/:pipelineId/resetOffset", webServerTask.resetOffsetHandler)
-	router.POST("/rest/v1/pipeline/:pipelineId/committedOffsets", webServerTask.updateOffsetHandler)
-
-	router.GET("/rest/v1/pipeline/:pipelineId/status", webServerTask.statusHandler)
-	router.GET("/rest/v1/pipeline/:pipelineId/history", webServerTask.historyHandler)
-	router.GET("/rest/v1/pipeline/:pipelineId/metrics", webServerTask.metricsHandler)
-	router.GET("/rest/v1/pipeline/:pipelineId/committedOffsets", webServerTask.getOffsetHandler)
-	router.GET("/rest/v1/pipeline/:pipelineId/errorRecords", webServerTask.getErrorRecords)
-	router.GET("/rest/v1/pipeline/:pipelineId/errorMessages", webServerTask.getErrorMessages)
+	router.POST("/rest/v1/pipeline/:pipelineId/start", webServerTask.authorize(RoleAdmin, webServerTask.startHandler))
+	router.POST("/rest/v1/pipeline/:pipelineId/stop", webServerTask.authorize(RoleAdmin, webServerTask.stopHandler))
+	router.POST("/rest/v1/pipeline/:pipelineId/resetOffset", webServerTask.authorize(RoleAdmin, webServerTask.resetOffsetHandler))
+	router.POST("/rest/v1/pipeline/:pipelineId/committedOffsets", webServerTask.authorize(RoleAdmin, webServerTask.updateOffsetHandler))
+
+	router.GET("/rest/v1/pipeline/:pipelineId/status", webServerTask.authorize(RoleReadOnly, webServerTask.statusHandler))
+	router.GET("/rest/v1/pipeline/:pipelineId/history", webServerTask.authorize(RoleReadOnly, webServerTask.historyHandler))
+	router.DELETE("/rest/v1/pipeline/:pipelineId/history", webServerTask.authorize(RoleAdmin, webServerTask.deleteHistoryHandler))
+	router.GET("/rest/v1/pipeline/:pipelineId/metrics", webServerTask.authorize(RoleReadOnly, webServerTask.metricsHandler))
+	router.GET("/rest/v1/pipeline/:pipelineId/committedOffsets", webServerTask.authorize(RoleReadOnly, webServerTask.getOffsetHandler))
+	router.GET("/rest/v1/pipeline/:pipelineId/errorRecords", webServerTask.authorize(RoleReadOnly, webServerTask.getErrorRecords))
+	router.GET("/rest/v1/pipeline/:pipelineId/errorMessages", webServerTask.authorize(RoleReadOnly, webServerTask.getErrorMessages))
+	router.POST("/rest/v1/pipeline/:pipelineId/errorRecords/replay", webServerTask.authorize(RoleAdmin, webServerTask.replayErrorRecords))
+	router.GET("/rest/v1/pipeline/:pipelineId/alerts", webServerTask.authorize(RoleReadOnly, webServerTask.getAlerts))
+	router.DELETE("/rest/v1/pipeline/:pipelineId/alerts", webServerTask.authorize(RoleAdmin, webServerTask.deleteAlert))
+	router.PUT("/rest/v1/pipeline/:pipelineId/snapshot/:snapshotName", webServerTask.authorize(RoleAdmin, webServerTask.captureSnapshot))
+	router.GET("/rest/v1/pipeline/:pipelineId/snapshot/:snapshotName", webServerTask.authorize(RoleReadOnly, webServerTask.getSnapshot))
+	router.GET("/rest/v1/pipeline/:pipelineId/snapshot/:snapshotName/status", webServerTask.authorize(RoleReadOnly, webServerTask.getSnapshotStatus))
+	router.DELETE("/rest/v1/pipeline/:pipelineId/snapshot/:snapshotName", webServerTask.authorize(RoleAdmin, webServerTask.deleteSnapshot))
+	router.GET("/rest/v1/pipeline/:pipelineId/snapshots", webServerTask.authorize(RoleReadOnly, webServerTask.getSnapshotsInfo))
+	router.GET("/rest/v1/pipeline/:pipelineId/tap", webServerTask.authorize(RoleReadOnly, webServerTask.tapLane))
 
 	// Pipeline Store APIs
-	router.GET("/rest/v1/pipelines", webServerTask.getPipelines)
-	router.GET("/rest/v1/pipeline/:pipelineId", webServerTask.getPipeline)
-	router.PUT("/rest/v1/pipeline/:pipelineTitle", webServerTask.createPipeline)
-	router.POST("/rest/v1/pipeline/:pipelineId", webServerTask.savePipeline)
+	router.GET("/rest/v1/pipelines", webServerTask.authorize(RoleReadOnly, webServerTask.getPipelines))
+	router.GET("/rest/v1/pipeline/:pipelineId", webServerTask.authorize(RoleReadOnly, webServerTask.getPipeline))
+	router.PUT("/rest/v1/pipeline/:pipelineId", webServerTask.authorize(RoleAdmin, webServerTask.createPipeline))
+	router.POST("/rest/v1/pipeline/:pipelineId", webServerTask.authorize(RoleAdmin, webServerTask.savePipeline))
+	router.POST("/rest/v1/pipeline/:pipelineId/info", webServerTask.authorize(RoleAdmin, webServerTask.updatePipelineInfo))
+	router.DELETE("/rest/v1/pipeline/:pipelineId", webServerTask.authorize(RoleAdmin, webServerTask.deletePipeline))
 
 	// Pipeline Preview APIs
-	router.GET("/rest/v1/pipeline/:pipelineId/validate", webServerTask.validateConfigs)
-	router.POST("/rest/v1/pipeline/:pipelineId/preview", webServerTask.preview)
-	router.GET("/rest/v1/pipeline/:pipelineId/preview/:previewerId/status", webServerTask.getPreviewStatus)
-	router.GET("/rest/v1/pipeline/:pipelineId/preview/:previewerId", webServerTask.getPreviewData)
-
-	// Register pprof handlers
-	router.HandlerFunc("GET", "/debug/pprof/", pprof.Index)
-	router.Handler("GET", "/debug/pprof/heap", pprof.Handler("heap"))
-	router.Handler("GET", "/debug/pprof/goroutine", pprof.Handler("goroutine"))
-	router.Handler("GET", "/debug/pprof/block", pprof.Handler("block"))
-	router.HandlerFunc("GET", "/debug/pprof/cmdline", pprof.Cmdline)
-	router.HandlerFunc("GET", "/debug/pprof/profile", pprof.Profile)
-	router.HandlerFunc("GET", "/debug/pprof/symbol", pprof.Symbol)
-	router.HandlerFunc("GET", "/debug/pprof/trace", pprof.Trace)
-
-	router.GET("/rest/v1/processMetrics", webServerTask.processMetricsHandler)
-
-	webServerTask.httpServer = &http.Server{Addr: webServerTask.config.BindAddress, Handler: router}
+	router.GET("/rest/v1/pipeline/:pipelineId/validate", webServerTask.authorize(RoleAdmin, webServerTask.validateConfigs))
+	router.POST("/rest/v1/pipeline/:pipelineId/preview", webServerTask.authorize(RoleAdmin, webServerTask.preview))
+	router.GET("/rest/v1/pipeline/:pipelineId/preview/:previewerId/status", webServerTask.authorize(RoleReadOnly, webServerTask.getPreviewStatus))
+	router.GET("/rest/v1/pipeline/:pipelineId/preview/:previewerId", webServerTask.authorize(RoleReadOnly, webServerTask.getPreviewData))
+	router.DELETE("/rest/v1/pipeline/:pipelineId/preview/:previewerId", webServerTask.authorize(RoleAdmin, webServerTask.stopPreview))
+
+	// Register pprof handlers, profiling data is available to admins only
+	if webServerTask.config.EnablePprof {
+		router.GET("/debug/pprof/", webServerTask.authorizeHandler(RoleAdmin, http.HandlerFunc(pprof.Index)))
+		router.GET("/debug/pprof/heap", webServerTask.authorizeHandler(RoleAdmin, pprof.Handler("heap")))
+		router.GET("/debug/pprof/goroutine", webServerTask.authorizeHandler(RoleAdmin, pprof.Handler("goroutine")))
+		router.GET("/debug/pprof/block", webServerTask.authorizeHandler(RoleAdmin, pprof.Handler("block")))
+		router.GET("/debug/pprof/cmdline", webServerTask.authorizeHandler(RoleAdmin, http.HandlerFunc(pprof.Cmdline)))
+		router.GET("/debug/pprof/profile", webServerTask.authorizeHandler(RoleAdmin, http.HandlerFunc(pprof.Profile)))
+		router.GET("/debug/pprof/symbol", webServerTask.authorizeHandler(RoleAdmin, http.HandlerFunc(pprof.Symbol)))
+		router.GET("/debug/pprof/trace", webServerTask.authorizeHandler(RoleAdmin, http.HandlerFunc(pprof.Trace)))
+	}
+
+	router.GET("/rest/v1/processMetrics", webServerTask.authorize(RoleReadOnly, webServerTask.processMetricsHandler))
+
+	webServerTask.httpServer = &http.Server{
+		Addr:      webServerTask.config.BindAddress,
+		Handler:   router,
+		TLSConfig: tlsConfig,
+	}
 	return nil
 }
 
@@ -103,7 +146,10 @@ func (webServerTask *WebServerTask) homeHandler(w http.ResponseWriter, r *http.R
 }
 
 func (webServerTask *WebServerTask) Run() {
-	if webServerTask.config.Enabled {
+	if webServerTask.config.Enabled && webServerTask.config.TLS.Enabled {
+		// The certificates are loaded in the TLS config of the server
+		fmt.Println(webServerTask.httpServer.ListenAndServeTLS("", ""))
+	} else if webServerTask.config.Enabled {
 		fmt.Println(webServerTask.httpServer.ListenAndServe())
 	} else {
 		// Block forever to run Edge process in background
@@ -129,8 +175,12 @@ func (webServerTask *WebServerTask) processMetricsHandler(w http.ResponseWriter,
 }
 
 func serverErrorReq(w http.ResponseWriter, err string) {
+	errorReq(w, http.StatusInternalServerError, err)
+}
+
+func errorReq(w http.ResponseWriter, statusCode int, err string) {
 	w.Header().Set(ContentType, ApplicationJson)
-	w.WriteHeader(http.StatusInternalServerError)
+	w.WriteHeader(statusCode)
 	fmt.Fprintf(w, `{"result":"", "error":%q}`, err)
 }
 
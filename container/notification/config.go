@@ -0,0 +1,44 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package notification
+
+const (
+	DefaultSmtpPort          = 25
+	DefaultSmtpFrom          = "sdce@localhost"
+	DefaultWebhookRetries    = 3
+	DefaultWebhookRetryDelay = 1000
+	DefaultWebhookTimeout    = 10000
+)
+
+type Config struct {
+	SmtpHost          string `toml:"smtp-host"`
+	SmtpPort          int    `toml:"smtp-port"`
+	SmtpUsername      string `toml:"smtp-username"`
+	SmtpPassword      string `toml:"smtp-password"`
+	SmtpFrom          string `toml:"smtp-from"`
+	SmtpUseTls        bool   `toml:"smtp-use-tls"`
+	WebhookRetries    int    `toml:"webhook-retries"`
+	WebhookRetryDelay int    `toml:"webhook-retry-delay"`
+	WebhookTimeout    int    `toml:"webhook-timeout"`
+}
+
+// NewConfig returns a new Config with default settings.
+func NewConfig() Config {
+	return Config{
+		SmtpPort:          DefaultSmtpPort,
+		SmtpFrom:          DefaultSmtpFrom,
+		WebhookRetries:    DefaultWebhookRetries,
+		WebhookRetryDelay: DefaultWebhookRetryDelay,
+		WebhookTimeout:    DefaultWebhookTimeout,
+	}
+}
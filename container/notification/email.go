@@ -0,0 +1,106 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package notification
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+)
+
+const (
+	emailSubject = "StreamSets Data Collector Edge Alert - " + PipelineTitle + " - " + PipelineState
+	emailBody    = "Pipeline " + PipelineTitle + " transitioned to state " + PipelineState + " at " + Time + ".\r\n" +
+		PipelineStateMessage + "\r\n\r\n" +
+		"Pipeline URL: " + PipelineUrl + "\r\n"
+)
+
+type emailSender struct {
+	config Config
+}
+
+func (s *emailSender) send(emailIds []string, notification *stateNotification) error {
+	if len(s.config.SmtpHost) == 0 {
+		return errors.New("SMTP host is not configured in the [notification] section of edge.conf")
+	}
+
+	address := net.JoinHostPort(s.config.SmtpHost, strconv.Itoa(s.config.SmtpPort))
+	var auth smtp.Auth
+	if len(s.config.SmtpUsername) > 0 {
+		auth = smtp.PlainAuth("", s.config.SmtpUsername, s.config.SmtpPassword, s.config.SmtpHost)
+	}
+	message := s.buildMessage(emailIds, notification)
+
+	if !s.config.SmtpUseTls {
+		// SendMail upgrades the connection with STARTTLS when the server supports it
+		return smtp.SendMail(address, auth, s.config.SmtpFrom, emailIds, message)
+	}
+
+	conn, err := tls.Dial("tcp", address, &tls.Config{ServerName: s.config.SmtpHost})
+	if err != nil {
+		return err
+	}
+	client, err := smtp.NewClient(conn, s.config.SmtpHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if auth != nil {
+		if err = client.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err = client.Mail(s.config.SmtpFrom); err != nil {
+		return err
+	}
+	for _, emailId := range emailIds {
+		if err = client.Rcpt(emailId); err != nil {
+			return err
+		}
+	}
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(message); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+func (s *emailSender) buildMessage(emailIds []string, notification *stateNotification) []byte {
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", s.config.SmtpFrom)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(emailIds, ", "))
+	// The pipeline title can contain any characters, the subject is encoded so it cannot inject headers
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", notification.resolve(emailSubject)))
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n\r\n")
+	message.WriteString(notification.resolve(emailBody))
+	return message.Bytes()
+}
+
+func newEmailSender(config Config) *emailSender {
+	return &emailSender{config: config}
+}
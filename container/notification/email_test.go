@@ -0,0 +1,60 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package notification
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEmailSender_BuildMessage(t *testing.T) {
+	emailSender := newEmailSender(NewConfig())
+	message := string(emailSender.buildMessage([]string{"a@example.com", "b@example.com"}, getTestNotification()))
+
+	expectedLines := []string{
+		"From: " + DefaultSmtpFrom + "\r\n",
+		"To: a@example.com, b@example.com\r\n",
+		"Subject: StreamSets Data Collector Edge Alert - Pipeline 1 - RUN_ERROR\r\n",
+		"Pipeline failed\r\n",
+		"Pipeline URL: http://localhost:18633/collector/pipeline/pipeline1\r\n",
+	}
+	for _, expectedLine := range expectedLines {
+		if !strings.Contains(message, expectedLine) {
+			t.Errorf("Expected message to contain %q, but got: %s", expectedLine, message)
+		}
+	}
+}
+
+func TestEmailSender_BuildMessageHeaderInjection(t *testing.T) {
+	emailSender := newEmailSender(NewConfig())
+	notification := getTestNotification()
+	notification.pipelineTitle = "Pipeline 1\r\nBcc: attacker@example.com"
+	message := string(emailSender.buildMessage([]string{"a@example.com"}, notification))
+
+	headers := message[:strings.Index(message, "\r\n\r\n")]
+	for _, header := range strings.Split(headers, "\r\n") {
+		if strings.HasPrefix(header, "Bcc:") {
+			t.Errorf("Expected the pipeline title not to inject headers, but got: %s", headers)
+		}
+	}
+	if !strings.Contains(headers, "Subject: =?utf-8?q?") {
+		t.Errorf("Expected an encoded subject, but got: %s", headers)
+	}
+}
+
+func TestEmailSender_SendWithoutSmtpHost(t *testing.T) {
+	emailSender := newEmailSender(NewConfig())
+	if err := emailSender.send([]string{"a@example.com"}, getTestNotification()); err == nil {
+		t.Error("Expected an error when the SMTP host is not configured")
+	}
+}
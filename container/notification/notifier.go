@@ -0,0 +1,151 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package notification
+
+import (
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"github.com/streamsets/datacollector-edge/container/creation"
+	"github.com/streamsets/datacollector-edge/container/store"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	PipelineTitle        = "{{PIPELINE_TITLE}}"
+	PipelineName         = "{{PIPELINE_NAME}}"
+	PipelineUrl          = "{{PIPELINE_URL}}"
+	PipelineState        = "{{PIPELINE_STATE}}"
+	PipelineStateMessage = "{{PIPELINE_STATE_MESSAGE}}"
+	Time                 = "{{TIME}}"
+	pipelineUrlPath      = "/collector/pipeline/"
+)
+
+// Notifier sends webhook and email notifications when a pipeline transitions to one of the states
+// configured in the pipeline's notifyOnStates configuration.
+type Notifier struct {
+	config            Config
+	runtimeInfo       *common.RuntimeInfo
+	pipelineStoreTask store.PipelineStoreTask
+	lastStatus        map[string]string
+	lastStatusMutex   sync.Mutex
+	webhookSender     *webhookSender
+	emailSender       *emailSender
+}
+
+// stateNotification holds the values used to resolve the webhook payload and email placeholders
+type stateNotification struct {
+	pipelineId    string
+	pipelineTitle string
+	pipelineUrl   string
+	state         common.PipelineState
+}
+
+func (n *stateNotification) resolve(template string) string {
+	return n.resolveEscaped(template, func(value string) string {
+		return value
+	})
+}
+
+// resolveEscaped replaces the placeholders with the values escaped for the format of the template
+func (n *stateNotification) resolveEscaped(template string, escape func(value string) string) string {
+	return strings.NewReplacer(
+		PipelineTitle, escape(n.pipelineTitle),
+		PipelineName, escape(n.pipelineId),
+		PipelineUrl, escape(n.pipelineUrl),
+		PipelineState, escape(n.state.Status),
+		PipelineStateMessage, escape(n.state.Message),
+		Time, escape(time.Unix(0, n.state.TimeStamp*int64(time.Millisecond)).Format(time.RFC3339)),
+	).Replace(template)
+}
+
+// OnStateChange is registered as execution store state listener, notifications are sent asynchronously
+// so slow webhooks or mail servers don't block the pipeline runner.
+func (n *Notifier) OnStateChange(pipelineId string, pipelineState common.PipelineState) {
+	n.lastStatusMutex.Lock()
+	previousStatus, ok := n.lastStatus[pipelineId]
+	n.lastStatus[pipelineId] = pipelineState.Status
+	n.lastStatusMutex.Unlock()
+
+	if ok && previousStatus == pipelineState.Status {
+		return
+	}
+
+	go n.notify(pipelineId, pipelineState)
+}
+
+func (n *Notifier) notify(pipelineId string, pipelineState common.PipelineState) {
+	pipelineConfig, err := n.pipelineStoreTask.LoadPipelineConfig(pipelineId)
+	if err != nil {
+		log.WithError(err).WithField("pipelineId", pipelineId).Warn("Failed to load pipeline for notifications")
+		return
+	}
+
+	pipelineConfigBean := creation.NewPipelineConfigBean(pipelineConfig)
+	if !containsState(pipelineConfigBean.NotifyOnStates, pipelineState.Status) {
+		return
+	}
+
+	notification := &stateNotification{
+		pipelineId:    pipelineId,
+		pipelineTitle: pipelineConfig.Title,
+		state:         pipelineState,
+	}
+	if n.runtimeInfo != nil {
+		notification.pipelineUrl = n.runtimeInfo.HttpUrl + pipelineUrlPath + pipelineId
+	}
+	if len(notification.pipelineTitle) == 0 {
+		notification.pipelineTitle = pipelineId
+	}
+
+	for _, webhookConfig := range pipelineConfigBean.WebhookConfigs {
+		if webhookConfigMap, ok := webhookConfig.(map[string]interface{}); ok {
+			if err := n.webhookSender.send(newWebhook(webhookConfigMap), notification); err != nil {
+				log.WithError(err).WithField("pipelineId", pipelineId).Error("Failed to send webhook notification")
+			}
+		}
+	}
+
+	emailIds := cast.ToStringSlice(pipelineConfigBean.EmailIDs)
+	if len(emailIds) > 0 {
+		if err := n.emailSender.send(emailIds, notification); err != nil {
+			log.WithError(err).WithField("pipelineId", pipelineId).Error("Failed to send email notification")
+		}
+	}
+}
+
+func containsState(notifyOnStates []interface{}, status string) bool {
+	for _, state := range notifyOnStates {
+		if cast.ToString(state) == status {
+			return true
+		}
+	}
+	return false
+}
+
+func NewNotifier(
+	config Config,
+	runtimeInfo *common.RuntimeInfo,
+	pipelineStoreTask store.PipelineStoreTask,
+) *Notifier {
+	return &Notifier{
+		config:            config,
+		runtimeInfo:       runtimeInfo,
+		pipelineStoreTask: pipelineStoreTask,
+		lastStatus:        make(map[string]string),
+		webhookSender:     newWebhookSender(config),
+		emailSender:       newEmailSender(config),
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package notification
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cast"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	AuthTypeNone       = "NONE"
+	AuthTypeBasic      = "BASIC"
+	AuthTypeDigest     = "DIGEST"
+	AuthTypeUniversal  = "UNIVERSAL"
+	DefaultContentType = "application/json"
+	DefaultPayload     = `{
+  "text" : "Pipeline '{{PIPELINE_TITLE}}' state changed to {{PIPELINE_STATE}} at {{TIME}}. \n <{{PIPELINE_URL}}|Click here for details!>"
+}`
+	webhookFailedError = "NOTIFICATION_0001 - Webhook '%s' failed with status: %s"
+	digestAuthError    = "NOTIFICATION_0002 - Webhook '%s' uses DIGEST authentication which is not supported"
+)
+
+type webhook struct {
+	webhookUrl  string
+	headers     map[string]string
+	httpMethod  string
+	payload     string
+	contentType string
+	authType    string
+	username    string
+	password    string
+}
+
+// newWebhook reads a webhook configuration in the Data Collector webhookConfigs format
+func newWebhook(webhookConfig map[string]interface{}) *webhook {
+	w := &webhook{
+		webhookUrl:  cast.ToString(webhookConfig["webhookUrl"]),
+		headers:     make(map[string]string),
+		httpMethod:  strings.ToUpper(cast.ToString(webhookConfig["httpMethod"])),
+		payload:     cast.ToString(webhookConfig["payload"]),
+		contentType: cast.ToString(webhookConfig["contentType"]),
+		authType:    strings.ToUpper(cast.ToString(webhookConfig["authType"])),
+		username:    cast.ToString(webhookConfig["username"]),
+		password:    cast.ToString(webhookConfig["password"]),
+	}
+
+	switch headers := webhookConfig["headers"].(type) {
+	case map[string]interface{}:
+		for key, value := range headers {
+			w.headers[key] = cast.ToString(value)
+		}
+	case []interface{}:
+		for _, header := range headers {
+			if headerMap, ok := header.(map[string]interface{}); ok {
+				w.headers[cast.ToString(headerMap["key"])] = cast.ToString(headerMap["value"])
+			}
+		}
+	}
+
+	if len(w.httpMethod) == 0 {
+		w.httpMethod = http.MethodPost
+	}
+	if len(w.payload) == 0 {
+		w.payload = DefaultPayload
+	}
+	if len(w.contentType) == 0 {
+		w.contentType = DefaultContentType
+	}
+	return w
+}
+
+// ValidateWebhookConfigs returns an error for webhook configurations which cannot be sent, pipelines using
+// them fail to start instead of sending notifications without the configured authentication
+func ValidateWebhookConfigs(webhookConfigs []interface{}) error {
+	for _, webhookConfig := range webhookConfigs {
+		if webhookConfigMap, ok := webhookConfig.(map[string]interface{}); ok {
+			if w := newWebhook(webhookConfigMap); w.authType == AuthTypeDigest {
+				return fmt.Errorf(digestAuthError, w.webhookUrl)
+			}
+		}
+	}
+	return nil
+}
+
+type webhookSender struct {
+	client     *http.Client
+	retries    int
+	retryDelay time.Duration
+}
+
+// send posts the resolved payload, failed requests are retried with exponential backoff on
+// connection errors, 5xx and 429 responses
+func (s *webhookSender) send(w *webhook, notification *stateNotification) error {
+	if len(w.webhookUrl) == 0 {
+		return errors.New("webhook URL is empty")
+	}
+
+	webhookUrl := notification.resolveEscaped(w.webhookUrl, url.QueryEscape)
+	var payload string
+	if isJsonContentType(w.contentType) {
+		// Placeholders of JSON payloads are inside string literals, quotes and newlines of the values are escaped
+		payload = notification.resolveEscaped(w.payload, escapeJsonString)
+	} else {
+		payload = notification.resolve(w.payload)
+	}
+	retryDelay := s.retryDelay
+
+	var err error
+	for attempt := 0; attempt <= s.retries; attempt++ {
+		if attempt > 0 {
+			log.WithError(err).WithField("attempt", attempt).Warn("Retrying webhook")
+			time.Sleep(retryDelay)
+			retryDelay *= 2
+		}
+
+		var retry bool
+		retry, err = s.sendRequest(w, webhookUrl, payload)
+		if err == nil || !retry {
+			return err
+		}
+	}
+	return err
+}
+
+func (s *webhookSender) sendRequest(w *webhook, webhookUrl string, payload string) (bool, error) {
+	if w.authType == AuthTypeDigest {
+		return false, fmt.Errorf(digestAuthError, webhookUrl)
+	}
+
+	var body *bytes.Buffer
+	if w.httpMethod == http.MethodGet || w.httpMethod == http.MethodHead || w.httpMethod == http.MethodDelete {
+		body = &bytes.Buffer{}
+	} else {
+		body = bytes.NewBufferString(payload)
+	}
+
+	req, err := http.NewRequest(w.httpMethod, webhookUrl, body)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", w.contentType)
+	for key, value := range w.headers {
+		req.Header.Set(key, value)
+	}
+
+	if w.authType == AuthTypeBasic || w.authType == AuthTypeUniversal {
+		req.SetBasicAuth(w.username, w.password)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf(webhookFailedError, webhookUrl, resp.Status)
+	}
+	return false, nil
+}
+
+func isJsonContentType(contentType string) bool {
+	return strings.Contains(strings.ToLower(contentType), "json")
+}
+
+// escapeJsonString escapes the value for a JSON string literal, without the enclosing quotes
+func escapeJsonString(value string) string {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return value
+	}
+	escaped := strings.TrimSpace(buffer.String())
+	return escaped[1 : len(escaped)-1]
+}
+
+func newWebhookSender(config Config) *webhookSender {
+	return &webhookSender{
+		client:     &http.Client{Timeout: time.Duration(config.WebhookTimeout) * time.Millisecond},
+		retries:    config.WebhookRetries,
+		retryDelay: time.Duration(config.WebhookRetryDelay) * time.Millisecond,
+	}
+}
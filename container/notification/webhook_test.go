@@ -0,0 +1,177 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package notification
+
+import (
+	"encoding/json"
+	"github.com/streamsets/datacollector-edge/container/common"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func getTestNotification() *stateNotification {
+	return &stateNotification{
+		pipelineId:    "pipeline1",
+		pipelineTitle: "Pipeline 1",
+		pipelineUrl:   "http://localhost:18633/collector/pipeline/pipeline1",
+		state: common.PipelineState{
+			PipelineId: "pipeline1",
+			Status:     common.RUN_ERROR,
+			Message:    "Pipeline failed",
+			TimeStamp:  1514764800000,
+		},
+	}
+}
+
+func TestWebhookSender_Send(t *testing.T) {
+	requests := 0
+	var payload, authHeader, customHeader string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		payload = string(body)
+		authHeader = r.Header.Get("Authorization")
+		customHeader = r.Header.Get("X-Custom")
+	}))
+	defer server.Close()
+
+	config := NewConfig()
+	config.WebhookRetryDelay = 1
+	webhookSender := newWebhookSender(config)
+
+	w := newWebhook(map[string]interface{}{
+		"webhookUrl": server.URL,
+		"headers":    []interface{}{map[string]interface{}{"key": "X-Custom", "value": "custom"}},
+		"httpMethod": "POST",
+		"payload":    "{{PIPELINE_TITLE}} {{PIPELINE_STATE}} {{PIPELINE_STATE_MESSAGE}}",
+		"authType":   AuthTypeBasic,
+		"username":   "admin",
+		"password":   "admin",
+	})
+
+	if err := webhookSender.send(w, getTestNotification()); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Errorf("Expected 2 requests, but got: %d", requests)
+	}
+	if payload != "Pipeline 1 RUN_ERROR Pipeline failed" {
+		t.Errorf("Unexpected payload: %s", payload)
+	}
+	if authHeader != "Basic YWRtaW46YWRtaW4=" {
+		t.Errorf("Unexpected Authorization header: %s", authHeader)
+	}
+	if customHeader != "custom" {
+		t.Errorf("Unexpected X-Custom header: %s", customHeader)
+	}
+}
+
+func TestWebhookSender_SendClientError(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	config := NewConfig()
+	config.WebhookRetryDelay = 1
+	webhookSender := newWebhookSender(config)
+
+	err := webhookSender.send(newWebhook(map[string]interface{}{"webhookUrl": server.URL}), getTestNotification())
+	if err == nil {
+		t.Fatal("Expected an error for a 400 response")
+	}
+	if requests != 1 {
+		t.Errorf("Expected client errors not to be retried, but got %d requests", requests)
+	}
+}
+
+func TestWebhookSender_SendJsonPayload(t *testing.T) {
+	var payload map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Errorf("Expected a valid JSON payload, but got: %s", string(body))
+		}
+	}))
+	defer server.Close()
+
+	webhookSender := newWebhookSender(NewConfig())
+	notification := getTestNotification()
+	notification.pipelineTitle = "Pipeline \"1\""
+	notification.state.Message = "Pipeline failed\nat <stage>"
+
+	w := newWebhook(map[string]interface{}{
+		"webhookUrl": server.URL,
+		"payload":    `{"title": "{{PIPELINE_TITLE}}", "message": "{{PIPELINE_STATE_MESSAGE}}"}`,
+	})
+	if err := webhookSender.send(w, notification); err != nil {
+		t.Fatal(err)
+	}
+	if payload["title"] != notification.pipelineTitle {
+		t.Errorf("Unexpected title: %s", payload["title"])
+	}
+	if payload["message"] != notification.state.Message {
+		t.Errorf("Unexpected message: %s", payload["message"])
+	}
+}
+
+func TestWebhookSender_SendEscapedUrl(t *testing.T) {
+	var title, state string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		title = r.URL.Query().Get("title")
+		state = r.URL.Query().Get("state")
+	}))
+	defer server.Close()
+
+	webhookSender := newWebhookSender(NewConfig())
+	notification := getTestNotification()
+	notification.pipelineTitle = "Pipeline #1 & 2?"
+
+	w := newWebhook(map[string]interface{}{
+		"webhookUrl": server.URL + "/?title={{PIPELINE_TITLE}}&state={{PIPELINE_STATE}}",
+	})
+	if err := webhookSender.send(w, notification); err != nil {
+		t.Fatal(err)
+	}
+	if title != notification.pipelineTitle {
+		t.Errorf("Expected title %s, but got: %s", notification.pipelineTitle, title)
+	}
+	if state != common.RUN_ERROR {
+		t.Errorf("Expected state %s, but got: %s", common.RUN_ERROR, state)
+	}
+}
+
+func TestValidateWebhookConfigs(t *testing.T) {
+	webhookConfigs := []interface{}{
+		map[string]interface{}{"webhookUrl": "http://localhost/basic", "authType": AuthTypeBasic},
+	}
+	if err := ValidateWebhookConfigs(webhookConfigs); err != nil {
+		t.Error(err)
+	}
+
+	webhookConfigs = append(webhookConfigs, map[string]interface{}{
+		"webhookUrl": "http://localhost/digest",
+		"authType":   "digest",
+	})
+	if err := ValidateWebhookConfigs(webhookConfigs); err == nil {
+		t.Error("Expected an error for DIGEST authentication")
+	}
+}
@@ -14,9 +14,16 @@ package process
 
 import (
 	"github.com/rcrowley/go-metrics"
+	log "github.com/sirupsen/logrus"
+	"github.com/streamsets/datacollector-edge/container/util"
 	"time"
 )
 
+const (
+	ProcessMemoryUsage = "process.memoryUsage"
+	ProcessMemoryTotal = "process.memoryTotal"
+)
+
 type Manager struct {
 	config                     Config
 	procMetricsCaptureInterval int64
@@ -38,6 +45,17 @@ func NewManager(config Config) (*Manager, error) {
 	}
 	metrics.RegisterRuntimeMemStats(mgr.processMetricsRegistry)
 	metrics.RegisterDebugGCStats(mgr.processMetricsRegistry)
+
+	// Memory usage compared against pipeline memory limits, evaluated whenever the metrics are read
+	mgr.processMetricsRegistry.Register(
+		ProcessMemoryUsage+util.GAUGE_SUFFIX,
+		metrics.NewFunctionalGauge(util.GetMemoryUsage),
+	)
+	if totalMemory, err := util.GetTotalMemory(); err == nil {
+		util.CreateGauge(mgr.processMetricsRegistry, ProcessMemoryTotal).Update(totalMemory)
+	} else {
+		log.WithError(err).Warn("Failed to read total host memory")
+	}
 	if config.ProcessMetricsCaptureInterval > 0 {
 		metrics.CaptureRuntimeMemStats(
 			mgr.processMetricsRegistry,
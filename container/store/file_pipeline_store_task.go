@@ -36,7 +36,7 @@ const (
 )
 
 type FilePipelineStoreTask struct {
-	runtimeInfo     common.RuntimeInfo
+	runtimeInfo     *common.RuntimeInfo
 	pipelineInfoMap sync.Map
 }
 
@@ -55,20 +55,12 @@ func (store *FilePipelineStoreTask) init() {
 
 	for _, f := range files {
 		if f.IsDir() {
-			pipelineInfo := common.PipelineInfo{}
-			file, err := os.Open(store.getPipelineInfoFile(f.Name()))
-			if err != nil {
-				log.WithError(err).Error("Failed to open pipeline info file")
-				return
-			}
-
-			decoder := json.NewDecoder(file)
-			if err = decoder.Decode(&pipelineInfo); err == nil {
+			pipelineInfo, err := readPipelineInfo(store.getPipelineInfoFile(f.Name()))
+			if err == nil {
 				store.pipelineInfoMap.Store(pipelineInfo.PipelineId, pipelineInfo)
 			} else {
-				log.WithError(err).Error("failed to parse pipeline info file")
+				log.WithError(err).WithField("pipeline", f.Name()).Error("Failed to read pipeline info file")
 			}
-			util.CloseFile(file)
 		}
 	}
 }
@@ -87,16 +79,7 @@ func (store *FilePipelineStoreTask) GetInfo(pipelineId string) (common.PipelineI
 		return common.PipelineInfo{}, errors.New("Pipeline '" + pipelineId + " does not exist")
 	}
 
-	pipelineInfo := common.PipelineInfo{}
-	file, err := os.Open(store.getPipelineInfoFile(pipelineId))
-	if err != nil {
-		return pipelineInfo, err
-	}
-
-	defer util.CloseFile(file)
-
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(&pipelineInfo)
+	pipelineInfo, err := readPipelineInfo(store.getPipelineInfoFile(pipelineId))
 	if err != nil {
 		return pipelineInfo, err
 	}
@@ -161,18 +144,7 @@ func (store *FilePipelineStoreTask) Create(
 		return pipelineConfiguration, err
 	}
 
-	pipelineInfoJson, err := json.MarshalIndent(pipelineInfo, "", "  ")
-	if err != nil {
-		return pipelineConfiguration, err
-	}
-	err = ioutil.WriteFile(store.getPipelineInfoFile(pipelineId), pipelineInfoJson, 0644)
-
-	pipelineConfigurationJson, err := json.MarshalIndent(pipelineConfiguration, "", "  ")
-	if err != nil {
-		return pipelineConfiguration, err
-	}
-	err = ioutil.WriteFile(store.getPipelineFile(pipelineId), pipelineConfigurationJson, 0644)
-	if err != nil {
+	if err = store.writePipelineFiles(pipelineId, pipelineInfo, pipelineConfiguration); err != nil {
 		return pipelineConfiguration, err
 	}
 
@@ -206,34 +178,23 @@ func (store *FilePipelineStoreTask) Save(
 	pipelineConfiguration.Info = pipelineInfo
 	pipelineConfiguration.UUID = pipelineUuid
 
-	pipelineInfoJson, err := json.MarshalIndent(pipelineInfo, "", "  ")
-	if err != nil {
-		return pipelineConfiguration, err
-	}
-	err = ioutil.WriteFile(store.getPipelineInfoFile(pipelineId), pipelineInfoJson, 0644)
-
-	pipelineConfigurationJson, err := json.MarshalIndent(pipelineConfiguration, "", "  ")
-	if err != nil {
+	if err := store.writePipelineFiles(pipelineId, pipelineInfo, pipelineConfiguration); err != nil {
 		return pipelineConfiguration, err
 	}
-	err = ioutil.WriteFile(store.getPipelineFile(pipelineId), pipelineConfigurationJson, 0644)
 
 	log.WithField("id", pipelineInfo.PipelineId).Info("Updated pipeline")
 
+	store.pipelineInfoMap.Store(pipelineInfo.PipelineId, pipelineInfo)
+
 	return pipelineConfiguration, nil
 }
 
 func (store *FilePipelineStoreTask) LoadPipelineConfig(pipelineId string) (common.PipelineConfiguration, error) {
 	pipelineConfiguration := common.PipelineConfiguration{}
-	file, err := os.Open(store.getPipelineFile(pipelineId))
-	if err != nil {
-		return pipelineConfiguration, err
-	}
-
-	defer util.CloseFile(file)
-
-	decoder := json.NewDecoder(file)
-	err = decoder.Decode(&pipelineConfiguration)
+	err := util.ReadFileWithBackup(store.getPipelineFile(pipelineId), func(data []byte) error {
+		pipelineConfiguration = common.PipelineConfiguration{}
+		return json.Unmarshal(data, &pipelineConfiguration)
+	})
 	if err != nil {
 		return pipelineConfiguration, err
 	}
@@ -256,12 +217,42 @@ func (store *FilePipelineStoreTask) Delete(pipelineId string) error {
 	if err != nil {
 		return err
 	}
-	err = os.RemoveAll(store.getPipelineRunInfoDir(pipelineId))
+	err = pipelineStateStore.DeletePipeline(pipelineId)
 	log.WithField("id", pipelineId).Info("Deleted pipeline")
 	store.pipelineInfoMap.Delete(pipelineId)
 	return err
 }
 
+// writePipelineFiles atomically replaces the pipeline info and configuration files
+func (store *FilePipelineStoreTask) writePipelineFiles(
+	pipelineId string,
+	pipelineInfo common.PipelineInfo,
+	pipelineConfiguration common.PipelineConfiguration,
+) error {
+	pipelineInfoJson, err := json.MarshalIndent(pipelineInfo, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = util.WriteFileAtomic(store.getPipelineInfoFile(pipelineId), pipelineInfoJson, 0644); err != nil {
+		return err
+	}
+
+	pipelineConfigurationJson, err := json.MarshalIndent(pipelineConfiguration, "", "  ")
+	if err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(store.getPipelineFile(pipelineId), pipelineConfigurationJson, 0644)
+}
+
+func readPipelineInfo(pipelineInfoFile string) (common.PipelineInfo, error) {
+	pipelineInfo := common.PipelineInfo{}
+	err := util.ReadFileWithBackup(pipelineInfoFile, func(data []byte) error {
+		pipelineInfo = common.PipelineInfo{}
+		return json.Unmarshal(data, &pipelineInfo)
+	})
+	return pipelineInfo, err
+}
+
 func (store *FilePipelineStoreTask) hasPipeline(pipelineId string) bool {
 	_, err := os.Stat(store.getPipelineDir(pipelineId))
 	if err == nil {
@@ -286,12 +277,7 @@ func (store *FilePipelineStoreTask) getPipelineDir(pipelineId string) string {
 	return store.runtimeInfo.BaseDir + PipelinesFolder + validPipelineId + "/"
 }
 
-func (store *FilePipelineStoreTask) getPipelineRunInfoDir(pipelineId string) string {
-	validPipelineId := strings.Replace(pipelineId, ":", "", -1)
-	return store.runtimeInfo.BaseDir + PipelinesRunInfoFolder + validPipelineId + "/"
-}
-
-func NewFilePipelineStoreTask(runtimeInfo common.RuntimeInfo) PipelineStoreTask {
+func NewFilePipelineStoreTask(runtimeInfo *common.RuntimeInfo) PipelineStoreTask {
 	pipelineStateStore.BaseDir = runtimeInfo.BaseDir
 	storeTask := &FilePipelineStoreTask{
 		runtimeInfo: runtimeInfo,
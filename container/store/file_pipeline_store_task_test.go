@@ -31,7 +31,7 @@ func getPipelineStoreTask(t *testing.T, path string) PipelineStoreTask {
 		t.Fatalf("MkdirAll %q: %s", baseDir+PipelinesFolder, err)
 	}
 
-	runtimeInfo := common.RuntimeInfo{
+	runtimeInfo := &common.RuntimeInfo{
 		HttpUrl: "httpUrl",
 		BaseDir: baseDir,
 	}
@@ -0,0 +1,98 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package util
+
+import (
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const (
+	BackupFileSuffix = ".bak"
+	TempFileSuffix   = ".tmp"
+)
+
+// WriteFileAtomic replaces the file without ever leaving a partially written file behind. The data is
+// written to a temporary file which is synced and renamed over the file, the previous generation is kept
+// as backup for ReadFileWithBackup.
+func WriteFileAtomic(filePath string, data []byte, perm os.FileMode) error {
+	tempFilePath := filePath + TempFileSuffix
+	tempFile, err := os.OpenFile(tempFilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err = tempFile.Write(data); err == nil {
+		err = tempFile.Sync()
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tempFilePath)
+		return err
+	}
+
+	if _, err := os.Stat(filePath); err == nil {
+		if err := os.Rename(filePath, filePath+BackupFileSuffix); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(tempFilePath, filePath); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(filePath))
+}
+
+// ReadFileWithBackup reads a file written by WriteFileAtomic and passes its content to decode. If the file
+// is missing or decode fails because the file is corrupted, the backup generation is decoded instead.
+// The returned error satisfies os.IsNotExist when neither the file nor its backup exist.
+func ReadFileWithBackup(filePath string, decode func(data []byte) error) error {
+	data, err := ioutil.ReadFile(filePath)
+	if err == nil {
+		if err = decode(data); err == nil {
+			return nil
+		}
+		log.WithError(err).WithField("file", filePath).Error("File is corrupted, falling back to the backup")
+	} else if !os.IsNotExist(err) {
+		log.WithError(err).WithField("file", filePath).Error("Failed to read file, falling back to the backup")
+	}
+
+	backupFilePath := filePath + BackupFileSuffix
+	backupData, backupErr := ioutil.ReadFile(backupFilePath)
+	if backupErr != nil {
+		if !os.IsNotExist(backupErr) {
+			log.WithError(backupErr).WithField("file", backupFilePath).Error("Failed to read backup file")
+		}
+		return err
+	}
+	if backupErr = decode(backupData); backupErr != nil {
+		log.WithError(backupErr).WithField("file", backupFilePath).Error("Backup file is corrupted")
+		return err
+	}
+
+	log.WithField("file", filePath).Warn("Recovered file from the backup")
+	return nil
+}
+
+func syncDir(dirPath string) error {
+	dir, err := os.Open(dirPath)
+	if err != nil {
+		return err
+	}
+	defer CloseFile(dir)
+	// Not all platforms support syncing directories, the rename is already done at this point
+	_ = dir.Sync()
+	return nil
+}
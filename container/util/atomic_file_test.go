@@ -0,0 +1,87 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package util
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readTestFile(filePath string) (map[string]string, error) {
+	var value map[string]string
+	err := ReadFileWithBackup(filePath, func(data []byte) error {
+		value = nil
+		return json.Unmarshal(data, &value)
+	})
+	return value, err
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atomic_file_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, "offset.json")
+
+	if _, err := readTestFile(filePath); !os.IsNotExist(err) {
+		t.Fatalf("Expected a not exist error, but got: %v", err)
+	}
+
+	if err := WriteFileAtomic(filePath, []byte(`{"offset":"1"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(filePath, []byte(`{"offset":"2"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filePath + TempFileSuffix); !os.IsNotExist(err) {
+		t.Error("Expected the temporary file to be renamed")
+	}
+
+	value, err := readTestFile(filePath)
+	if err != nil || value["offset"] != "2" {
+		t.Errorf("Expected offset 2, but got: %v, %v", value, err)
+	}
+
+	// A truncated file falls back to the previous generation
+	if err := ioutil.WriteFile(filePath, []byte(`{"offs`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	value, err = readTestFile(filePath)
+	if err != nil || value["offset"] != "1" {
+		t.Errorf("Expected offset 1 from the backup, but got: %v, %v", value, err)
+	}
+
+	// A missing file falls back to the previous generation as well
+	if err := os.Remove(filePath); err != nil {
+		t.Fatal(err)
+	}
+	value, err = readTestFile(filePath)
+	if err != nil || value["offset"] != "1" {
+		t.Errorf("Expected offset 1 from the backup, but got: %v, %v", value, err)
+	}
+
+	// Both generations corrupted
+	if err := ioutil.WriteFile(filePath, []byte(`{"offs`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filePath+BackupFileSuffix, []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = readTestFile(filePath); err == nil || os.IsNotExist(err) {
+		t.Errorf("Expected a corruption error, but got: %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2018 StreamSets Inc.
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package util
+
+import (
+	"github.com/shirou/gopsutil/mem"
+	"runtime"
+)
+
+const (
+	BytesPerMB = 1024 * 1024
+)
+
+// GetMemoryUsage returns the memory obtained from the OS by the Go runtime which was not released back yet
+func GetMemoryUsage() int64 {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	return int64(memStats.Sys - memStats.HeapReleased)
+}
+
+// GetTotalMemory returns the total physical memory of the host
+func GetTotalMemory() (int64, error) {
+	virtualMemory, err := mem.VirtualMemory()
+	if err != nil {
+		return 0, err
+	}
+	return int64(virtualMemory.Total), nil
+}
@@ -25,28 +25,29 @@ const (
 	GAUGE_SUFFIX        = ".gauge"
 )
 
+// Metrics are shared when they are already registered, so stage instances of multiple pipeline runners
+// report to the same metrics
+
 func CreateCounter(registry metrics.Registry, name string) metrics.Counter {
-	counter := metrics.NewCounter()
-	registry.Register(metricName(name, COUNTER_SUFFIX), counter)
-	return counter
+	return registry.GetOrRegister(metricName(name, COUNTER_SUFFIX), metrics.NewCounter).(metrics.Counter)
 }
 
 func CreateMeter(registry metrics.Registry, name string) metrics.Meter {
-	meter := metrics.NewMeter()
-	registry.Register(metricName(name, METER_SUFFIX), meter)
-	return meter
+	return registry.GetOrRegister(metricName(name, METER_SUFFIX), metrics.NewMeter).(metrics.Meter)
 }
 
 func CreateHistogram5Min(registry metrics.Registry, name string) metrics.Histogram {
-	histogram := metrics.NewHistogram(metrics.NewExpDecaySample(1028, 0.015))
-	registry.Register(metricName(name, HISTOGRAM_M5_SUFFIX), histogram)
-	return histogram
+	return registry.GetOrRegister(metricName(name, HISTOGRAM_M5_SUFFIX), func() metrics.Histogram {
+		return metrics.NewHistogram(metrics.NewExpDecaySample(1028, 0.015))
+	}).(metrics.Histogram)
 }
 
 func CreateTimer(registry metrics.Registry, name string) metrics.Timer {
-	timer := metrics.NewTimer()
-	registry.Register(metricName(name, TIMER_SUFFIX), timer)
-	return timer
+	return registry.GetOrRegister(metricName(name, TIMER_SUFFIX), metrics.NewTimer).(metrics.Timer)
+}
+
+func CreateGauge(registry metrics.Registry, name string) metrics.Gauge {
+	return registry.GetOrRegister(metricName(name, GAUGE_SUFFIX), metrics.NewGauge).(metrics.Gauge)
 }
 
 func metricName(name string, suffix string) string {
@@ -65,6 +66,68 @@ type MetricsJson struct {
 	Timers     map[string]map[string]interface{} `json:"timers"`
 }
 
+// FormatMetric returns the values of the metric keyed like in the Data Collector metrics JSON
+func FormatMetric(i interface{}) map[string]interface{} {
+	values := make(map[string]interface{})
+	switch metric := i.(type) {
+	case metrics.Counter:
+		values["count"] = metric.Count()
+	case metrics.Gauge:
+		values["value"] = metric.Value()
+	case metrics.GaugeFloat64:
+		values["value"] = metric.Value()
+	case metrics.Healthcheck:
+		values["error"] = nil
+		metric.Check()
+		if err := metric.Error(); nil != err {
+			values["error"] = metric.Error().Error()
+		}
+	case metrics.Histogram:
+		h := metric.Snapshot()
+		ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.98, 0.99, 0.999})
+		values["count"] = h.Count()
+		values["min"] = h.Min()
+		values["max"] = h.Max()
+		values["mean"] = h.Mean()
+		values["stddev"] = h.StdDev()
+		values["p50"] = ps[0]
+		values["p75"] = ps[1]
+		values["p95"] = ps[2]
+		values["p98"] = ps[3]
+		values["p99"] = ps[4]
+		values["p999"] = ps[5]
+	case metrics.Meter:
+		m := metric.Snapshot()
+		values["count"] = m.Count()
+		values["m1_rate"] = m.Rate1()
+		values["m5_rate"] = m.Rate5()
+		values["m15_rate"] = m.Rate15()
+		values["mean_rate"] = m.RateMean()
+		values["units"] = "events/second"
+	case metrics.Timer:
+		t := metric.Snapshot()
+		ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.98, 0.99, 0.999})
+		values["count"] = t.Count()
+		values["min"] = ConvertNanoToSecondsInt(t.Min())
+		values["max"] = ConvertNanoToSecondsInt(t.Max())
+		values["mean"] = ConvertNanoToSecondsFloat(t.Mean())
+		values["stddev"] = ConvertNanoToSecondsFloat(t.StdDev())
+		values["p50"] = ConvertNanoToSecondsFloat(ps[0])
+		values["p75"] = ConvertNanoToSecondsFloat(ps[1])
+		values["p95"] = ConvertNanoToSecondsFloat(ps[2])
+		values["p98"] = ConvertNanoToSecondsFloat(ps[3])
+		values["p99"] = ConvertNanoToSecondsFloat(ps[4])
+		values["p999"] = ConvertNanoToSecondsFloat(ps[5])
+		values["m1_rate"] = t.Rate1()
+		values["m5_rate"] = t.Rate5()
+		values["m15_rate"] = t.Rate15()
+		values["mean_rate"] = t.RateMean()
+		values["duration_units"] = "seconds"
+		values["rate_units"] = "calls/second"
+	}
+	return values
+}
+
 func FormatMetricsRegistry(r metrics.Registry) MetricsJson {
 	gauges := make(map[string]map[string]interface{})
 	counters := make(map[string]map[string]interface{})
@@ -73,67 +136,19 @@ func FormatMetricsRegistry(r metrics.Registry) MetricsJson {
 	timers := make(map[string]map[string]interface{})
 
 	r.Each(func(name string, i interface{}) {
-		values := make(map[string]interface{})
-		switch metric := i.(type) {
+		values := FormatMetric(i)
+		switch i.(type) {
 		case metrics.Counter:
-			values["count"] = metric.Count()
 			counters[name] = values
 		case metrics.Gauge:
-			values["value"] = metric.Value()
 			gauges[name] = values
 		case metrics.GaugeFloat64:
-			values["value"] = metric.Value()
 			counters[name] = values
-		case metrics.Healthcheck:
-			values["error"] = nil
-			metric.Check()
-			if err := metric.Error(); nil != err {
-				values["error"] = metric.Error().Error()
-			}
 		case metrics.Histogram:
-			h := metric.Snapshot()
-			ps := h.Percentiles([]float64{0.5, 0.75, 0.95, 0.98, 0.99, 0.999})
-			values["count"] = h.Count()
-			values["min"] = h.Min()
-			values["max"] = h.Max()
-			values["mean"] = h.Mean()
-			values["stddev"] = h.StdDev()
-			values["p50"] = ps[0]
-			values["p75"] = ps[1]
-			values["p95"] = ps[2]
-			values["p98"] = ps[3]
-			values["p99"] = ps[4]
-			values["p999"] = ps[5]
 			histograms[name] = values
 		case metrics.Meter:
-			m := metric.Snapshot()
-			values["count"] = m.Count()
-			values["m1_rate"] = m.Rate1()
-			values["m5_rate"] = m.Rate5()
-			values["m15_rate"] = m.Rate15()
-			values["mean_rate"] = m.RateMean()
-			values["units"] = "events/second"
 			meters[name] = values
 		case metrics.Timer:
-			t := metric.Snapshot()
-			ps := t.Percentiles([]float64{0.5, 0.75, 0.95, 0.98, 0.99, 0.999})
-			values["count"] = t.Count()
-			values["min"] = ConvertNanoToSecondsInt(t.Min())
-			values["max"] = ConvertNanoToSecondsInt(t.Max())
-			values["mean"] = ConvertNanoToSecondsFloat(t.Mean())
-			values["stddev"] = ConvertNanoToSecondsFloat(t.StdDev())
-			values["p50"] = ConvertNanoToSecondsFloat(ps[0])
-			values["p75"] = ConvertNanoToSecondsFloat(ps[1])
-			values["p95"] = ConvertNanoToSecondsFloat(ps[2])
-			values["p98"] = ConvertNanoToSecondsFloat(ps[3])
-			values["p99"] = ConvertNanoToSecondsFloat(ps[4])
-			values["p999"] = ConvertNanoToSecondsFloat(ps[5])
-			values["m1_rate"] = t.Rate1()
-			values["m5_rate"] = t.Rate5()
-			values["m15_rate"] = t.Rate15()
-			values["mean_rate"] = t.RateMean()
-			values["duration_units"] = "seconds"
-			values["rate_units"] = "calls/second"
 			timers[name] = values
 		}
 	})
@@ -43,6 +43,16 @@ var debugFlag = flag.Bool("debug", false, "Debug flag")
 var logToConsoleFlag = flag.Bool("logToConsole", false, "Log to console flag")
 var startFlag = flag.String("start", "", "Start Pipeline ID")
 var runtimeParametersArg = flag.String("runtimeParameters", "", "Runtime Parameters")
+var runArg = flag.String(
+	"run",
+	"",
+	"Run the pipeline with the given ID or pipeline JSON file once without the web server and exit",
+)
+var maxBatchesArg = flag.Int64(
+	"maxBatches",
+	0,
+	"Maximum number of batches processed by the -run pipeline, 0 runs it until the origin is finished",
+)
 var insecureSkipVerifyArg = flag.Bool(
 	"insecureSkipVerify",
 	false,
@@ -215,6 +225,15 @@ func main() {
 			panic(err)
 		}
 		fmt.Println("Control Hub disabled successfully")
+	} else if len(*runArg) > 0 {
+		os.Exit(edge.RunOffline(
+			getBaseDir(),
+			*debugFlag,
+			*logToConsoleFlag,
+			*runArg,
+			*runtimeParametersArg,
+			*maxBatchesArg,
+		))
 	} else {
 		err = newService.Run()
 		if err != nil {
@@ -239,10 +258,7 @@ func shutdownHook(dataCollectorEdge *edge.DataCollectorEdgeMain) {
 			}
 		}
 	}
-	dataCollectorEdge.WebServerTask.Shutdown()
-	if dataCollectorEdge.RuntimeInfo.DPMEnabled {
-		dataCollectorEdge.DPMMessageEventHandler.Shutdown()
-	}
+	dataCollectorEdge.Shutdown()
 	log.Info("Data Collector Edge shutting down")
 }
 
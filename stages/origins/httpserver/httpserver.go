@@ -31,6 +31,8 @@ import (
 	"io/ioutil"
 	"net/http"
 	"strconv"
+	"sync"
+	"time"
 )
 
 const (
@@ -39,6 +41,8 @@ const (
 	X_SDC_APPLICATION_ID_HEADER    = "X-SDC-APPLICATION-ID"
 	SDC_APPLICATION_ID_QUERY_PARAM = "sdcApplicationId"
 	PKCS12                         = "PKCS12"
+	DefaultMaxConcurrentRequests   = 10
+	stopPollInterval               = 100 * time.Millisecond
 )
 
 var stringOffset = "http-server-offset"
@@ -50,12 +54,15 @@ type Origin struct {
 	DataFormatConfig dataparser.DataParserFormatConfig `ConfigDefBean:"dataFormatConfig"`
 	httpServer       *http.Server
 	incomingRecords  chan []api.Record
+	pushContext      api.PushContext
+	pushContextMutex sync.RWMutex
 }
 
 type RawHttpConfigs struct {
 	Port                      float64                  `ConfigDef:"type=NUMBER,required=true"`
 	AppId                     string                   `ConfigDef:"type=STRING,required=true"`
 	AppIdViaQueryParamAllowed bool                     `ConfigDef:"type=BOOLEAN,required=true"`
+	MaxConcurrentRequests     float64                  `ConfigDef:"type=NUMBER,required=false"`
 	TlsConfigBean             httpcommon.TlsConfigBean `ConfigDefBean:"tlsConfigBean"`
 }
 
@@ -122,6 +129,27 @@ func (h *Origin) Produce(
 	return &stringOffset, nil
 }
 
+// GetNumberOfThreads returns the maximum number of requests processed concurrently, every request is
+// processed by its own pipeline runner
+func (h *Origin) GetNumberOfThreads() int {
+	if h.HttpConfigs.MaxConcurrentRequests <= 0 {
+		return DefaultMaxConcurrentRequests
+	}
+	return int(h.HttpConfigs.MaxConcurrentRequests)
+}
+
+// Run hands the records of incoming requests to the pipeline runners until the pipeline is stopped
+func (h *Origin) Run(lastOffsets map[string]string, maxBatchSize int, pushContext api.PushContext) error {
+	log.WithField("runners", h.GetNumberOfThreads()).Debug("HTTP Server - Run method")
+	h.pushContextMutex.Lock()
+	h.pushContext = pushContext
+	h.pushContextMutex.Unlock()
+	for !h.GetStageContext().IsStopped() {
+		time.Sleep(stopPollInterval)
+	}
+	return nil
+}
+
 func (h *Origin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if h.validateAppId(w, r) {
 		recordReaderFactory := h.DataFormatConfig.RecordReaderFactory
@@ -147,7 +175,24 @@ func (h *Origin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			records = append(records, record)
 		}
 
-		if len(records) > 0 {
+		if len(records) == 0 {
+			return
+		}
+
+		h.pushContextMutex.RLock()
+		pushContext := h.pushContext
+		h.pushContextMutex.RUnlock()
+
+		if pushContext != nil {
+			batchContext := pushContext.StartBatch()
+			for _, record := range records {
+				batchContext.GetBatchMaker().AddRecord(record)
+			}
+			if !pushContext.ProcessBatch(batchContext, stringOffset, &stringOffset) {
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = fmt.Fprintf(w, "Failed to process records")
+			}
+		} else {
 			h.incomingRecords <- records
 		}
 	}
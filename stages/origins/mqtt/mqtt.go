@@ -26,9 +26,10 @@ import (
 )
 
 const (
-	Library         = "streamsets-datacollector-basic-lib"
-	StageName       = "com_streamsets_pipeline_stage_origin_mqtt_MqttClientDSource"
-	TopicHeaderName = "topic"
+	Library          = "streamsets-datacollector-basic-lib"
+	StageName        = "com_streamsets_pipeline_stage_origin_mqtt_MqttClientDSource"
+	TopicHeaderName  = "topic"
+	stopPollInterval = 100 * time.Millisecond
 )
 
 var defaultOffset = "mqtt-subscriber-offset"
@@ -38,7 +39,7 @@ type Origin struct {
 	*mqttlib.MqttConnector
 	CommonConf      mqttlib.MqttClientConfigBean `ConfigDefBean:"commonConf"`
 	SubscriberConf  SubscriberConfigBean         `ConfigDefBean:"subscriberConf"`
-	incomingRecords chan api.Record
+	incomingRecords chan []api.Record
 }
 
 type SubscriberConfigBean struct {
@@ -65,7 +66,7 @@ func (ms *Origin) Init(stageContext api.StageContext) []validation.Issue {
 	log.Debug("MQTT Subscriber Init method")
 	issues := ms.BaseStage.Init(stageContext)
 
-	ms.incomingRecords = make(chan api.Record)
+	ms.incomingRecords = make(chan []api.Record)
 
 	if err := ms.InitializeClient(ms.CommonConf); err != nil {
 		issues = append(issues, stageContext.CreateConfigIssue(err.Error()))
@@ -98,8 +99,8 @@ func (ms *Origin) Produce(
 	end := false
 	for !end && !ms.GetStageContext().IsStopped() {
 		select {
-		case record := <-ms.incomingRecords:
-			if record != nil {
+		case records := <-ms.incomingRecords:
+			for _, record := range records {
 				batchMaker.AddRecord(record)
 			}
 			return &defaultOffset, nil
@@ -110,6 +111,34 @@ func (ms *Origin) Produce(
 	return &defaultOffset, nil
 }
 
+// GetNumberOfThreads returns 1, the MQTT client delivers the messages of all subscribed topics in order
+// from a single goroutine
+func (ms *Origin) GetNumberOfThreads() int {
+	return 1
+}
+
+// Run pushes the records of every received message as a batch until the pipeline is stopped
+func (ms *Origin) Run(lastOffsets map[string]string, maxBatchSize int, pushContext api.PushContext) error {
+	log.Debug("MQTT Subscriber - Run method")
+	for !ms.GetStageContext().IsStopped() {
+		select {
+		case records := <-ms.incomingRecords:
+			if len(records) == 0 {
+				continue
+			}
+			batchContext := pushContext.StartBatch()
+			for _, record := range records {
+				batchContext.GetBatchMaker().AddRecord(record)
+			}
+			if !pushContext.ProcessBatch(batchContext, defaultOffset, &defaultOffset) {
+				log.Error("MQTT Subscriber - Failed to process records")
+			}
+		case <-time.After(stopPollInterval):
+		}
+	}
+	return nil
+}
+
 func (ms *Origin) Destroy() error {
 	log.Debug("MQTT Subscriber - Destroy method")
 	ms.Client.Unsubscribe(ms.SubscriberConf.TopicFilters...).Wait()
@@ -128,6 +157,7 @@ func (ms *Origin) MessageHandler(client MQTT.Client, msg MQTT.Message) {
 	}
 	defer recordReader.Close()
 
+	records := make([]api.Record, 0)
 	for {
 		record, err := recordReader.ReadRecord()
 		if err != nil {
@@ -138,6 +168,10 @@ func (ms *Origin) MessageHandler(client MQTT.Client, msg MQTT.Message) {
 			break
 		}
 		record.GetHeader().SetAttribute(TopicHeaderName, msg.Topic())
-		ms.incomingRecords <- record
+		records = append(records, record)
+	}
+
+	if len(records) > 0 {
+		ms.incomingRecords <- records
 	}
 }
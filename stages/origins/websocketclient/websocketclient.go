@@ -24,12 +24,14 @@ import (
 	"github.com/streamsets/datacollector-edge/stages/lib/httpcommon"
 	"github.com/streamsets/datacollector-edge/stages/stagelibrary"
 	"net/http"
+	"time"
 )
 
 const (
 	Library               = "streamsets-datacollector-basic-lib"
 	StageName             = "com_streamsets_pipeline_stage_origin_websocket_WebSocketClientDSource"
 	ConnectionClosedError = "connection closed, code: %d, message: %s"
+	stopPollInterval      = 100 * time.Millisecond
 )
 
 var defaultOffset = "webSocket"
@@ -37,7 +39,7 @@ var defaultOffset = "webSocket"
 type Origin struct {
 	*common.BaseStage
 	Conf            OriginClientConfig `ConfigDefBean:"conf"`
-	incomingRecords chan api.Record
+	incomingRecords chan []api.Record
 	webSocketConn   *websocket.Conn
 	destroyed       chan bool
 }
@@ -59,7 +61,7 @@ func init() {
 
 func (o *Origin) Init(stageContext api.StageContext) []validation.Issue {
 	issues := o.BaseStage.Init(stageContext)
-	o.incomingRecords = make(chan api.Record)
+	o.incomingRecords = make(chan []api.Record)
 	issues = o.Conf.DataFormatConfig.Init(o.Conf.DataFormat, stageContext, issues)
 	o.destroyed = make(chan bool)
 	if len(issues) == 0 {
@@ -88,13 +90,40 @@ func (o *Origin) Init(stageContext api.StageContext) []validation.Issue {
 }
 
 func (o *Origin) Produce(lastSourceOffset *string, maxBatchSize int, batchMaker api.BatchMaker) (*string, error) {
-	record := <-o.incomingRecords
-	if record != nil {
+	records := <-o.incomingRecords
+	for _, record := range records {
 		batchMaker.AddRecord(record)
 	}
 	return &defaultOffset, nil
 }
 
+// GetNumberOfThreads returns 1, the messages of the WebSocket connection are read by a single goroutine
+func (o *Origin) GetNumberOfThreads() int {
+	return 1
+}
+
+// Run pushes the records of every received message as a batch until the pipeline is stopped
+func (o *Origin) Run(lastOffsets map[string]string, maxBatchSize int, pushContext api.PushContext) error {
+	log.Debug("WebSocket Client Origin Run method")
+	for !o.GetStageContext().IsStopped() {
+		select {
+		case records := <-o.incomingRecords:
+			if len(records) == 0 {
+				continue
+			}
+			batchContext := pushContext.StartBatch()
+			for _, record := range records {
+				batchContext.GetBatchMaker().AddRecord(record)
+			}
+			if !pushContext.ProcessBatch(batchContext, defaultOffset, &defaultOffset) {
+				log.Error("WebSocket Client Origin failed to process records")
+			}
+		case <-time.After(stopPollInterval):
+		}
+	}
+	return nil
+}
+
 func (o *Origin) Destroy() error {
 	log.Debug("WebSocket Client Origin Destroy method")
 	if o.webSocketConn != nil {
@@ -130,6 +159,7 @@ func (o *Origin) processMessage(message []byte) {
 	}
 	defer recordReader.Close()
 
+	records := make([]api.Record, 0)
 	for {
 		record, err := recordReader.ReadRecord()
 		if err != nil {
@@ -139,7 +169,11 @@ func (o *Origin) processMessage(message []byte) {
 		if record == nil {
 			break
 		}
-		o.incomingRecords <- record
+		records = append(records, record)
+	}
+
+	if len(records) > 0 {
+		o.incomingRecords <- records
 	}
 }
 